@@ -0,0 +1,174 @@
+package jsonserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// JSONRouteAction is a function signature for actions that receive the
+// request body decoded from JSON into a particular type
+type JSONRouteAction[T any] func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *T)
+
+// DecodeOptions configures how JSON request bodies are decoded
+type DecodeOptions struct {
+	DisallowUnknownFields bool
+	UseNumber             bool
+}
+
+// errInvalidJSON is returned when a request body cannot be parsed as JSON
+var errInvalidJSON = errors.New("Request body is not valid JSON")
+
+// WithStrictJSON rejects JSON request bodies containing fields that the type
+// they are decoded into does not have
+func WithStrictJSON() RouteOption {
+
+	return func(route *Route) {
+		route.DecodeOptions.DisallowUnknownFields = true
+	}
+
+}
+
+// WithJSONNumbers decodes numbers in JSON request bodies into interface{}
+// values as json.Number rather than float64
+func WithJSONNumbers() RouteOption {
+
+	return func(route *Route) {
+		route.DecodeOptions.UseNumber = true
+	}
+
+}
+
+// RegisterJSONRoute stores an action to execute against a method and path,
+// which receives the request body decoded from JSON (or another format
+// negotiated with the server's codecs) into T and validated against T's
+// validate tags. Requests whose bodies cannot be decoded or fail validation
+// receive a 400 response listing every invalid field, and the action is not
+// executed
+func RegisterJSONRoute[T any](registrar RouteRegistrar, method string, path string, middleware []Middleware, action JSONRouteAction[T], options ...RouteOption) error {
+
+	bodyType := reflect.TypeOf((*T)(nil)).Elem()
+
+	if err := CheckValidationTags(bodyType); err != nil {
+		return err
+	}
+
+	// The body type is documented unless the options document another one
+	options = append([]RouteOption{func(route *Route) { route.Docs.RequestBody = bodyType }}, options...)
+
+	// Options are applied to a throwaway route to find out how to decode bodies
+	route := Route{}
+
+	for _, option := range options {
+		option(&route)
+	}
+
+	decodeOptions := route.DecodeOptions
+
+	return registrar.RegisterRoute(method, path, middleware, func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) {
+
+		value := new(T)
+
+		if err := decodeBody(ctx, request, *body, value, decodeOptions); err != nil {
+			WriteValidationError(ctx, request, response, err)
+			return
+		}
+
+		action(ctx, request, response, value)
+
+	}, options...)
+
+}
+
+// DecodeJSON decodes a JSON body into a value and validates it, returning
+// ValidationErrors if any fields are invalid
+func DecodeJSON(body []byte, value interface{}, options DecodeOptions) error {
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+
+	if options.DisallowUnknownFields {
+		decoder.DisallowUnknownFields()
+	}
+
+	if options.UseNumber {
+		decoder.UseNumber()
+	}
+
+	if err := decoder.Decode(value); err != nil {
+		return decodeError(err)
+	}
+
+	// Only a single JSON document is allowed
+	if _, err := decoder.Token(); err != io.EOF {
+		return errInvalidJSON
+	}
+
+	return Validate(value)
+
+}
+
+// WriteValidationError writes a 400 response for a body that could not be
+// decoded or failed validation, listing every invalid field, or a 415 response
+// for a body in an unsupported format, using the error renderer of the server
+// handling the request
+func WriteValidationError(ctx context.Context, request *http.Request, response http.ResponseWriter, err error) {
+
+	if errors.Is(err, ErrUnsupportedMediaType) {
+		serverFromContext(ctx).renderError(request, response, ErrorUnsupportedMediaType, http.StatusUnsupportedMediaType, err)
+		return
+	}
+
+	serverFromContext(ctx).renderError(request, response, ErrorInvalidBody, http.StatusBadRequest, err)
+
+}
+
+// decodeError turns an error from decoding JSON into ValidationErrors where
+// it relates to a particular field
+func decodeError(err error) error {
+
+	var typeError *json.UnmarshalTypeError
+
+	if errors.As(err, &typeError) && typeError.Field != "" {
+		return ValidationErrors{{Field: typeError.Field, Rule: "type", Message: "must be of type " + jsonTypeName(typeError.Type)}}
+	}
+
+	if strings.HasPrefix(err.Error(), "json: unknown field ") {
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		return ValidationErrors{{Field: field, Rule: "unknown", Message: "is not allowed"}}
+	}
+
+	return errInvalidJSON
+
+}
+
+// jsonTypeName describes a Go type using the names of JSON types
+func jsonTypeName(valueType reflect.Type) string {
+
+	switch valueType.Kind() {
+
+	case reflect.Bool:
+
+		return "boolean"
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+
+		return "number"
+
+	case reflect.String:
+
+		return "string"
+
+	case reflect.Slice, reflect.Array:
+
+		return "array"
+
+	}
+
+	return "object"
+
+}
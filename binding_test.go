@@ -0,0 +1,113 @@
+package jsonserver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// testProduct is a struct used to test binding request bodies
+type testProduct struct {
+	Name  string      `json:"name" validate:"required"`
+	Price float64     `json:"price" validate:"min=0"`
+	Meta  interface{} `json:"meta"`
+}
+
+// testBindingServer creates a server with routes that bind their bodies
+func testBindingServer() *Server {
+
+	server := NewServer()
+
+	action := func(ctx context.Context, request *http.Request, response http.ResponseWriter, product *testProduct) {
+		WriteResponse(response, &JSON{"name": product.Name, "price": product.Price, "meta": product.Meta}, http.StatusCreated)
+	}
+
+	RegisterJSONRoute(server, "POST", "/products", []Middleware{}, action)
+	RegisterJSONRoute(server, "POST", "/strict", []Middleware{}, action, WithStrictJSON())
+
+	RegisterJSONRoute(server, "POST", "/numbers", []Middleware{}, func(ctx context.Context, request *http.Request, response http.ResponseWriter, product *testProduct) {
+		_, isNumber := product.Meta.(json.Number)
+		WriteResponse(response, &JSON{"number": isNumber}, http.StatusOK)
+	}, WithJSONNumbers())
+
+	return server
+
+}
+
+// TestJSONRouteDecodesBody tests that a valid body is decoded and passed to
+// the action
+func TestJSONRouteDecodesBody(t *testing.T) {
+
+	response := testRequest(testBindingServer(), "POST", "/products", strings.NewReader(`{"name":"Chair","price":9.5,"colour":"red"}`), nil)
+
+	if response.Code != http.StatusCreated || response.Body.String() != `{"meta":null,"name":"Chair","price":9.5}` {
+		t.Errorf("Body was not decoded (status code: %v, body: %v)", response.Code, response.Body.String())
+	}
+
+}
+
+// TestJSONRouteRejectsInvalidBody tests that invalid bodies receive a 400
+// response listing every invalid field
+func TestJSONRouteRejectsInvalidBody(t *testing.T) {
+
+	bodies := map[string]string{
+		`{"price":-1}`:                      `{"errors":[{"field":"name","rule":"required","message":"is required"},{"field":"price","rule":"min","message":"must be at least 0"}],"message":"Request body is invalid","success":false}`,
+		`{"name":"Chair","price":"free"}`:   `{"errors":[{"field":"price","rule":"type","message":"must be of type number"}],"message":"Request body is invalid","success":false}`,
+		`{"name":`:                          `{"message":"Request body is not valid JSON","success":false}`,
+		`{"name":"Chair"} {"name":"Table"}`: `{"message":"Request body is not valid JSON","success":false}`,
+		``:                                  `{"message":"Request body is not valid JSON","success":false}`,
+	}
+
+	for body, expected := range bodies {
+
+		response := testRequest(testBindingServer(), "POST", "/products", strings.NewReader(body), nil)
+
+		if response.Code != http.StatusBadRequest || response.Body.String() != expected {
+			t.Errorf("Incorrect response for %v (status code: %v, body: %v)", body, response.Code, response.Body.String())
+		}
+
+	}
+
+}
+
+// TestJSONRouteStrictDecoding tests that unknown fields can be rejected
+func TestJSONRouteStrictDecoding(t *testing.T) {
+
+	response := testRequest(testBindingServer(), "POST", "/strict", strings.NewReader(`{"name":"Chair","colour":"red"}`), nil)
+	expected := `{"errors":[{"field":"colour","rule":"unknown","message":"is not allowed"}],"message":"Request body is invalid","success":false}`
+
+	if response.Code != http.StatusBadRequest || response.Body.String() != expected {
+		t.Errorf("Unknown field was not rejected (status code: %v, body: %v)", response.Code, response.Body.String())
+	}
+
+}
+
+// TestJSONRouteNumbers tests that numbers can be decoded as json.Number
+func TestJSONRouteNumbers(t *testing.T) {
+
+	response := testRequest(testBindingServer(), "POST", "/numbers", strings.NewReader(`{"name":"Chair","meta":12345678901234567890}`), nil)
+
+	if response.Body.String() != `{"number":true}` {
+		t.Errorf("Number was not decoded as json.Number (body: %v)", response.Body.String())
+	}
+
+}
+
+// TestRegisterJSONRouteWithInvalidTags tests that a route whose body type has
+// invalid validate tags is not registered
+func TestRegisterJSONRouteWithInvalidTags(t *testing.T) {
+
+	type testInvalid struct {
+		Name string `validate:"shiny"`
+	}
+
+	router := &Router{}
+	err := RegisterJSONRoute(router, "POST", "/", []Middleware{}, func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *testInvalid) {})
+
+	if err == nil || len(router.Routes["POST"]) != 0 {
+		t.Errorf("Route with invalid validate tags was registered")
+	}
+
+}
@@ -0,0 +1,95 @@
+package jsonserver
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+)
+
+// errBodyTooLarge is returned when a request body exceeds the maximum size
+var errBodyTooLarge = errors.New("request body too large")
+
+// WithMaxBodySize overrides the server's maximum request body size (in bytes)
+// for a route; a negative size removes the limit
+func WithMaxBodySize(maxBodySize int64) RouteOption {
+
+	return func(route *Route) {
+		route.MaxBodySize = maxBodySize
+	}
+
+}
+
+// WithStreamedBody stops the request body being read into memory for a route,
+// leaving it to be read as a stream from the request (subject to the maximum
+// body size) and passing an empty body to middleware and the action
+func WithStreamedBody() RouteOption {
+
+	return func(route *Route) {
+		route.StreamBody = true
+	}
+
+}
+
+// WriteBodyError writes a 413 response for an error caused by a streamed body
+// exceeding the maximum body size, or a 400 response for any other error
+// reading it, using the error renderer of the server handling the request
+func WriteBodyError(ctx context.Context, request *http.Request, response http.ResponseWriter, err error) {
+
+	var maxBytesError *http.MaxBytesError
+
+	if errors.As(err, &maxBytesError) || errors.Is(err, errBodyTooLarge) {
+		serverFromContext(ctx).renderError(request, response, ErrorBodyTooLarge, http.StatusRequestEntityTooLarge, errBodyTooLarge)
+		return
+	}
+
+	serverFromContext(ctx).renderError(request, response, ErrorBodyUnreadable, http.StatusBadRequest, err)
+
+}
+
+// readBody reads the body of a request for a route into memory (unless the
+// route streams its body), enforcing the maximum body size and writing the
+// body back to the request for later use
+func (server *Server) readBody(route *Route, request *http.Request, response http.ResponseWriter) ([]byte, error) {
+
+	// Routes can override the server's maximum body size
+	maxBodySize := server.MaxBodySize
+
+	if route.MaxBodySize != 0 {
+		maxBodySize = route.MaxBodySize
+	}
+
+	if maxBodySize > 0 {
+
+		if request.ContentLength > maxBodySize {
+			return nil, errBodyTooLarge
+		}
+
+		request.Body = http.MaxBytesReader(response, request.Body, maxBodySize)
+
+	}
+
+	if route.StreamBody {
+		return []byte{}, nil
+	}
+
+	body, err := ioutil.ReadAll(request.Body)
+
+	if err != nil {
+
+		var maxBytesError *http.MaxBytesError
+
+		if errors.As(err, &maxBytesError) {
+			return nil, errBodyTooLarge
+		}
+
+		return nil, err
+
+	}
+
+	request.Body = ioutil.NopCloser(bytes.NewBuffer(body))
+
+	return body, nil
+
+}
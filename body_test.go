@@ -0,0 +1,163 @@
+package jsonserver
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// testBodyServer creates a server with routes that read their bodies in
+// different ways
+func testBodyServer() *Server {
+
+	server := NewServer()
+	server.MaxBodySize = 10
+
+	echo := func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) {
+		response.Write(*body)
+	}
+
+	server.RegisterRoute("POST", "/small", []Middleware{}, echo)
+	server.RegisterRoute("POST", "/large", []Middleware{}, echo, WithMaxBodySize(100))
+	server.RegisterRoute("POST", "/unlimited", []Middleware{}, echo, WithMaxBodySize(-1))
+
+	server.RegisterRoute("POST", "/stream", []Middleware{}, func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) {
+
+		streamed, err := ioutil.ReadAll(request.Body)
+
+		if err != nil {
+			WriteBodyError(ctx, request, response, err)
+			return
+		}
+
+		response.Write([]byte(string(*body) + "|" + string(streamed)))
+
+	}, WithStreamedBody())
+
+	return server
+
+}
+
+// testBody creates a request body, hiding its length if requested
+func testBody(body string, hideLength bool) io.Reader {
+
+	if hideLength {
+		return ioutil.NopCloser(strings.NewReader(body))
+	}
+
+	return strings.NewReader(body)
+
+}
+
+// TestBodyWithinLimit tests that bodies within the maximum size are passed to
+// the action
+func TestBodyWithinLimit(t *testing.T) {
+
+	response := testRequest(testBodyServer(), "POST", "/small", strings.NewReader("0123456789"), nil)
+
+	if response.Code != http.StatusOK || response.Body.String() != "0123456789" {
+		t.Errorf("Body was not passed to the action (status code: %v, body: %v)", response.Code, response.Body.String())
+	}
+
+}
+
+// TestBodyExceedingLimit tests that bodies over the maximum size receive a 413
+// response, whether or not their length is declared up front
+func TestBodyExceedingLimit(t *testing.T) {
+
+	for _, hideLength := range []bool{false, true} {
+
+		response := testRequest(testBodyServer(), "POST", "/small", testBody("01234567890", hideLength), nil)
+
+		if response.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("Incorrect status code (expected: %v, actual: %v)", http.StatusRequestEntityTooLarge, response.Code)
+		}
+
+		if response.Body.String() != `{"message":"Request body too large","success":false}` {
+			t.Errorf("Incorrect body (actual: %v)", response.Body.String())
+		}
+
+	}
+
+}
+
+// TestBodyExceedingLimitRunsServerMiddleware tests that server middleware
+// runs before a body that is too large is rejected
+func TestBodyExceedingLimitRunsServerMiddleware(t *testing.T) {
+
+	server := testBodyServer()
+
+	server.Use(func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) (bool, int) {
+		response.Header().Set("X-Request-ID", "abc")
+		return true, 0
+	})
+
+	response := testRequest(server, "POST", "/small", testBody("01234567890", true), nil)
+
+	if response.Code != http.StatusRequestEntityTooLarge || response.Header().Get("X-Request-ID") != "abc" {
+		t.Errorf("Server middleware did not run (status code: %v, headers: %v)", response.Code, response.Header())
+	}
+
+}
+
+// TestRouteMaxBodySizeOverridesServer tests that a route's maximum body size
+// takes precedence over the server's
+func TestRouteMaxBodySizeOverridesServer(t *testing.T) {
+
+	server := testBodyServer()
+	body := strings.Repeat("x", 50)
+
+	if response := testRequest(server, "POST", "/large", testBody(body, true), nil); response.Body.String() != body {
+		t.Errorf("Route's larger maximum body size was not used")
+	}
+
+	if response := testRequest(server, "POST", "/large", testBody(strings.Repeat("x", 101), true), nil); response.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Route's maximum body size was not enforced")
+	}
+
+	if response := testRequest(server, "POST", "/unlimited", strings.NewReader(strings.Repeat("x", 1000)), nil); response.Code != http.StatusOK {
+		t.Errorf("Route's maximum body size was not removed")
+	}
+
+}
+
+// TestStreamedBody tests that a route can read its body as a stream
+func TestStreamedBody(t *testing.T) {
+
+	server := testBodyServer()
+
+	if response := testRequest(server, "POST", "/stream", testBody("012345", true), nil); response.Body.String() != "|012345" {
+		t.Errorf("Body was not streamed (actual: %v)", response.Body.String())
+	}
+
+	for _, hideLength := range []bool{false, true} {
+
+		response := testRequest(server, "POST", "/stream", testBody("01234567890", hideLength), nil)
+
+		if response.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("Maximum body size was not enforced on streamed body")
+		}
+
+		if response.Body.String() != `{"message":"Request body too large","success":false}` {
+			t.Errorf("Incorrect body (actual: %v)", response.Body.String())
+		}
+
+	}
+
+}
+
+// TestBodyNotReadWithoutRoute tests that bodies are not read for requests that
+// do not match a route
+func TestBodyNotReadWithoutRoute(t *testing.T) {
+
+	body := strings.NewReader("0123456789")
+	response := testRequest(testBodyServer(), "POST", "/404", body, nil)
+
+	if response.Code != http.StatusNotFound || body.Len() != 10 {
+		t.Errorf("Body was read for a request without a route")
+	}
+
+}
@@ -0,0 +1,495 @@
+package jsonserver
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// CBORCodec encodes and decodes CBOR (RFC 8949). Values are converted by way
+// of JSON, so they honour the same struct tags as JSON, and []byte values are
+// encoded as base64 strings (while byte strings in request bodies can be
+// decoded into []byte fields). Tags in request bodies are ignored in favour of
+// the values they wrap
+type CBORCodec struct{}
+
+// CBOR major types
+const (
+	cborUnsigned byte = iota
+	cborNegative
+	cborBytes
+	cborText
+	cborArray
+	cborMap
+	cborTag
+	cborSimple
+)
+
+// cborIndefinite is the additional information for indefinite lengths
+const cborIndefinite = 31
+
+// errCBORTruncated is returned when CBOR ends part way through a value
+var errCBORTruncated = errors.New("cbor: unexpected end of data")
+
+// errCBORBreak is returned when a break code is found, which is only valid at
+// the end of an item with an indefinite length
+var errCBORBreak = errors.New("cbor: unexpected break")
+
+// ContentType is the Content-Type header sent with CBOR responses
+func (codec CBORCodec) ContentType() string {
+
+	return "application/cbor"
+
+}
+
+// MediaTypes lists the media types of CBOR
+func (codec CBORCodec) MediaTypes() []string {
+
+	return []string{"application/cbor"}
+
+}
+
+// Encode encodes a value as CBOR
+func (codec CBORCodec) Encode(value interface{}) ([]byte, error) {
+
+	tree, err := toTree(value)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return appendCBOR([]byte{}, tree), nil
+
+}
+
+// Decode decodes CBOR into a value
+func (codec CBORCodec) Decode(body []byte, value interface{}) error {
+
+	decoder := cborDecoder{data: body}
+	tree, err := decoder.decode(0)
+
+	if err != nil {
+		return err
+	}
+
+	if decoder.offset != len(body) {
+		return errors.New("cbor: unexpected data after value")
+	}
+
+	return fromTree(tree, value)
+
+}
+
+// appendCBOR appends the CBOR encoding of a tree to a buffer
+func appendCBOR(buffer []byte, tree interface{}) []byte {
+
+	switch node := tree.(type) {
+
+	case nil:
+
+		return append(buffer, cborSimple<<5|22)
+
+	case bool:
+
+		if node {
+			return append(buffer, cborSimple<<5|21)
+		}
+
+		return append(buffer, cborSimple<<5|20)
+
+	case int64:
+
+		if node < 0 {
+			return appendCBORHead(buffer, cborNegative, uint64(-(node + 1)))
+		}
+
+		return appendCBORHead(buffer, cborUnsigned, uint64(node))
+
+	case uint64:
+
+		return appendCBORHead(buffer, cborUnsigned, node)
+
+	case float64:
+
+		return binary.BigEndian.AppendUint64(append(buffer, cborSimple<<5|27), math.Float64bits(node))
+
+	case string:
+
+		return append(appendCBORHead(buffer, cborText, uint64(len(node))), node...)
+
+	case []interface{}:
+
+		buffer = appendCBORHead(buffer, cborArray, uint64(len(node)))
+
+		for _, value := range node {
+			buffer = appendCBOR(buffer, value)
+		}
+
+		return buffer
+
+	case map[string]interface{}:
+
+		buffer = appendCBORHead(buffer, cborMap, uint64(len(node)))
+
+		for _, key := range sortedKeys(node) {
+			buffer = appendCBOR(buffer, key)
+			buffer = appendCBOR(buffer, node[key])
+		}
+
+		return buffer
+
+	}
+
+	panic(fmt.Sprintf("cbor: cannot encode %T", tree))
+
+}
+
+// appendCBORHead appends the initial byte of an item, along with its argument
+// in the fewest bytes possible
+func appendCBORHead(buffer []byte, majorType byte, argument uint64) []byte {
+
+	switch {
+	case argument < 24:
+		return append(buffer, majorType<<5|byte(argument))
+	case argument <= math.MaxUint8:
+		return append(buffer, majorType<<5|24, byte(argument))
+	case argument <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(buffer, majorType<<5|25), uint16(argument))
+	case argument <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(buffer, majorType<<5|26), uint32(argument))
+	}
+
+	return binary.BigEndian.AppendUint64(append(buffer, majorType<<5|27), argument)
+
+}
+
+// cborDecoder decodes CBOR into a tree
+type cborDecoder struct {
+	data   []byte
+	offset int
+}
+
+// decode decodes the next item, where depth guards against deeply nested data
+// exhausting the stack
+func (decoder *cborDecoder) decode(depth int) (interface{}, error) {
+
+	if depth > maxDecodeDepth {
+		return nil, errors.New("cbor: data is nested too deeply")
+	}
+
+	initial, err := decoder.read(1)
+
+	if err != nil {
+		return nil, err
+	}
+
+	majorType := initial[0] >> 5
+	additional := initial[0] & 0x1f
+
+	// Floats and simple values use the additional information differently
+	if majorType == cborSimple {
+		return decoder.decodeSimple(additional)
+	}
+
+	if additional == cborIndefinite {
+		return decoder.decodeIndefinite(majorType, depth)
+	}
+
+	argument, err := decoder.readArgument(additional)
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch majorType {
+
+	case cborUnsigned:
+
+		return argument, nil
+
+	case cborNegative:
+
+		if argument > math.MaxInt64 {
+			return -1 - float64(argument), nil
+		}
+
+		return -1 - int64(argument), nil
+
+	case cborBytes:
+
+		data, err := decoder.readLength(argument)
+
+		return append([]byte{}, data...), err
+
+	case cborText:
+
+		data, err := decoder.readLength(argument)
+
+		return string(data), err
+
+	case cborArray:
+
+		// Every element takes at least a byte, so the length can be checked
+		// before allocating anything
+		if argument > uint64(len(decoder.data)-decoder.offset) {
+			return nil, errCBORTruncated
+		}
+
+		array := make([]interface{}, argument)
+
+		for i := range array {
+
+			if array[i], err = decoder.decode(depth + 1); err != nil {
+				return nil, err
+			}
+
+		}
+
+		return array, nil
+
+	case cborMap:
+
+		if argument > uint64(len(decoder.data)-decoder.offset) {
+			return nil, errCBORTruncated
+		}
+
+		node := make(map[string]interface{}, argument)
+
+		for i := uint64(0); i < argument; i++ {
+
+			if err := decoder.decodeEntry(node, depth); err != nil {
+				return nil, err
+			}
+
+		}
+
+		return node, nil
+
+	}
+
+	// The content of a tag is used in place of the tag
+	return decoder.decode(depth + 1)
+
+}
+
+// decodeIndefinite decodes an item with an indefinite length, which continues
+// until a break code
+func (decoder *cborDecoder) decodeIndefinite(majorType byte, depth int) (interface{}, error) {
+
+	switch majorType {
+
+	case cborBytes, cborText:
+
+		data := []byte{}
+
+		for !decoder.atBreak() {
+
+			chunk, err := decoder.decode(depth + 1)
+
+			if err != nil {
+				return nil, err
+			}
+
+			switch value := chunk.(type) {
+			case []byte:
+				data = append(data, value...)
+			case string:
+				data = append(data, value...)
+			default:
+				return nil, errors.New("cbor: invalid chunk in indefinite length string")
+			}
+
+		}
+
+		if majorType == cborText {
+			return string(data), nil
+		}
+
+		return data, nil
+
+	case cborArray:
+
+		array := []interface{}{}
+
+		for !decoder.atBreak() {
+
+			value, err := decoder.decode(depth + 1)
+
+			if err != nil {
+				return nil, err
+			}
+
+			array = append(array, value)
+
+		}
+
+		return array, nil
+
+	case cborMap:
+
+		node := map[string]interface{}{}
+
+		for !decoder.atBreak() {
+
+			if err := decoder.decodeEntry(node, depth); err != nil {
+				return nil, err
+			}
+
+		}
+
+		return node, nil
+
+	}
+
+	return nil, errors.New("cbor: invalid indefinite length")
+
+}
+
+// decodeEntry decodes a map entry into a map, converting scalar keys to strings
+func (decoder *cborDecoder) decodeEntry(node map[string]interface{}, depth int) error {
+
+	key, err := decoder.decode(depth + 1)
+
+	if err != nil {
+		return err
+	}
+
+	value, err := decoder.decode(depth + 1)
+
+	if err != nil {
+		return err
+	}
+
+	stringKey, err := treeKey(key)
+
+	if err != nil {
+		return err
+	}
+
+	node[stringKey] = value
+
+	return nil
+
+}
+
+// decodeSimple decodes a float or simple value
+func (decoder *cborDecoder) decodeSimple(additional byte) (interface{}, error) {
+
+	switch additional {
+
+	case 20:
+		return false, nil
+	case 21:
+		return true, nil
+	case 22, 23:
+		return nil, nil
+	case 25:
+		bits, err := decoder.readArgument(additional)
+		return halfToFloat(uint16(bits)), err
+	case 26:
+		bits, err := decoder.readArgument(additional)
+		return float64(math.Float32frombits(uint32(bits))), err
+	case 27:
+		bits, err := decoder.readArgument(additional)
+		return math.Float64frombits(bits), err
+	case cborIndefinite:
+		return nil, errCBORBreak
+
+	}
+
+	return nil, fmt.Errorf("cbor: unsupported simple value %v", additional)
+
+}
+
+// readArgument reads the argument of an item from its additional information
+func (decoder *cborDecoder) readArgument(additional byte) (uint64, error) {
+
+	if additional < 24 {
+		return uint64(additional), nil
+	}
+
+	if additional > 27 {
+		return 0, fmt.Errorf("cbor: invalid additional information %v", additional)
+	}
+
+	data, err := decoder.read(1 << (additional - 24))
+
+	if err != nil {
+		return 0, err
+	}
+
+	argument := uint64(0)
+
+	for _, b := range data {
+		argument = argument<<8 | uint64(b)
+	}
+
+	return argument, nil
+
+}
+
+// atBreak checks for a break code, consuming it if there is one
+func (decoder *cborDecoder) atBreak() bool {
+
+	if decoder.offset < len(decoder.data) && decoder.data[decoder.offset] == 0xff {
+		decoder.offset++
+		return true
+	}
+
+	// Running out of data is reported when the next item is read
+	return false
+
+}
+
+// readLength reads a given number of bytes, where the number comes from the
+// data itself
+func (decoder *cborDecoder) readLength(length uint64) ([]byte, error) {
+
+	if length > uint64(len(decoder.data)-decoder.offset) {
+		return nil, errCBORTruncated
+	}
+
+	return decoder.read(int(length))
+
+}
+
+// read reads a given number of bytes
+func (decoder *cborDecoder) read(size int) ([]byte, error) {
+
+	if size > len(decoder.data)-decoder.offset {
+		return nil, errCBORTruncated
+	}
+
+	data := decoder.data[decoder.offset : decoder.offset+size]
+	decoder.offset += size
+
+	return data, nil
+
+}
+
+// halfToFloat converts a half-precision float into a float64
+func halfToFloat(bits uint16) float64 {
+
+	sign := 1.0
+
+	if bits&0x8000 != 0 {
+		sign = -1
+	}
+
+	exponent := int(bits>>10) & 0x1f
+	mantissa := float64(bits & 0x3ff)
+
+	switch exponent {
+	case 0:
+		return sign * math.Ldexp(mantissa, -24)
+	case 0x1f:
+		if mantissa == 0 {
+			return math.Inf(int(sign))
+		}
+		return math.NaN()
+	}
+
+	return sign * math.Ldexp(mantissa+1024, exponent-25)
+
+}
@@ -0,0 +1,126 @@
+package jsonserver
+
+import (
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+// TestCBOREncode tests encoding values as CBOR
+func TestCBOREncode(t *testing.T) {
+
+	values := map[string]interface{}{
+		"00":                 0,
+		"17":                 23,
+		"1818":               24,
+		"1903e8":             1000,
+		"1a000f4240":         1000000,
+		"1bffffffffffffffff": uint64(18446744073709551615),
+		"20":                 -1,
+		"3903e7":             -1000,
+		"fb3ff8000000000000": 1.5,
+		"f4":                 false,
+		"f6":                 nil,
+		"6161":               "a",
+		"83010203":           []int{1, 2, 3},
+		"a26161016162820203": JSON{"a": 1, "b": []int{2, 3}},
+	}
+
+	for expected, value := range values {
+
+		encoded, err := CBORCodec{}.Encode(value)
+
+		if err != nil || hex.EncodeToString(encoded) != expected {
+			t.Errorf("Incorrect CBOR for %v (expected: %v, actual: %x, error: %v)", value, expected, encoded, err)
+		}
+
+	}
+
+}
+
+// TestCBORDecode tests decoding CBOR, including the examples from RFC 8949
+func TestCBORDecode(t *testing.T) {
+
+	bodies := map[string]interface{}{
+		"f93c00":             1.0,
+		"f97bff":             65504.0,
+		"f90001":             5.960464477539063e-08,
+		"fa47c35000":         100000.0,
+		"3bffffffffffffffff": -18446744073709551616.0,
+		"f5":                 true,
+		"f7":                 nil,
+		"c074323031332d30332d32315432303a30343a30305a": "2013-03-21T20:04:00Z",
+		"c11a514b67b0":               1363896240.0,
+		"9f018202039f0405ffff":       []interface{}{1.0, []interface{}{2.0, 3.0}, []interface{}{4.0, 5.0}},
+		"7f657374726561646d696e67ff": "streaming",
+		"bf61610161629f0203ffff":     map[string]interface{}{"a": 1.0, "b": []interface{}{2.0, 3.0}},
+		"a201020304":                 map[string]interface{}{"1": 2.0, "3": 4.0},
+		"5f42010243030405ff":         "AQIDBAU=",
+	}
+
+	for body, expected := range bodies {
+
+		data, _ := hex.DecodeString(body)
+		var decoded interface{}
+
+		if err := (CBORCodec{}).Decode(data, &decoded); err != nil || !reflect.DeepEqual(decoded, expected) {
+			t.Errorf("Incorrect value for %v (expected: %#v, actual: %#v, error: %v)", body, expected, decoded, err)
+		}
+
+	}
+
+}
+
+// TestCBORRoundTrip tests that encoded values decode back to the same value
+func TestCBORRoundTrip(t *testing.T) {
+
+	value := map[string]interface{}{
+		"integers": []interface{}{0.0, -24.0, -25.0, 65536.0, -5e9},
+		"floats":   []interface{}{0.1, -1e100},
+		"strings":  []interface{}{"", "ünïcödé"},
+		"nested":   map[string]interface{}{"list": make([]interface{}, 30), "map": map[string]interface{}{}},
+	}
+
+	encoded, err := CBORCodec{}.Encode(value)
+
+	if err != nil {
+		t.Fatalf("Unexpected error encoding CBOR: %v", err)
+	}
+
+	decoded := map[string]interface{}{}
+
+	if err := (CBORCodec{}).Decode(encoded, &decoded); err != nil || !reflect.DeepEqual(decoded, value) {
+		t.Errorf("CBOR did not round trip (error: %v)", err)
+	}
+
+}
+
+// TestCBORDecodeErrors tests that malformed CBOR is rejected
+func TestCBORDecodeErrors(t *testing.T) {
+
+	bodies := []string{
+		"",
+		"1a0102",
+		"6461",
+		"9f01",
+		"ff",
+		"1c",
+		"f8",
+		"9bffffffffffffffff",
+		"5f01ff",
+		"a1f6f6",
+		"0101",
+	}
+
+	for _, body := range bodies {
+
+		data, _ := hex.DecodeString(body)
+		var decoded interface{}
+
+		if err := (CBORCodec{}).Decode(data, &decoded); err == nil {
+			t.Errorf("Malformed CBOR %v was decoded as %v", body, decoded)
+		}
+
+	}
+
+}
@@ -0,0 +1,444 @@
+package jsonserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Codec encodes response values into, and decodes request bodies from, a
+// particular format
+type Codec interface {
+
+	// ContentType is the Content-Type header sent with encoded responses
+	ContentType() string
+
+	// MediaTypes lists the media types that the codec handles
+	MediaTypes() []string
+
+	// Encode encodes a value
+	Encode(value interface{}) ([]byte, error)
+
+	// Decode decodes a body into a value
+	Decode(body []byte, value interface{}) error
+}
+
+// JSONCodec encodes and decodes JSON, and is used when no other codec is
+// negotiated
+type JSONCodec struct{}
+
+// ErrNotAcceptable is returned when none of the server's codecs can produce a
+// response in a format that the client accepts
+var ErrNotAcceptable = errors.New("Response format not acceptable")
+
+// ErrUnsupportedMediaType is returned when none of the server's codecs can
+// decode a request body's format
+var ErrUnsupportedMediaType = errors.New("Request body format not supported")
+
+// maxDecodeDepth is the deepest that values decoded by codecs other than JSON
+// can be nested
+const maxDecodeDepth = 10000
+
+// errMalformedBody is returned when a request body cannot be decoded by a
+// codec other than JSON
+var errMalformedBody = errors.New("Request body could not be decoded")
+
+// ContentType is the Content-Type header sent with JSON responses
+func (codec JSONCodec) ContentType() string {
+
+	return "application/json; charset=UTF-8"
+
+}
+
+// MediaTypes lists the media types of JSON
+func (codec JSONCodec) MediaTypes() []string {
+
+	return []string{"application/json"}
+
+}
+
+// Encode encodes a value as JSON
+func (codec JSONCodec) Encode(value interface{}) ([]byte, error) {
+
+	return json.Marshal(value)
+
+}
+
+// Decode decodes JSON into a value
+func (codec JSONCodec) Decode(body []byte, value interface{}) error {
+
+	return json.Unmarshal(body, value)
+
+}
+
+// RegisterCodec adds codecs that responses and request bodies can be
+// negotiated between, which should be done before the server starts. Once a
+// codec has been registered, Respond picks the format of responses from the
+// Accept header and Decode (along with routes registered by
+// RegisterJSONRoute) picks the format of request bodies from the Content-Type
+// header; JSON remains available and is used when the client has no
+// preference
+func (server *Server) RegisterCodec(codecs ...Codec) {
+
+	server.codecs = append(server.codecs, codecs...)
+
+}
+
+// availableCodecs lists the codecs that can be negotiated between, with the
+// codec used for JSON first
+func (server *Server) availableCodecs() []Codec {
+
+	var jsonCodec Codec = JSONCodec{}
+	others := []Codec{}
+
+	if server != nil {
+
+		for _, codec := range server.codecs {
+
+			if handlesMediaType(codec, "application/json") {
+				jsonCodec = codec
+			} else {
+				others = append(others, codec)
+			}
+
+		}
+
+	}
+
+	return append([]Codec{jsonCodec}, others...)
+
+}
+
+// responseCodec picks the codec to encode a response with, from the media
+// ranges in an Accept header, preferring JSON when several are equally
+// acceptable
+func (server *Server) responseCodec(accept string) Codec {
+
+	codecs := server.availableCodecs()
+
+	if server == nil || len(server.codecs) == 0 || strings.TrimSpace(accept) == "" {
+		return codecs[0]
+	}
+
+	mediaRanges := parseAccept(accept)
+
+	var bestCodec Codec
+	bestQuality := 0.0
+
+	for _, codec := range codecs {
+
+		for _, mediaType := range codec.MediaTypes() {
+
+			if quality := acceptQuality(mediaRanges, mediaType); quality > bestQuality {
+				bestCodec = codec
+				bestQuality = quality
+			}
+
+		}
+
+	}
+
+	return bestCodec
+
+}
+
+// requestCodec picks the codec to decode a request body with from its
+// Content-Type header, treating bodies without one as JSON
+func (server *Server) requestCodec(contentType string) Codec {
+
+	codecs := server.availableCodecs()
+
+	if server == nil || len(server.codecs) == 0 || strings.TrimSpace(contentType) == "" {
+		return codecs[0]
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+
+	if err != nil {
+		return nil
+	}
+
+	// Structured syntax suffixes such as application/vnd.api+json are handled by
+	// the codec for the underlying format
+	candidates := []string{mediaType}
+
+	if _, suffix, ok := strings.Cut(mediaType, "+"); ok {
+		candidates = append(candidates, "application/"+suffix)
+	}
+
+	for _, candidate := range candidates {
+
+		for _, codec := range codecs {
+
+			if handlesMediaType(codec, candidate) {
+				return codec
+			}
+
+		}
+
+	}
+
+	return nil
+
+}
+
+// handlesMediaType checks whether a codec handles a media type
+func handlesMediaType(codec Codec, mediaType string) bool {
+
+	for _, codecMediaType := range codec.MediaTypes() {
+
+		if strings.EqualFold(codecMediaType, mediaType) {
+			return true
+		}
+
+	}
+
+	return false
+
+}
+
+// mediaRange is a media range from an Accept header along with its quality
+type mediaRange struct {
+	mediaType string
+	quality   float64
+}
+
+// parseAccept parses the media ranges in an Accept header, skipping any that
+// are malformed
+func parseAccept(accept string) []mediaRange {
+
+	mediaRanges := []mediaRange{}
+
+	for _, part := range strings.Split(accept, ",") {
+
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+
+		if err != nil {
+			continue
+		}
+
+		quality := 1.0
+
+		if q, ok := params["q"]; ok {
+
+			if quality, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+
+		}
+
+		mediaRanges = append(mediaRanges, mediaRange{mediaType: mediaType, quality: quality})
+
+	}
+
+	return mediaRanges
+
+}
+
+// acceptQuality finds the quality of a media type according to the most
+// specific media range that matches it
+func acceptQuality(mediaRanges []mediaRange, mediaType string) float64 {
+
+	mediaType = strings.ToLower(mediaType)
+	mainType, _, _ := strings.Cut(mediaType, "/")
+	quality := 0.0
+	specificity := 0
+
+	for _, mediaRange := range mediaRanges {
+
+		rangeSpecificity := 0
+
+		switch mediaRange.mediaType {
+		case mediaType:
+			rangeSpecificity = 3
+		case mainType + "/*":
+			rangeSpecificity = 2
+		case "*/*":
+			rangeSpecificity = 1
+		}
+
+		if rangeSpecificity > specificity {
+			quality = mediaRange.quality
+			specificity = rangeSpecificity
+		}
+
+	}
+
+	return quality
+
+}
+
+// Respond writes a value back to the client in the format negotiated from the
+// request's Accept header, using the codecs registered with the server
+// handling the request. If no codec can produce an acceptable format a 406
+// response is sent and ErrNotAcceptable returned, and if the value cannot be
+// encoded a 500 response is sent and the encoding error returned
+func Respond(ctx context.Context, request *http.Request, response http.ResponseWriter, statusCode int, value interface{}) error {
+
+	server := serverFromContext(ctx)
+	codec := server.responseCodec(request.Header.Get("Accept"))
+
+	if len(server.availableCodecs()) > 1 {
+		response.Header().Add("Vary", "Accept")
+	}
+
+	if codec == nil {
+		server.renderError(request, response, ErrorNotAcceptable, http.StatusNotAcceptable, ErrNotAcceptable)
+		return ErrNotAcceptable
+	}
+
+	body, err := codec.Encode(value)
+
+	if err != nil {
+		server.renderError(request, response, ErrorInternal, http.StatusInternalServerError, err)
+		return err
+	}
+
+	response.Header().Set("Content-Type", codec.ContentType())
+	response.WriteHeader(statusCode)
+
+	_, err = response.Write(body)
+
+	return err
+
+}
+
+// Decode decodes a request body into a value and validates it, in the format
+// negotiated from the request's Content-Type header using the codecs
+// registered with the server handling the request. ErrUnsupportedMediaType is
+// returned if no codec can decode the body, and ValidationErrors if any fields
+// are invalid; either can be passed to WriteValidationError
+func Decode(ctx context.Context, request *http.Request, body []byte, value interface{}) error {
+
+	return decodeBody(ctx, request, body, value, DecodeOptions{})
+
+}
+
+// decodeBody decodes and validates a request body in the negotiated format.
+// Bodies in formats other than JSON are converted to JSON first, so that they
+// are decoded according to the same struct tags and options
+func decodeBody(ctx context.Context, request *http.Request, body []byte, value interface{}, options DecodeOptions) error {
+
+	codec := serverFromContext(ctx).requestCodec(request.Header.Get("Content-Type"))
+
+	if codec == nil {
+		return ErrUnsupportedMediaType
+	}
+
+	if handlesMediaType(codec, "application/json") {
+		return DecodeJSON(body, value, options)
+	}
+
+	var tree interface{}
+
+	if err := codec.Decode(body, &tree); err != nil {
+		return errMalformedBody
+	}
+
+	jsonBody, err := json.Marshal(tree)
+
+	if err != nil {
+		return errMalformedBody
+	}
+
+	return DecodeJSON(jsonBody, value, options)
+
+}
+
+// toTree converts a value into a tree of maps, slices, strings, numbers,
+// booleans and nils by way of JSON, so that codecs for other formats honour
+// the same struct tags and marshalers as JSON. Numbers are int64 where they
+// are whole and fit, then uint64, and otherwise float64
+func toTree(value interface{}) (interface{}, error) {
+
+	jsonBody, err := json.Marshal(value)
+
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(jsonBody))
+	decoder.UseNumber()
+
+	var tree interface{}
+
+	if err := decoder.Decode(&tree); err != nil {
+		return nil, err
+	}
+
+	return convertNumbers(tree), nil
+
+}
+
+// convertNumbers replaces the json.Number values within a tree
+func convertNumbers(tree interface{}) interface{} {
+
+	switch node := tree.(type) {
+
+	case map[string]interface{}:
+
+		for key, value := range node {
+			node[key] = convertNumbers(value)
+		}
+
+	case []interface{}:
+
+		for i, value := range node {
+			node[i] = convertNumbers(value)
+		}
+
+	case json.Number:
+
+		if integer, err := strconv.ParseInt(string(node), 10, 64); err == nil {
+			return integer
+		}
+
+		if integer, err := strconv.ParseUint(string(node), 10, 64); err == nil {
+			return integer
+		}
+
+		float, _ := node.Float64()
+
+		return float
+
+	}
+
+	return tree
+
+}
+
+// fromTree converts a decoded tree into a value by way of JSON, so that codecs
+// for other formats honour the same struct tags and unmarshalers as JSON
+func fromTree(tree interface{}, value interface{}) error {
+
+	jsonBody, err := json.Marshal(tree)
+
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(jsonBody, value)
+
+}
+
+// sortedKeys lists the keys of a map in order, so that encoded maps are
+// deterministic
+func sortedKeys(node map[string]interface{}) []string {
+
+	keys := make([]string, 0, len(node))
+
+	for key := range node {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+
+}
@@ -0,0 +1,218 @@
+package jsonserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// testCodecServer creates a server that negotiates between codecs
+func testCodecServer(codecs ...Codec) *Server {
+
+	server := NewServer()
+	server.RegisterCodec(codecs...)
+
+	server.RegisterRoute("GET", "/products", []Middleware{}, func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) {
+		Respond(ctx, request, response, http.StatusOK, []JSON{{"name": "Chair"}})
+	})
+
+	server.RegisterRoute("POST", "/echo", []Middleware{}, func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) {
+
+		product := testProduct{}
+
+		if err := Decode(ctx, request, *body, &product); err != nil {
+			WriteValidationError(ctx, request, response, err)
+			return
+		}
+
+		Respond(ctx, request, response, http.StatusOK, product)
+
+	})
+
+	RegisterJSONRoute(server, "POST", "/products", []Middleware{}, func(ctx context.Context, request *http.Request, response http.ResponseWriter, product *testProduct) {
+		WriteResponse(response, &JSON{"name": product.Name}, http.StatusCreated)
+	}, WithStrictJSON())
+
+	return server
+
+}
+
+// TestRespondNegotiatesFormat tests that responses are encoded in the format
+// that the client prefers
+func TestRespondNegotiatesFormat(t *testing.T) {
+
+	server := testCodecServer(MessagePackCodec{}, CBORCodec{}, YAMLCodec{})
+
+	tests := []struct {
+		accept      string
+		contentType string
+		body        string
+	}{
+		{"", "application/json; charset=UTF-8", `[{"name":"Chair"}]`},
+		{"*/*", "application/json; charset=UTF-8", `[{"name":"Chair"}]`},
+		{"application/msgpack", "application/msgpack", "\x91\x81\xa4name\xa5Chair"},
+		{"application/cbor, application/json;q=0.5", "application/cbor", "\x81\xa1\x64name\x65Chair"},
+		{"application/json;q=0.1, text/*", "application/yaml", "- name: Chair\n"},
+		{"text/html, */*;q=0.1", "application/json; charset=UTF-8", `[{"name":"Chair"}]`},
+		{"application/*", "application/json; charset=UTF-8", `[{"name":"Chair"}]`},
+		{"application/cbor;q=0, application/x-msgpack", "application/msgpack", "\x91\x81\xa4name\xa5Chair"},
+	}
+
+	for _, test := range tests {
+
+		response := testRequest(server, "GET", "/products", nil, map[string]string{"Accept": test.accept})
+
+		if response.Code != http.StatusOK || response.Header().Get("Content-Type") != test.contentType || response.Body.String() != test.body {
+			t.Errorf("Incorrect response for Accept %q (status code: %v, content type: %v, body: %q)", test.accept, response.Code, response.Header().Get("Content-Type"), response.Body.String())
+		}
+
+		if response.Header().Get("Vary") != "Accept" {
+			t.Errorf("Vary header was not sent for Accept %q", test.accept)
+		}
+
+	}
+
+}
+
+// TestRespondNotAcceptable tests that a 406 response is sent when no codec
+// produces an acceptable format
+func TestRespondNotAcceptable(t *testing.T) {
+
+	response := testRequest(testCodecServer(MessagePackCodec{}), "GET", "/products", nil, map[string]string{"Accept": "text/html, application/json;q=0"})
+
+	if response.Code != http.StatusNotAcceptable || response.Body.String() != `{"message":"Response format not acceptable","success":false}` {
+		t.Errorf("Incorrect response (status code: %v, body: %v)", response.Code, response.Body.String())
+	}
+
+}
+
+// TestRespondEncodingError tests that a value that cannot be encoded results
+// in a 500 response from the server's error renderer
+func TestRespondEncodingError(t *testing.T) {
+
+	server := testCodecServer()
+	server.ProblemDetails = true
+
+	server.RegisterRoute("GET", "/invalid", []Middleware{}, func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) {
+
+		if Respond(ctx, request, response, http.StatusOK, JSON{"channel": make(chan int)}) == nil {
+			t.Errorf("Encoding error was not returned")
+		}
+
+	})
+
+	response := testRequest(server, "GET", "/invalid", nil, nil)
+	expected := `{"detail":"Internal server error","instance":"/invalid","status":500,"title":"Internal Server Error","type":"about:blank"}`
+
+	if response.Code != http.StatusInternalServerError || response.Header().Get("Content-Type") != problemContentType || response.Body.String() != expected {
+		t.Errorf("Incorrect response (status code: %v, content type: %v, body: %v)", response.Code, response.Header().Get("Content-Type"), response.Body.String())
+	}
+
+}
+
+// TestRespondWithoutCodecs tests that JSON is always used when no codecs are
+// registered
+func TestRespondWithoutCodecs(t *testing.T) {
+
+	response := testRequest(testCodecServer(), "GET", "/products", nil, map[string]string{"Accept": "text/html"})
+
+	if response.Code != http.StatusOK || response.Body.String() != `[{"name":"Chair"}]` || response.Header().Get("Vary") != "" {
+		t.Errorf("Incorrect response (status code: %v, body: %v)", response.Code, response.Body.String())
+	}
+
+	response = testRequest(testCodecServer(), "POST", "/products", strings.NewReader(`{"name":"Chair"}`), map[string]string{"Content-Type": "text/plain"})
+
+	if response.Code != http.StatusCreated {
+		t.Errorf("Body was not decoded as JSON (status code: %v, body: %v)", response.Code, response.Body.String())
+	}
+
+}
+
+// TestDecodeNegotiatesFormat tests that request bodies are decoded according
+// to their content type
+func TestDecodeNegotiatesFormat(t *testing.T) {
+
+	server := testCodecServer(MessagePackCodec{}, CBORCodec{}, YAMLCodec{})
+	msgpack, _ := hex.DecodeString("82a46e616d65a54368616972a57072696365cb4004000000000000")
+	cbor, _ := hex.DecodeString("a2646e616d65654368616972657072696365fb4004000000000000")
+
+	bodies := map[string][]byte{
+		"":                         []byte(`{"name":"Chair","price":2.5}`),
+		"application/vnd.api+json": []byte(`{"name":"Chair","price":2.5}`),
+		"application/x-msgpack":    msgpack,
+		"application/cbor":         cbor,
+		"text/yaml; charset=utf-8": []byte("name: Chair\nprice: 2.5\n"),
+	}
+
+	for contentType, body := range bodies {
+
+		response := testRequest(server, "POST", "/echo", bytes.NewReader(body), map[string]string{"Accept": "application/json", "Content-Type": contentType})
+
+		if response.Code != http.StatusOK || response.Body.String() != `{"name":"Chair","price":2.5,"meta":null}` {
+			t.Errorf("Incorrect response for %q (status code: %v, body: %v)", contentType, response.Code, response.Body.String())
+		}
+
+	}
+
+}
+
+// TestDecodeRejectsBodies tests that bodies in unsupported formats receive a
+// 415 response, and that malformed or invalid bodies receive a 400 response
+func TestDecodeRejectsBodies(t *testing.T) {
+
+	server := testCodecServer(YAMLCodec{})
+
+	tests := []struct {
+		path        string
+		contentType string
+		body        string
+		status      int
+		expected    string
+	}{
+		{"/echo", "text/plain", "name: Chair", 415, `{"message":"Request body format not supported","success":false}`},
+		{"/products", "application/xml", "<product/>", 415, `{"message":"Request body format not supported","success":false}`},
+		{"/products", "not a media type", "", 415, `{"message":"Request body format not supported","success":false}`},
+		{"/products", "application/yaml", "name: [Chair", 400, `{"message":"Request body could not be decoded","success":false}`},
+		{"/products", "application/yaml", "price: -1\n", 400, `{"errors":[{"field":"name","rule":"required","message":"is required"},{"field":"price","rule":"min","message":"must be at least 0"}],"message":"Request body is invalid","success":false}`},
+		{"/products", "application/yaml", "name: Chair\ncolour: red\n", 400, `{"errors":[{"field":"colour","rule":"unknown","message":"is not allowed"}],"message":"Request body is invalid","success":false}`},
+	}
+
+	for _, test := range tests {
+
+		response := testRequest(server, "POST", test.path, strings.NewReader(test.body), map[string]string{"Content-Type": test.contentType})
+
+		if response.Code != test.status || response.Body.String() != test.expected {
+			t.Errorf("Incorrect response for %q to %v (status code: %v, body: %v)", test.contentType, test.path, response.Code, response.Body.String())
+		}
+
+	}
+
+}
+
+// TestRegisterCodecReplacesJSON tests that a registered JSON codec is used in
+// place of the built-in one
+func TestRegisterCodecReplacesJSON(t *testing.T) {
+
+	response := testRequest(testCodecServer(testIndentedJSONCodec{}), "GET", "/products", nil, nil)
+
+	if !strings.Contains(response.Body.String(), "\n") {
+		t.Errorf("Registered JSON codec was not used (body: %v)", response.Body.String())
+	}
+
+}
+
+// testIndentedJSONCodec is a JSON codec that indents its output
+type testIndentedJSONCodec struct {
+	JSONCodec
+}
+
+// Encode encodes a value as indented JSON
+func (codec testIndentedJSONCodec) Encode(value interface{}) ([]byte, error) {
+
+	return json.MarshalIndent(value, "", "  ")
+
+}
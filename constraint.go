@@ -0,0 +1,340 @@
+package jsonserver
+
+import (
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// paramConstraint restricts the values that a route wildcard will match
+type paramConstraint struct {
+	source  string
+	matches func(value string) bool
+}
+
+// uuidPattern matches UUIDs in their canonical textual form
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// builtInConstraints are the named constraints that can be used in place of a
+// regular expression
+var builtInConstraints = map[string]func(value string) bool{
+	"int": func(value string) bool {
+		_, err := strconv.ParseInt(value, 10, 64)
+		return err == nil
+	},
+	"float": func(value string) bool {
+		_, err := strconv.ParseFloat(value, 64)
+		return err == nil
+	},
+	"uuid": func(value string) bool {
+		return uuidPattern.MatchString(value)
+	},
+	"date": func(value string) bool {
+		_, err := time.Parse(dateLayout, value)
+		return err == nil
+	},
+}
+
+// builtInConstraintPatterns are regular expressions accepting (at least) the
+// values accepted by the built-in constraints, used to tell whether they
+// overlap with other constraints
+var builtInConstraintPatterns = map[string]string{
+	"int":   `[-+]?[0-9]+`,
+	"float": `[-+]?(?:[0-9_]+\.?[0-9_]*|\.[0-9_]+|0[xX][0-9a-fA-F_.]+[pP][-+]?[0-9]+)(?:[eE][-+]?[0-9]+)?|(?i:[-+]?(?:inf|infinity|nan))`,
+	"uuid":  `[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`,
+	"date":  `[0-9]{4}-[0-9]{2}-[0-9]{2}`,
+}
+
+// constraintCache holds compiled constraints keyed by their source, so that
+// each is only compiled once
+var constraintCache sync.Map
+
+// parseWildcard splits a route path fragment in the form {name} or
+// {name:constraint} into its name and constraint, reporting whether the
+// fragment is a wildcard at all
+func parseWildcard(routePathFragment string) (string, string, bool) {
+
+	if !strings.HasPrefix(routePathFragment, "{") || !strings.HasSuffix(routePathFragment, "}") {
+		return "", "", false
+	}
+
+	wildcard := routePathFragment[1 : len(routePathFragment)-1]
+
+	if separator := strings.Index(wildcard, ":"); separator != -1 {
+		return wildcard[:separator], wildcard[separator+1:], true
+	}
+
+	return wildcard, "", true
+
+}
+
+// validateConstraints checks that every constraint in a route path can be
+// compiled
+func validateConstraints(path string) error {
+
+	for _, routePathFragment := range strings.Split(normalisePath(path), "/") {
+
+		if _, constraintSource, isWildcard := parseWildcard(routePathFragment); isWildcard {
+
+			if _, err := compileConstraint(constraintSource); err != nil {
+				return fmt.Errorf("invalid constraint in route %v: %w", path, err)
+			}
+
+		}
+
+	}
+
+	return nil
+
+}
+
+// compileConstraint turns a constraint's source into a constraint, which will
+// be nil if the source is empty. Sources other than the built-in constraint
+// names are treated as regular expressions that must match the whole value
+func compileConstraint(source string) (*paramConstraint, error) {
+
+	if source == "" {
+		return nil, nil
+	}
+
+	if constraint, ok := constraintCache.Load(source); ok {
+		return constraint.(*paramConstraint), nil
+	}
+
+	constraint := &paramConstraint{source: source}
+
+	if matches, ok := builtInConstraints[source]; ok {
+
+		constraint.matches = matches
+
+	} else {
+
+		pattern, err := regexp.Compile("^(?:" + source + ")$")
+
+		if err != nil {
+			return nil, err
+		}
+
+		constraint.matches = pattern.MatchString
+
+	}
+
+	constraintCache.Store(source, constraint)
+
+	return constraint, nil
+
+}
+
+// constraintsOverlap reports whether a value could satisfy two constraints at
+// once, by searching the product of their compiled regular expressions for a
+// shared match. Constraints that cannot be compiled are assumed to overlap
+func constraintsOverlap(first string, second string) bool {
+
+	if first == "" || second == "" || first == second {
+		return true
+	}
+
+	firstProgram, firstErr := constraintProgram(first)
+	secondProgram, secondErr := constraintProgram(second)
+
+	if firstErr != nil || secondErr != nil {
+		return true
+	}
+
+	type statePair struct {
+		first  uint32
+		second uint32
+	}
+
+	visited := map[statePair]bool{}
+	queue := []statePair{}
+
+	// Each pair of positions waiting to consume a rune is explored once,
+	// starting at the beginning of the value
+	enqueue := func(firstStates []uint32, secondStates []uint32) {
+
+		for _, firstState := range firstStates {
+
+			for _, secondState := range secondStates {
+
+				pair := statePair{firstState, secondState}
+
+				if !visited[pair] {
+					visited[pair] = true
+					queue = append(queue, pair)
+				}
+
+			}
+
+		}
+
+	}
+
+	// Path fragments are never empty, so matching the empty string does not
+	// count as an overlap
+	enqueue(programClosure(firstProgram, uint32(firstProgram.Start), true, false), programClosure(secondProgram, uint32(secondProgram.Start), true, false))
+
+	for len(queue) > 0 {
+
+		pair := queue[0]
+		queue = queue[1:]
+
+		firstInst := &firstProgram.Inst[pair.first]
+		secondInst := &secondProgram.Inst[pair.second]
+
+		if !runesOverlap(firstInst, secondInst) {
+			continue
+		}
+
+		if programMatches(firstProgram, firstInst.Out) && programMatches(secondProgram, secondInst.Out) {
+			return true
+		}
+
+		enqueue(programClosure(firstProgram, firstInst.Out, false, false), programClosure(secondProgram, secondInst.Out, false, false))
+
+	}
+
+	return false
+
+}
+
+// constraintProgram compiles a constraint into a program that matches whole
+// values
+func constraintProgram(source string) (*syntax.Prog, error) {
+
+	if pattern, ok := builtInConstraintPatterns[source]; ok {
+		source = pattern
+	}
+
+	parsed, err := syntax.Parse("^(?:"+source+")$", syntax.Perl)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return syntax.Compile(parsed.Simplify())
+
+}
+
+// programClosure lists the instructions that consume a rune which can be
+// reached from an instruction without consuming anything, where assertions
+// other than the start and end of the value are assumed to hold
+func programClosure(program *syntax.Prog, pc uint32, atStart bool, atEnd bool) []uint32 {
+
+	states := []uint32{}
+	visited := map[uint32]bool{}
+	stack := []uint32{pc}
+
+	for len(stack) > 0 {
+
+		pc = stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if visited[pc] {
+			continue
+		}
+
+		visited[pc] = true
+		inst := &program.Inst[pc]
+
+		switch inst.Op {
+
+		case syntax.InstAlt, syntax.InstAltMatch:
+
+			stack = append(stack, inst.Out, inst.Arg)
+
+		case syntax.InstCapture, syntax.InstNop:
+
+			stack = append(stack, inst.Out)
+
+		case syntax.InstEmptyWidth:
+
+			empty := syntax.EmptyOp(inst.Arg)
+
+			if (empty&(syntax.EmptyBeginText|syntax.EmptyBeginLine) != 0 && !atStart) || (empty&(syntax.EmptyEndText|syntax.EmptyEndLine) != 0 && !atEnd) {
+				continue
+			}
+
+			stack = append(stack, inst.Out)
+
+		case syntax.InstRune, syntax.InstRune1, syntax.InstRuneAny, syntax.InstRuneAnyNotNL, syntax.InstMatch:
+
+			states = append(states, pc)
+
+		}
+
+	}
+
+	return states
+
+}
+
+// programMatches checks whether a program can finish matching at the end of
+// the value from an instruction
+func programMatches(program *syntax.Prog, pc uint32) bool {
+
+	for _, state := range programClosure(program, pc, false, true) {
+
+		if program.Inst[state].Op == syntax.InstMatch {
+			return true
+		}
+
+	}
+
+	return false
+
+}
+
+// runesOverlap checks whether two instructions can consume the same rune. If
+// they can, the lowest such rune is the lower bound of one of their ranges (or
+// its case folded equivalent), so only those need to be tried
+func runesOverlap(first *syntax.Inst, second *syntax.Inst) bool {
+
+	candidates := []rune{'a'}
+
+	for _, inst := range []*syntax.Inst{first, second} {
+
+		for i := 0; i < len(inst.Rune); i += 2 {
+
+			candidates = append(candidates, inst.Rune[i])
+
+			for folded := unicode.SimpleFold(inst.Rune[i]); folded != inst.Rune[i]; folded = unicode.SimpleFold(folded) {
+				candidates = append(candidates, folded)
+			}
+
+		}
+
+	}
+
+	for _, candidate := range candidates {
+
+		if consumesRune(first, candidate) && consumesRune(second, candidate) {
+			return true
+		}
+
+	}
+
+	return false
+
+}
+
+// consumesRune checks whether an instruction consumes a rune
+func consumesRune(inst *syntax.Inst, candidate rune) bool {
+
+	switch inst.Op {
+	case syntax.InstRune, syntax.InstRune1:
+		return inst.MatchRune(candidate)
+	case syntax.InstRuneAny:
+		return true
+	case syntax.InstRuneAnyNotNL:
+		return candidate != '\n'
+	}
+
+	return false
+
+}
@@ -0,0 +1,119 @@
+package jsonserver
+
+import (
+	"testing"
+)
+
+// TestParseWildcard tests splitting route path fragments into wildcard names
+// and constraints
+func TestParseWildcard(t *testing.T) {
+
+	fragments := map[string][3]string{
+		"foo":                {"", "", "false"},
+		"{id}":               {"id", "", "true"},
+		"{id:int}":           {"id", "int", "true"},
+		"{slug:[a-z-]+}":     {"slug", "[a-z-]+", "true"},
+		"{code:[0-9]{3}}":    {"code", "[0-9]{3}", "true"},
+		"{time:[0-9:]+}":     {"time", "[0-9:]+", "true"},
+		"{unterminated":      {"", "", "false"},
+		"unterminated}":      {"", "", "false"},
+		"{with:colon:twice}": {"with", "colon:twice", "true"},
+	}
+
+	for fragment, expected := range fragments {
+
+		name, constraint, isWildcard := parseWildcard(fragment)
+
+		if name != expected[0] || constraint != expected[1] || (isWildcard && expected[2] != "true") || (!isWildcard && expected[2] != "false") {
+			t.Errorf("Wildcard parsing failure for %v (expected: %v, actual: [%v %v %v])", fragment, expected, name, constraint, isWildcard)
+		}
+
+	}
+
+}
+
+// TestCompileConstraint tests that built-in and regular expression constraints
+// match the expected values
+func TestCompileConstraint(t *testing.T) {
+
+	values := map[string]map[string]bool{
+		"int":     {"123": true, "-5": true, "12a": false, "": false},
+		"float":   {"1.5": true, "2": true, "x": false},
+		"uuid":    {"0b9f6a3c-1d2e-4f50-9a8b-7c6d5e4f3a2b": true, "0b9f6a3c": false},
+		"date":    {"2024-02-29": true, "2023-02-29": false, "yesterday": false},
+		"[a-z-]+": {"hello-world": true, "Hello": false, "a/b": false},
+	}
+
+	for source, cases := range values {
+
+		constraint, err := compileConstraint(source)
+
+		if err != nil {
+			t.Errorf("Unexpected error compiling constraint %v: %v", source, err)
+			continue
+		}
+
+		for value, expected := range cases {
+
+			if constraint.matches(value) != expected {
+				t.Errorf("Constraint %v mismatch for %v (expected: %v, actual: %v)", source, value, expected, !expected)
+			}
+
+		}
+
+	}
+
+	if constraint, err := compileConstraint(""); constraint != nil || err != nil {
+		t.Errorf("Empty constraint unexpectedly compiled")
+	}
+
+	if _, err := compileConstraint("[a-z"); err == nil {
+		t.Errorf("Invalid constraint unexpectedly compiled")
+	}
+
+}
+
+// TestValidateConstraints tests checking that a route path's constraints can
+// be compiled
+func TestValidateConstraints(t *testing.T) {
+
+	if err := validateConstraints("/products/{id:int}/{slug:[a-z-]+}/:"); err != nil {
+		t.Errorf("Unexpected error validating constraints: %v", err)
+	}
+
+	if err := validateConstraints("/products/{id:(}"); err == nil {
+		t.Errorf("Invalid constraint was not reported")
+	}
+
+}
+
+// TestConstraintsOverlap tests telling whether two constraints accept any of
+// the same values
+func TestConstraintsOverlap(t *testing.T) {
+
+	pairs := map[[2]string]bool{
+		{"int", "[0-9a-f]+"}:      true,
+		{"int", "uuid"}:           false,
+		{"int", "float"}:          true,
+		{"date", "int"}:           false,
+		{"date", "[0-9-]+"}:       true,
+		{"[a-z]+", "[0-9]+"}:      false,
+		{"(?i)ABC", "abc|def"}:    true,
+		{"a.c", "ab+c"}:           true,
+		{"a.c", "abbc"}:           false,
+		{"x?", "y?"}:              false,
+		{"[a-z]{3}", "[a-z]{4}"}:  false,
+		{"foo|bar", "^bar$"}:      true,
+		{"draft|live", "archive"}: false,
+		{"(", "[a-z]+"}:           true,
+	}
+
+	for pair, expected := range pairs {
+
+		if overlap := constraintsOverlap(pair[0], pair[1]); overlap != expected {
+			t.Errorf("Incorrect overlap for %v (expected: %v, actual: %v)", pair, expected, overlap)
+		}
+
+	}
+
+}
@@ -0,0 +1,77 @@
+package jsonserver
+
+import (
+	"context"
+	"net/url"
+)
+
+// contextKey is the type of the keys under which request values are stored in
+// the context passed to middleware and actions, so that they cannot collide
+// with keys used by other packages
+type contextKey int
+
+const (
+	stateKey contextKey = iota
+	routeParamsKey
+	queryParamsKey
+	serverKey
+)
+
+// Deprecated string keys under which request values are also stored, for
+// compatibility with code written before the accessor functions existed
+const (
+	legacyStateKey       = "state"
+	legacyRouteParamsKey = "routeParams"
+	legacyQueryParamsKey = "queryParams"
+)
+
+// State obtains the request state from a context, or an empty state that is
+// not shared with anything if the context does not belong to a request
+func State(ctx context.Context) *RequestState {
+
+	if state, ok := ctx.Value(stateKey).(*RequestState); ok {
+		return state
+	}
+
+	return &RequestState{}
+
+}
+
+// Params obtains the route parameters from a context, or empty parameters if
+// the context does not belong to a request
+func Params(ctx context.Context) RouteParams {
+
+	if routeParams, ok := ctx.Value(routeParamsKey).(RouteParams); ok {
+		return routeParams
+	}
+
+	return RouteParams{}
+
+}
+
+// Query obtains the query string parameters from a context, or empty
+// parameters if the context does not belong to a request
+func Query(ctx context.Context) url.Values {
+
+	if queryParams, ok := ctx.Value(queryParamsKey).(*url.Values); ok {
+		return *queryParams
+	}
+
+	return url.Values{}
+
+}
+
+// withRequestValues stores the request state along with route and query
+// parameters in a context, under both the typed and deprecated string keys
+func withRequestValues(parent context.Context, state *RequestState, routeParams RouteParams, queryParams *url.Values) context.Context {
+
+	ctx := context.WithValue(parent, stateKey, state)
+	ctx = context.WithValue(ctx, routeParamsKey, routeParams)
+	ctx = context.WithValue(ctx, queryParamsKey, queryParams)
+	ctx = context.WithValue(ctx, legacyStateKey, state)
+	ctx = context.WithValue(ctx, legacyRouteParamsKey, routeParams)
+	ctx = context.WithValue(ctx, legacyQueryParamsKey, queryParams)
+
+	return ctx
+
+}
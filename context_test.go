@@ -0,0 +1,83 @@
+package jsonserver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// TestAccessorsReturnRequestValues tests obtaining request values from the
+// context passed to middleware and actions
+func TestAccessorsReturnRequestValues(t *testing.T) {
+
+	router := &Router{}
+	result := ""
+
+	middleware := func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) (bool, int) {
+		State(ctx).Set("user", "alice")
+		return true, 0
+	}
+
+	router.RegisterRoute("GET", "/products/{id}", []Middleware{middleware}, func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) {
+		result = Params(ctx)["id"] + " " + Query(ctx).Get("sort") + " " + State(ctx).Get("user").(string)
+	})
+
+	router.Dispatch(httptest.NewRequest("GET", "/products/123?sort=price", nil), httptest.NewRecorder(), "GET", "/products/123", "sort=price", &[]byte{})
+
+	if result != "123 price alice" {
+		t.Errorf("Request values mismatch (expected: %v, actual: %v)", "123 price alice", result)
+	}
+
+}
+
+// TestAccessorsShareValuesWithStringKeys tests that the deprecated string keys
+// still refer to the same request values
+func TestAccessorsShareValuesWithStringKeys(t *testing.T) {
+
+	queryParams := url.Values{"foo": []string{"bar"}}
+	state := &RequestState{}
+	ctx := withRequestValues(context.Background(), state, RouteParams{"id": "123"}, &queryParams)
+
+	if ctx.Value("state").(*RequestState) != State(ctx) {
+		t.Errorf("State mismatch between typed and string keys")
+	}
+
+	if ctx.Value("routeParams").(RouteParams)["id"] != Params(ctx)["id"] {
+		t.Errorf("Route params mismatch between typed and string keys")
+	}
+
+	if ctx.Value("queryParams").(*url.Values).Get("foo") != Query(ctx).Get("foo") {
+		t.Errorf("Query params mismatch between typed and string keys")
+	}
+
+}
+
+// TestAccessorsOutsideRequest tests that the accessors return safe zero values
+// when a context does not belong to a request
+func TestAccessorsOutsideRequest(t *testing.T) {
+
+	ctx := context.Background()
+
+	if params := Params(ctx); params == nil || len(params) != 0 {
+		t.Errorf("Route params were not empty (actual: %v)", params)
+	}
+
+	if query := Query(ctx); query == nil || len(query) != 0 {
+		t.Errorf("Query params were not empty (actual: %v)", query)
+	}
+
+	state := State(ctx)
+
+	state.Set("foo", "bar")
+
+	if state.Get("foo") != "bar" {
+		t.Errorf("State outside request could not be used")
+	}
+
+	if State(ctx).Get("foo") != nil {
+		t.Errorf("State outside request was unexpectedly shared")
+	}
+
+}
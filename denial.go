@@ -0,0 +1,142 @@
+package jsonserver
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+// Denial describes why middleware denied access to a route, along with the
+// response that should be sent back to the client
+type Denial struct {
+	StatusCode int
+	Body       JSON
+	Headers    http.Header
+}
+
+// ErrorMiddleware is a function signature for HTTP middleware that denies
+// access to a route by returning an error, which should usually be a *Denial
+type ErrorMiddleware func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) error
+
+// Deny creates a denial whose body has the same format as the server's other
+// error responses
+func Deny(statusCode int, message string) *Denial {
+
+	return &Denial{StatusCode: statusCode, Body: JSON{"success": false, "message": message}, Headers: http.Header{}}
+
+}
+
+// Error describes the denial
+func (denial *Denial) Error() string {
+
+	return "Access denied with HTTP code " + strconv.Itoa(denial.StatusCode)
+
+}
+
+// WithHeader adds a header to the denial's response
+func (denial *Denial) WithHeader(key string, value string) *Denial {
+
+	if denial.Headers == nil {
+		denial.Headers = http.Header{}
+	}
+
+	denial.Headers.Add(key, value)
+
+	return denial
+
+}
+
+// Middleware adapts error-returning middleware so that it can be used
+// alongside other middleware. Errors other than a *Denial deny access with a
+// 403 HTTP code and the standard 'access denied' response
+func (middleware ErrorMiddleware) Middleware() Middleware {
+
+	return func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) (bool, int) {
+
+		err := middleware(ctx, request, response, body)
+
+		if err == nil {
+			return true, 0
+		}
+
+		var denial *Denial
+
+		if !errors.As(err, &denial) {
+			denial = &Denial{StatusCode: http.StatusForbidden}
+		}
+
+		if state, ok := ctx.Value(stateKey).(*RequestState); ok {
+			state.setDenial(denial)
+		}
+
+		return false, denial.StatusCode
+
+	}
+
+}
+
+// runMiddleware executes middleware in order, halting execution and returning
+// the HTTP code along with an error (which will be a *Denial if the middleware
+// provided one) as soon as one of them denies access
+func runMiddleware(ctx context.Context, middleware []Middleware, request *http.Request, response http.ResponseWriter, body *[]byte) (int, error) {
+
+	state, hasState := ctx.Value(stateKey).(*RequestState)
+
+	for _, middlewareFunc := range middleware {
+
+		// Only a denial given by the middleware that denies access is used, not
+		// one given earlier by middleware whose decision was overridden
+		if hasState {
+			state.setDenial(nil)
+		}
+
+		middlewareDecision, middlewareResponseCode := middlewareFunc(ctx, request, response, body)
+
+		if middlewareDecision == false {
+
+			if hasState {
+
+				if denial := state.getDenial(); denial != nil {
+					return denial.StatusCode, denial
+				}
+
+			}
+
+			return middlewareResponseCode, errors.New("Access denied to route")
+
+		}
+
+	}
+
+	return 0, nil
+
+}
+
+// writeDenial writes the response for a request that middleware has denied
+func (server *Server) writeDenial(request *http.Request, response http.ResponseWriter, middlewareResponseCode int, err error) {
+
+	var denial *Denial
+
+	if !errors.As(err, &denial) {
+		server.renderError(request, response, ErrorAccessDenied, middlewareResponseCode, err)
+		return
+	}
+
+	for key, values := range denial.Headers {
+
+		for _, value := range values {
+			response.Header().Add(key, value)
+		}
+
+	}
+
+	statusCode := denial.StatusCode
+
+	if statusCode == 0 {
+		statusCode = http.StatusForbidden
+	}
+
+	server.renderError(request, response, ErrorAccessDenied, statusCode, denial)
+
+}
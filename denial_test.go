@@ -0,0 +1,146 @@
+package jsonserver
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestErrorMiddlewareAllowsRoute tests that error-returning middleware allows
+// access when it returns no error
+func TestErrorMiddlewareAllowsRoute(t *testing.T) {
+
+	server := NewServer()
+	middleware := ErrorMiddleware(func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) error {
+		return nil
+	})
+
+	server.RegisterRoute("GET", "/", []Middleware{middleware.Middleware()}, func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) {
+		response.Write([]byte("GET /"))
+	})
+
+	response := testRequest(server, "GET", "/", nil, nil)
+
+	if response.Body.String() != "GET /" {
+		t.Errorf("Route did not execute")
+	}
+
+}
+
+// TestErrorMiddlewareRendersDenial tests that a denial's status code, body and
+// headers are sent back to the client
+func TestErrorMiddlewareRendersDenial(t *testing.T) {
+
+	server := NewServer()
+	middleware := ErrorMiddleware(func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) error {
+		return Deny(http.StatusTooManyRequests, "Rate limit exceeded").WithHeader("Retry-After", "30")
+	})
+
+	server.RegisterRoute("GET", "/", []Middleware{middleware.Middleware()}, func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) {
+		response.Write([]byte("GET /"))
+	})
+
+	response := testRequest(server, "GET", "/", nil, nil)
+
+	if response.Code != http.StatusTooManyRequests {
+		t.Errorf("Incorrect status code (expected: %v, actual: %v)", http.StatusTooManyRequests, response.Code)
+	}
+
+	if response.Header().Get("Retry-After") != "30" {
+		t.Errorf("Incorrect Retry-After header (expected: %v, actual: %v)", "30", response.Header().Get("Retry-After"))
+	}
+
+	if response.Body.String() != `{"message":"Rate limit exceeded","success":false}` {
+		t.Errorf("Incorrect body (actual: %v)", response.Body.String())
+	}
+
+}
+
+// TestOverriddenDenialIsNotUsed tests that a denial overridden by the
+// middleware that received it is not used when later middleware denies access
+func TestOverriddenDenialIsNotUsed(t *testing.T) {
+
+	server := NewServer()
+	rateLimit := ErrorMiddleware(func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) error {
+		return Deny(http.StatusTooManyRequests, "Slow down")
+	}).Middleware()
+
+	// Rate limiting is only advisory, so its decision is overridden
+	advisoryRateLimit := func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) (bool, int) {
+		rateLimit(ctx, request, response, body)
+		return true, 0
+	}
+
+	authenticate := func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) (bool, int) {
+		return false, http.StatusUnauthorized
+	}
+
+	server.RegisterRoute("GET", "/", []Middleware{advisoryRateLimit, authenticate}, func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) {})
+
+	response := testRequest(server, "GET", "/", nil, nil)
+
+	if response.Code != http.StatusUnauthorized || response.Body.String() != `{"message":"Access denied","success":false}` {
+		t.Errorf("Overridden denial was used (status code: %v, body: %v)", response.Code, response.Body.String())
+	}
+
+}
+
+// TestErrorMiddlewareRendersCustomBody tests that server middleware can deny
+// access with a custom body
+func TestErrorMiddlewareRendersCustomBody(t *testing.T) {
+
+	server := NewServer()
+
+	server.Use(ErrorMiddleware(func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) error {
+		return &Denial{StatusCode: http.StatusUnauthorized, Body: JSON{"error": "token_expired"}}
+	}).Middleware())
+
+	response := testRequest(server, "GET", "/404", nil, nil)
+
+	if response.Code != http.StatusUnauthorized || response.Body.String() != `{"error":"token_expired"}` {
+		t.Errorf("Incorrect denial response (status code: %v, body: %v)", response.Code, response.Body.String())
+	}
+
+}
+
+// TestErrorMiddlewareWithPlainError tests that errors other than denials deny
+// access with the standard response
+func TestErrorMiddlewareWithPlainError(t *testing.T) {
+
+	server := NewServer()
+	middleware := ErrorMiddleware(func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) error {
+		return errors.New("missing scope")
+	})
+
+	server.RegisterRoute("GET", "/", []Middleware{middleware.Middleware()}, func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) {})
+
+	response := testRequest(server, "GET", "/", nil, nil)
+
+	if response.Code != http.StatusForbidden || response.Body.String() != `{"message":"Access denied","success":false}` {
+		t.Errorf("Incorrect denial response (status code: %v, body: %v)", response.Code, response.Body.String())
+	}
+
+}
+
+// TestDispatchReturnsDenial tests that dispatching a route denied by
+// error-returning middleware returns the denial
+func TestDispatchReturnsDenial(t *testing.T) {
+
+	router := &Router{}
+	middleware := ErrorMiddleware(func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) error {
+		return Deny(http.StatusPaymentRequired, "Subscription required")
+	})
+
+	router.RegisterRoute("GET", "/", []Middleware{middleware.Middleware()}, func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) {})
+
+	success, code, err := router.Dispatch(httptest.NewRequest("GET", "/", nil), httptest.NewRecorder(), "GET", "/", "", &[]byte{})
+
+	var denial *Denial
+
+	if success || code != http.StatusPaymentRequired || !errors.As(err, &denial) || denial.Body["message"] != "Subscription required" {
+		t.Errorf("Dispatch did not return the denial (success: %v, code: %v, error: %v)", success, code, err)
+	}
+
+}
@@ -0,0 +1,241 @@
+package jsonserver
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ErrorKind identifies the kind of error that the server is responding to
+type ErrorKind int
+
+const (
+	// ErrorNotFound is raised when no route matches a request's path
+	ErrorNotFound ErrorKind = iota + 1
+
+	// ErrorMethodNotAllowed is raised when routes match a request's path but
+	// not its method
+	ErrorMethodNotAllowed
+
+	// ErrorAccessDenied is raised when middleware denies access to a route
+	ErrorAccessDenied
+
+	// ErrorBodyUnreadable is raised when a request body cannot be read
+	ErrorBodyUnreadable
+
+	// ErrorBodyTooLarge is raised when a request body exceeds the maximum size
+	ErrorBodyTooLarge
+
+	// ErrorInvalidBody is raised when a request body cannot be decoded or fails
+	// validation
+	ErrorInvalidBody
+
+	// ErrorTimeout is raised when a request is not handled within the timeout
+	ErrorTimeout
+
+	// ErrorPanic is raised when middleware or an action panics
+	ErrorPanic
+
+	// ErrorNotAcceptable is raised when a response cannot be produced in a
+	// format that the client accepts
+	ErrorNotAcceptable
+
+	// ErrorUnsupportedMediaType is raised when a request body is in a format
+	// that cannot be decoded
+	ErrorUnsupportedMediaType
+
+	// ErrorInternal is raised when the server fails to produce a response, such
+	// as when a value passed to Respond cannot be encoded
+	ErrorInternal
+)
+
+// ErrorRenderer writes the responses for errors raised by the server itself.
+// The cause is the underlying error where there is one (such as the *Denial
+// returned by middleware, or the ValidationErrors for an invalid body), and
+// any headers the response needs (such as Allow) have already been set
+type ErrorRenderer interface {
+	RenderError(response http.ResponseWriter, request *http.Request, kind ErrorKind, statusCode int, cause error)
+}
+
+// ErrorRendererFunc adapts a function so that it can be used as an
+// ErrorRenderer
+type ErrorRendererFunc func(response http.ResponseWriter, request *http.Request, kind ErrorKind, statusCode int, cause error)
+
+// StandardErrorRenderer writes errors in the standard
+// {"success":false,"message":...} format
+type StandardErrorRenderer struct{}
+
+// ProblemErrorRenderer writes errors as RFC 7807 problem details
+type ProblemErrorRenderer struct{}
+
+// errorKindNames holds the names of the error kinds
+var errorKindNames = map[ErrorKind]string{
+	ErrorNotFound:             "not found",
+	ErrorMethodNotAllowed:     "method not allowed",
+	ErrorAccessDenied:         "access denied",
+	ErrorBodyUnreadable:       "body unreadable",
+	ErrorBodyTooLarge:         "body too large",
+	ErrorInvalidBody:          "invalid body",
+	ErrorTimeout:              "timeout",
+	ErrorPanic:                "panic",
+	ErrorNotAcceptable:        "not acceptable",
+	ErrorUnsupportedMediaType: "unsupported media type",
+	ErrorInternal:             "internal",
+}
+
+// String names the error kind
+func (kind ErrorKind) String() string {
+
+	if name, ok := errorKindNames[kind]; ok {
+		return name
+	}
+
+	return "unknown"
+
+}
+
+// RenderError calls the function
+func (renderer ErrorRendererFunc) RenderError(response http.ResponseWriter, request *http.Request, kind ErrorKind, statusCode int, cause error) {
+
+	renderer(response, request, kind, statusCode, cause)
+
+}
+
+// RenderError writes an error in the standard format, sending the body of a
+// *Denial unchanged
+func (renderer StandardErrorRenderer) RenderError(response http.ResponseWriter, request *http.Request, kind ErrorKind, statusCode int, cause error) {
+
+	var denial *Denial
+
+	if kind == ErrorAccessDenied && errors.As(cause, &denial) && denial.Body != nil {
+		WriteResponse(response, &denial.Body, statusCode)
+		return
+	}
+
+	message, extensions := errorMessage(request, kind, cause)
+	body := JSON{}
+
+	for key, value := range extensions {
+		body[key] = value
+	}
+
+	body["success"] = false
+	body["message"] = message
+
+	WriteResponse(response, &body, statusCode)
+
+}
+
+// RenderError writes an error as problem details, with the message as the
+// problem's detail and the request path as its instance. The message in a
+// *Denial's body becomes the detail and any other members become extension
+// members
+func (renderer ProblemErrorRenderer) RenderError(response http.ResponseWriter, request *http.Request, kind ErrorKind, statusCode int, cause error) {
+
+	message, extensions := errorMessage(request, kind, cause)
+
+	WriteProblem(response, &Problem{Status: statusCode, Detail: message, Instance: request.URL.Path, Extensions: extensions})
+
+}
+
+// errorMessage describes an error raised by the server, along with any extra
+// members that should be added to the response body
+func errorMessage(request *http.Request, kind ErrorKind, cause error) (string, JSON) {
+
+	var denial *Denial
+	validationErrors := ValidationErrors{}
+
+	switch kind {
+
+	case ErrorNotFound:
+
+		return "Could not find " + request.URL.Path, nil
+
+	case ErrorMethodNotAllowed:
+
+		return "Method not allowed", nil
+
+	case ErrorAccessDenied:
+
+		if !errors.As(cause, &denial) || denial.Body == nil {
+			return "Access denied", nil
+		}
+
+		message, _ := denial.Body["message"].(string)
+		extensions := JSON{}
+
+		for key, value := range denial.Body {
+
+			if key != "success" && key != "message" {
+				extensions[key] = value
+			}
+
+		}
+
+		return message, extensions
+
+	case ErrorBodyUnreadable:
+
+		return "Could not read request body", nil
+
+	case ErrorBodyTooLarge:
+
+		return "Request body too large", nil
+
+	case ErrorInvalidBody:
+
+		if errors.As(cause, &validationErrors) {
+			return "Request body is invalid", JSON{"errors": validationErrors}
+		}
+
+		if cause != nil {
+			return cause.Error(), nil
+		}
+
+		return "Request body is invalid", nil
+
+	case ErrorTimeout:
+
+		return "Request timed out", nil
+
+	case ErrorNotAcceptable:
+
+		return ErrNotAcceptable.Error(), nil
+
+	case ErrorUnsupportedMediaType:
+
+		return ErrUnsupportedMediaType.Error(), nil
+
+	}
+
+	return "Internal server error", nil
+
+}
+
+// renderError writes the response for an error raised while handling a
+// request using the server's error renderer, or the standard or problem
+// details renderer if it does not have one
+func (server *Server) renderError(request *http.Request, response http.ResponseWriter, kind ErrorKind, statusCode int, cause error) {
+
+	var renderer ErrorRenderer = StandardErrorRenderer{}
+
+	if server != nil && server.ErrorRenderer != nil {
+		renderer = server.ErrorRenderer
+	} else if server != nil && server.ProblemDetails {
+		renderer = ProblemErrorRenderer{}
+	}
+
+	renderer.RenderError(response, request, kind, statusCode, cause)
+
+}
+
+// panicError turns a recovered panic into an error
+func panicError(recovered interface{}) error {
+
+	if err, ok := recovered.(error); ok {
+		return fmt.Errorf("panic: %w", err)
+	}
+
+	return fmt.Errorf("panic: %v", recovered)
+
+}
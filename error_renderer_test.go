@@ -0,0 +1,146 @@
+package jsonserver
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// testRenderedError records an error passed to an error renderer
+type testRenderedError struct {
+	kind       ErrorKind
+	statusCode int
+	cause      error
+}
+
+// TestErrorRendererReceivesErrors tests that every framework error is passed
+// to the server's error renderer along with its cause
+func TestErrorRendererReceivesErrors(t *testing.T) {
+
+	server := testProblemServer()
+	rendered := []testRenderedError{}
+
+	server.ErrorRenderer = ErrorRendererFunc(func(response http.ResponseWriter, request *http.Request, kind ErrorKind, statusCode int, cause error) {
+		rendered = append(rendered, testRenderedError{kind, statusCode, cause})
+		response.WriteHeader(statusCode)
+		response.Write([]byte(kind.String()))
+	})
+
+	tests := []struct {
+		method string
+		path   string
+		body   string
+		kind   ErrorKind
+		status int
+	}{
+		{"GET", "/missing", "", ErrorNotFound, 404},
+		{"DELETE", "/panic", "", ErrorMethodNotAllowed, 405},
+		{"GET", "/forbidden", "", ErrorAccessDenied, 401},
+		{"GET", "/denied", "", ErrorAccessDenied, 403},
+		{"GET", "/panic", "", ErrorPanic, 500},
+		{"GET", "/slow", "", ErrorTimeout, 503},
+		{"POST", "/upload", "012345678901234567890", ErrorBodyTooLarge, 413},
+		{"POST", "/products", `{"price":1}`, ErrorInvalidBody, 400},
+	}
+
+	for i, test := range tests {
+
+		response := testRequest(server, test.method, test.path, strings.NewReader(test.body), nil)
+
+		if len(rendered) != i+1 || rendered[i].kind != test.kind || rendered[i].statusCode != test.status {
+			t.Fatalf("Error was not rendered for %v %v (rendered: %v)", test.method, test.path, rendered)
+		}
+
+		if response.Code != test.status || response.Body.String() != test.kind.String() {
+			t.Errorf("Renderer's response was not sent for %v %v (status code: %v, body: %v)", test.method, test.path, response.Code, response.Body.String())
+		}
+
+	}
+
+	var denial *Denial
+	validationErrors := ValidationErrors{}
+
+	if !errors.As(rendered[2].cause, &denial) || denial.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Denial was not passed as the cause (cause: %v)", rendered[2].cause)
+	}
+
+	if !errors.Is(rendered[5].cause, context.DeadlineExceeded) {
+		t.Errorf("Deadline was not passed as the cause (cause: %v)", rendered[5].cause)
+	}
+
+	if !errors.As(rendered[7].cause, &validationErrors) || len(validationErrors) != 1 {
+		t.Errorf("Validation errors were not passed as the cause (cause: %v)", rendered[7].cause)
+	}
+
+}
+
+// TestErrorRendererCanHidePaths tests that a renderer can replace the default
+// messages while delegating to a built-in renderer
+func TestErrorRendererCanHidePaths(t *testing.T) {
+
+	server := NewServer()
+
+	server.ErrorRenderer = ErrorRendererFunc(func(response http.ResponseWriter, request *http.Request, kind ErrorKind, statusCode int, cause error) {
+
+		if kind == ErrorNotFound {
+			WriteResponse(response, &JSON{"error": "not_found"}, statusCode)
+			return
+		}
+
+		StandardErrorRenderer{}.RenderError(response, request, kind, statusCode, cause)
+
+	})
+
+	response := testRequest(server, "GET", "/secret/path", nil, nil)
+
+	if response.Code != http.StatusNotFound || response.Body.String() != `{"error":"not_found"}` {
+		t.Errorf("Custom 404 response was not sent (status code: %v, body: %v)", response.Code, response.Body.String())
+	}
+
+}
+
+// TestStandardErrorRenderer tests that the standard renderer keeps the
+// standard error format
+func TestStandardErrorRenderer(t *testing.T) {
+
+	request := httptest.NewRequest("GET", "/products", nil)
+	causes := map[ErrorKind]error{
+		ErrorNotFound:       nil,
+		ErrorAccessDenied:   &Denial{StatusCode: 402, Body: JSON{"code": "payment"}},
+		ErrorInvalidBody:    errInvalidJSON,
+		ErrorBodyUnreadable: errors.New("connection reset"),
+		ErrorPanic:          panicError("oops"),
+	}
+	expected := map[ErrorKind]string{
+		ErrorNotFound:       `{"message":"Could not find /products","success":false}`,
+		ErrorAccessDenied:   `{"code":"payment"}`,
+		ErrorInvalidBody:    `{"message":"Request body is not valid JSON","success":false}`,
+		ErrorBodyUnreadable: `{"message":"Could not read request body","success":false}`,
+		ErrorPanic:          `{"message":"Internal server error","success":false}`,
+	}
+
+	for kind, cause := range causes {
+
+		response := httptest.NewRecorder()
+
+		StandardErrorRenderer{}.RenderError(response, request, kind, 400, cause)
+
+		if response.Body.String() != expected[kind] {
+			t.Errorf("Incorrect body for %v error (expected: %v, actual: %v)", kind, expected[kind], response.Body.String())
+		}
+
+	}
+
+}
+
+// TestErrorKindString tests that error kinds are named
+func TestErrorKindString(t *testing.T) {
+
+	if ErrorBodyTooLarge.String() != "body too large" || ErrorKind(0).String() != "unknown" {
+		t.Errorf("Error kinds were not named correctly")
+	}
+
+}
@@ -0,0 +1,60 @@
+package jsonserver
+
+// RouteGroup registers routes beneath a shared path prefix, running shared
+// middleware before each route's own middleware
+type RouteGroup struct {
+	registrar  RouteRegistrar
+	prefix     string
+	middleware []Middleware
+}
+
+// Group creates a group of routes sharing a path prefix and middleware
+func (router *Router) Group(prefix string, middleware ...Middleware) *RouteGroup {
+
+	return &RouteGroup{registrar: router, prefix: prefix, middleware: middleware}
+
+}
+
+// Group creates a group of routes sharing a path prefix and middleware
+func (server *Server) Group(prefix string, middleware ...Middleware) *RouteGroup {
+
+	return server.Router.Group(prefix, middleware...)
+
+}
+
+// Group creates a nested group of routes, whose paths follow this group's
+// prefix and whose middleware runs after this group's middleware
+func (group *RouteGroup) Group(prefix string, middleware ...Middleware) *RouteGroup {
+
+	return &RouteGroup{registrar: group, prefix: prefix, middleware: middleware}
+
+}
+
+// RegisterRoute stores a closure to execute against a method and a path
+// relative to the group's prefix, returning an error if it conflicts with an
+// existing route
+func (group *RouteGroup) RegisterRoute(method string, path string, middleware []Middleware, action RouteAction, options ...RouteOption) error {
+
+	groupMiddleware := append(append([]Middleware{}, group.middleware...), middleware...)
+
+	return group.registrar.RegisterRoute(method, joinPaths(group.prefix, path), groupMiddleware, action, options...)
+
+}
+
+// joinPaths joins a path prefix and a path with a single slash
+func joinPaths(prefix string, path string) string {
+
+	normalisedPrefix := normalisePath(prefix)
+	normalisedPath := normalisePath(path)
+
+	if normalisedPrefix == "" {
+		return "/" + normalisedPath
+	}
+
+	if normalisedPath == "" {
+		return "/" + normalisedPrefix
+	}
+
+	return "/" + normalisedPrefix + "/" + normalisedPath
+
+}
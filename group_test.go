@@ -0,0 +1,118 @@
+package jsonserver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// testOrderMiddleware creates middleware that records its name in the request
+// state
+func testOrderMiddleware(name string) Middleware {
+
+	return func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) (bool, int) {
+
+		state := ctx.Value("state").(*RequestState)
+		order, _ := state.Get("order").(string)
+
+		state.Set("order", order+name+" ")
+
+		return true, 0
+
+	}
+
+}
+
+// TestGroupRegistersRoutesWithPrefix tests registering routes beneath a group's
+// path prefix
+func TestGroupRegistersRoutesWithPrefix(t *testing.T) {
+
+	router := &Router{}
+	action := func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) {}
+	group := router.Group("/api/v2/")
+
+	group.RegisterRoute("GET", "/products/{id}", []Middleware{}, action)
+	group.RegisterRoute("GET", "/", []Middleware{}, action)
+	group.Group("admin").RegisterRoute("GET", "users", []Middleware{}, action)
+
+	for _, path := range []string{"/api/v2/products/{id}", "/api/v2", "/api/v2/admin/users"} {
+
+		found := false
+
+		for _, route := range router.Routes["GET"] {
+
+			if route.Path == path {
+				found = true
+			}
+
+		}
+
+		if !found {
+			t.Errorf("Route %v was not registered", path)
+		}
+
+	}
+
+}
+
+// TestGroupMiddlewareOrder tests that nested group middleware runs outer group
+// first, then inner group, then the route's own middleware
+func TestGroupMiddlewareOrder(t *testing.T) {
+
+	router := &Router{}
+	api := router.Group("/api/v2", testOrderMiddleware("auth"))
+	admin := api.Group("/admin", testOrderMiddleware("permission"), testOrderMiddleware("audit"))
+
+	admin.RegisterRoute("GET", "/users", []Middleware{testOrderMiddleware("route")}, func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) {
+		response.Write([]byte(ctx.Value("state").(*RequestState).Get("order").(string)))
+	})
+
+	request := httptest.NewRequest("GET", "/api/v2/admin/users", nil)
+	response := httptest.NewRecorder()
+
+	router.Dispatch(request, response, "GET", "/api/v2/admin/users", "", &[]byte{})
+
+	if response.Body.String() != "auth permission audit route " {
+		t.Errorf("Middleware order mismatch (expected: %v, actual: %v)", "auth permission audit route ", response.Body.String())
+	}
+
+}
+
+// TestGroupReportsDuplicateRoutes tests that groups return registration errors
+func TestGroupReportsDuplicateRoutes(t *testing.T) {
+
+	server := NewServer()
+	action := func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) {}
+
+	server.RegisterRoute("GET", "/api/products", []Middleware{}, action)
+
+	if server.Group("/api").RegisterRoute("GET", "/products", []Middleware{}, action) == nil {
+		t.Errorf("Duplicate route did not return an error")
+	}
+
+}
+
+// TestJoinPaths tests joining path prefixes and paths
+func TestJoinPaths(t *testing.T) {
+
+	paths := map[[2]string]string{
+		{"", ""}:             "/",
+		{"/", "/"}:           "/",
+		{"/api", "/"}:        "/api",
+		{"/", "/foo"}:        "/foo",
+		{"api/", "foo/{id}"}: "/api/foo/{id}",
+		{"/api/v2", "/:"}:    "/api/v2/:",
+	}
+
+	for parts, expected := range paths {
+
+		actual := joinPaths(parts[0], parts[1])
+
+		if actual != expected {
+			t.Errorf("Path joining failure (expected: %v, actual: %v)", expected, actual)
+		}
+
+	}
+
+}
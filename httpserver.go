@@ -1,23 +1,50 @@
 package jsonserver
 
 import (
-	"bytes"
+	"context"
 	"crypto/tls"
-	"io/ioutil"
+	"errors"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"runtime/debug"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
 // Server represents a HTTP server
 type Server struct {
-	Router   *Router
-	CertPath string
-	KeyPath  string
+	Router          *Router
+	CertPath        string
+	KeyPath         string
+	Timeout         time.Duration
+	MaxBodySize     int64
+	ShutdownTimeout time.Duration
+	OnPanic         func(ctx context.Context, request *http.Request, recovered interface{}, stack []byte)
+	ProblemDetails  bool
+	ErrorRenderer   ErrorRenderer
+	middleware      []Middleware
+	wrappers        []Wrapper
+	codecs          []Codec
+	httpServers     []*http.Server
+	serveErrors     chan error
+	baseContext     context.Context
+	cancelBase      context.CancelFunc
+	shuttingDown    bool
+	lifecycleLock   sync.Mutex
+	inFlight        int
+	inFlightLock    sync.Mutex
+	inFlightDone    *sync.Cond
 }
 
+// defaultShutdownTimeout is how long Run waits for in-flight requests to
+// finish if the server has no shutdown timeout
+const defaultShutdownTimeout = 30 * time.Second
+
 // NewServer creates a new server
 func NewServer() *Server {
 
@@ -47,92 +74,669 @@ func (server *Server) EnableTLS(certPath string, keyPath string) error {
 
 }
 
-// RegisterRoute stores a closure to execute against a method and path
-func (server *Server) RegisterRoute(method string, path string, middleware []Middleware, action RouteAction) {
+// RegisterRoute stores a closure to execute against a method and path,
+// returning an error if it conflicts with an existing route
+func (server *Server) RegisterRoute(method string, path string, middleware []Middleware, action RouteAction, options ...RouteOption) error {
+
+	return server.Router.RegisterRoute(method, path, middleware, action, options...)
+
+}
+
+// UnregisterRoute removes the route registered against a method and path,
+// returning an error if there is no such route
+func (server *Server) UnregisterRoute(method string, path string) error {
 
-	server.Router.RegisterRoute(method, path, middleware, action)
+	return server.Router.UnregisterRoute(method, path)
+
+}
+
+// Use adds middleware that runs on every request before any route-specific
+// middleware, even if no route matches; it should be called before the server
+// starts
+func (server *Server) Use(middleware ...Middleware) {
+
+	server.middleware = append(server.middleware, middleware...)
+
+}
+
+// Wrap adds wrappers around the handling of every request, including requests
+// that do not match a route or are denied by middleware, with the first wrapper
+// outermost; it should be called before the server starts
+func (server *Server) Wrap(wrappers ...Wrapper) {
+
+	server.wrappers = append(server.wrappers, wrappers...)
 
 }
 
 // Handle incoming requests and route to the appropriate package
 func (server *Server) ServeHTTP(response http.ResponseWriter, request *http.Request) {
 
-	body, err := ioutil.ReadAll(request.Body)
+	// Keep track of the request so that a shutdown can wait for it to finish
+	server.startRequest()
+	defer server.finishRequest()
 
-	if err != nil {
-		WriteResponse(response, &JSON{"success": false, "message": "Could not read request body"}, http.StatusBadRequest)
+	// Extract request details and find the appropriate route, using the same
+	// route table throughout the request even if the routes change
+	method := strings.ToUpper(request.Method)
+	path := request.URL.Path[:]
+	params := request.URL.RawQuery
+	table := server.Router.load()
+	route, routeParams := table.match(method, path)
+
+	// HEAD requests fall back to GET routes, with the body discarded
+	if route == nil && method == http.MethodHead {
+
+		route, routeParams = table.match(http.MethodGet, path)
+		response = &headResponseWriter{ResponseWriter: response}
+
+	}
+
+	body := []byte{}
+
+	var bodyErr error
+
+	wrappedHandler := wrapAction(func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) {
+		server.handle(ctx, table, route, bodyErr, request, response, body)
+	}, server.wrappers)
+
+	// The body is only read if there is a route to pass it to, and is read as
+	// part of handling the request so that it is subject to the timeout. Any
+	// error reading it is reported once the server's middleware has run
+	handler := func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) {
+
+		if route != nil {
+			*body, bodyErr = server.readBody(route, request, response)
+		}
+
+		wrappedHandler(ctx, request, response, body)
+
+	}
+
+	// Routes can override the server's timeout, or disable it with a negative
+	// timeout
+	timeout := server.Timeout
+
+	if route != nil && route.Timeout != 0 {
+		timeout = route.Timeout
+	}
+
+	if timeout > 0 {
+		server.runWithTimeout(timeout, handler, routeParams, params, request, response, &body)
 	} else {
+		server.run(request.Context(), handler, routeParams, params, request, response, &body)
+	}
 
-		// Write the body back to the request for later use
-		request.Body = ioutil.NopCloser(bytes.NewBuffer(body))
+}
+
+// run creates the context for a request and handles it, turning panics in
+// middleware and actions into error responses
+func (server *Server) run(parent context.Context, handler RouteAction, routeParams RouteParams, params string, request *http.Request, response http.ResponseWriter, body *[]byte) {
+
+	ctx := context.WithValue(newRequestContext(parent, routeParams, params), serverKey, server)
+
+	// Responses that are not buffered need to be watched, as an error response
+	// cannot be sent once part of the response has been
+	if _, buffered := response.(*timeoutWriter); !buffered {
+		response = &trackingWriter{ResponseWriter: response}
+	}
 
-		// Extract request details and dispatch to the appropriate route
-		method := request.Method
+	// Call any cleanup functions once the request has been handled
+	defer State(ctx).complete()
+	defer server.recoverPanic(ctx, request, response)
+
+	handler(ctx, request, response, body)
+
+}
+
+// handle runs the server's middleware and then the matched route, writing an
+// error response if access is denied, the body could not be read or there is
+// no route to run
+func (server *Server) handle(ctx context.Context, table *routeTable, route *Route, bodyErr error, request *http.Request, response http.ResponseWriter, body *[]byte) {
+
+	// Execute all server middleware and halt execution if one of them returns
+	// FALSE
+	if middlewareResponseCode, err := runMiddleware(ctx, server.middleware, request, response, body); err != nil {
+		server.writeDenial(request, response, middlewareResponseCode, err)
+		return
+	}
+
+	if bodyErr != nil {
+		WriteBodyError(ctx, request, response, bodyErr)
+		return
+	}
+
+	// No matching routes found for the method
+	if route == nil {
+
+		method := strings.ToUpper(request.Method)
 		path := request.URL.Path[:]
-		params := request.URL.RawQuery
-		success, middlewareResponseCode, err := server.Router.Dispatch(request, response, method, path, params, &body)
+		allowedMethods := server.allowedMethods(table, path)
 
-		// Access denied by middleware
-		if err != nil {
+		if len(allowedMethods) == 0 {
+			server.renderError(request, response, ErrorNotFound, http.StatusNotFound, nil)
+		} else if method == http.MethodOptions {
+			response.Header().Set("Allow", strings.Join(allowedMethods, ", "))
+			response.WriteHeader(http.StatusNoContent)
+		} else {
+			response.Header().Set("Allow", strings.Join(allowedMethods, ", "))
+			server.renderError(request, response, ErrorMethodNotAllowed, http.StatusMethodNotAllowed, nil)
+		}
+
+		return
+
+	}
+
+	middlewareResponseCode, err := server.Router.execute(ctx, route, request, response, body)
+
+	// Access denied by middleware
+	if err != nil {
+		server.writeDenial(request, response, middlewareResponseCode, err)
+	}
+
+}
+
+// recoverPanic recovers from a panic while handling a request, reporting it to
+// the OnPanic hook (or logging it if there is no hook) and writing an error
+// response. If part of the response has already been sent, the response is
+// aborted instead so that the client does not mistake it for a complete one
+func (server *Server) recoverPanic(ctx context.Context, request *http.Request, response http.ResponseWriter) {
+
+	recovered := recover()
+
+	if recovered == nil {
+		return
+	}
+
+	// Aborting a response deliberately is left to net/http
+	if recovered == http.ErrAbortHandler {
+		panic(recovered)
+	}
+
+	stack := debug.Stack()
+
+	if server.OnPanic != nil {
+		server.OnPanic(ctx, request, recovered, stack)
+	} else {
+		log.Printf("Panic serving %v: %v\n%s", request.URL.Path, recovered, stack)
+	}
 
-			WriteResponse(response, &JSON{"success": false, "message": "Access denied"}, middlewareResponseCode)
+	switch writer := response.(type) {
 
-			// No matching routes found
-		} else if !success {
+	case *timeoutWriter:
 
-			WriteResponse(response, &JSON{"success": false, "message": "Could not find " + path}, http.StatusNotFound)
+		writer.reset()
 
+	case *trackingWriter:
+
+		if writer.wroteHeader {
+			panic(http.ErrAbortHandler)
 		}
 
 	}
 
+	server.renderError(request, response, ErrorPanic, http.StatusInternalServerError, panicError(recovered))
+
 }
 
-// Start initialises the HTTP server
-func (server *Server) Start(port int, timeout int) {
+// allowedMethods lists the methods that can be used with a path, including
+// those that are answered automatically
+func (server *Server) allowedMethods(table *routeTable, path string) []string {
 
-	timeoutDuration := time.Duration(time.Duration(timeout) * time.Second)
-	mux := http.NewServeMux()
+	allowedMethods := table.allowedMethods(path)
+
+	if len(allowedMethods) == 0 {
+		return allowedMethods
+	}
 
-	mux.Handle("/", http.TimeoutHandler(server, timeoutDuration, "Request timed out"))
+	allowedMethods = append(allowedMethods, http.MethodOptions)
+
+	for _, allowedMethod := range allowedMethods {
+
+		if allowedMethod == http.MethodGet {
+			allowedMethods = append(allowedMethods, http.MethodHead)
+			break
+		}
+
+	}
+
+	sort.Strings(allowedMethods)
+
+	// Remove any automatic methods that have also been registered
+	uniqueMethods := allowedMethods[:0]
+
+	for i, allowedMethod := range allowedMethods {
+
+		if i == 0 || allowedMethod != allowedMethods[i-1] {
+			uniqueMethods = append(uniqueMethods, allowedMethod)
+		}
+
+	}
+
+	return uniqueMethods
+
+}
+
+// headResponseWriter discards the body of responses to HEAD requests
+type headResponseWriter struct {
+	http.ResponseWriter
+}
+
+// Write discards the body while reporting it as written
+func (response *headResponseWriter) Write(body []byte) (int, error) {
+
+	return len(body), nil
+
+}
+
+// trackingWriter records whether the response's headers have been sent
+type trackingWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+// WriteHeader sends the response's headers
+func (response *trackingWriter) WriteHeader(statusCode int) {
+
+	response.wroteHeader = true
+	response.ResponseWriter.WriteHeader(statusCode)
+
+}
+
+// Write sends part of the response body, along with the headers if they have
+// not been sent yet
+func (response *trackingWriter) Write(body []byte) (int, error) {
+
+	response.wroteHeader = true
+
+	return response.ResponseWriter.Write(body)
+
+}
+
+// Flush sends any buffered data to the client, if the underlying response
+// supports it
+func (response *trackingWriter) Flush() {
+
+	if flusher, ok := response.ResponseWriter.(http.Flusher); ok {
+		response.wroteHeader = true
+		flusher.Flush()
+	}
+
+}
+
+// Unwrap returns the underlying response
+func (response *trackingWriter) Unwrap() http.ResponseWriter {
+
+	return response.ResponseWriter
+
+}
+
+// Start initialises the HTTP server, returning an error if it cannot listen on
+// the given port; requests are then served in the background
+func (server *Server) Start(port int, timeout int) error {
+
+	server.Timeout = time.Duration(time.Duration(timeout) * time.Second)
+
+	return server.Listen("tcp", ":"+strconv.Itoa(port), server.CertPath != "" && server.KeyPath != "")
+
+}
+
+// Listen binds to an address on the given network (e.g. "tcp" or "unix"),
+// returning an error if it cannot do so; requests are then served in the
+// background, using TLS if requested. Listen may be called several times to
+// serve the same routes on multiple addresses
+func (server *Server) Listen(network string, address string, useTLS bool) error {
+
+	listener, err := net.Listen(network, address)
+
+	if err != nil {
+		return err
+	}
+
+	httpServer, err := server.newHTTPServer(useTLS)
+
+	if err != nil {
+		listener.Close()
+		return err
+	}
 
 	go func() {
 
-		// HTTPS requests
-		if server.CertPath != "" && server.KeyPath != "" {
+		err := serveListener(httpServer, listener)
 
-			certificate, err := tls.LoadX509KeyPair(server.CertPath, server.KeyPath)
+		if err != http.ErrServerClosed {
+			server.reportServeError(err)
+		}
 
-			if err != nil {
-				log.Fatal(err)
-			}
+	}()
 
-			httpServer := &http.Server{
-				Addr:    ":" + strconv.Itoa(port),
-				Handler: mux,
-				TLSConfig: &tls.Config{
-					Certificates: []tls.Certificate{certificate},
-					MinVersion:   tls.VersionTLS12,
-				},
-			}
+	return nil
+
+}
 
-			err = httpServer.ListenAndServeTLS("", "")
+// Serve accepts plain HTTP connections on a listener, blocking until the
+// server is shut down (at which point http.ErrServerClosed is returned) or
+// fails
+func (server *Server) Serve(listener net.Listener) error {
 
-			if err != nil {
-				log.Fatal(err)
-			}
+	httpServer, err := server.newHTTPServer(false)
 
-			// HTTP requests
-		} else {
+	if err != nil {
+		listener.Close()
+		return err
+	}
+
+	return serveListener(httpServer, listener)
+
+}
 
-			err := http.ListenAndServe(":"+strconv.Itoa(port), mux)
+// ServeTLS accepts HTTPS connections on a listener using the certificate set
+// by EnableTLS, blocking until the server is shut down (at which point
+// http.ErrServerClosed is returned) or fails
+func (server *Server) ServeTLS(listener net.Listener) error {
 
-			if err != nil {
-				log.Fatal(err)
+	httpServer, err := server.newHTTPServer(true)
+
+	if err != nil {
+		listener.Close()
+		return err
+	}
+
+	return serveListener(httpServer, listener)
+
+}
+
+// Run starts the HTTP server and blocks until either the context is cancelled,
+// at which point the server is shut down gracefully (waiting for in-flight
+// requests for up to ShutdownTimeout, or 30 seconds if it is not set), or the
+// server fails
+func (server *Server) Run(ctx context.Context, port int, timeout int) error {
+
+	err := server.Start(port, timeout)
+
+	if err != nil {
+		return err
+	}
+
+	select {
+
+	case <-ctx.Done():
+
+		return server.shutdownWithTimeout()
+
+	case err := <-server.serveErrors:
+
+		server.shutdownWithTimeout()
+
+		return err
+
+	}
+
+}
+
+// shutdownWithTimeout shuts the server down, giving up waiting for in-flight
+// requests once the server's shutdown timeout has passed
+func (server *Server) shutdownWithTimeout() error {
+
+	timeout := server.ShutdownTimeout
+
+	if timeout <= 0 {
+		timeout = defaultShutdownTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return server.Shutdown(ctx)
+
+}
+
+// Shutdown stops the server accepting new connections and waits for any
+// in-flight requests (including route actions that have outlived their
+// timeout) to finish, or for the context to be cancelled — in which case any
+// connections that are still open are closed, the contexts of any requests
+// that are still running are cancelled, and the errors from every listener
+// are returned together
+func (server *Server) Shutdown(ctx context.Context) error {
+
+	server.lifecycleLock.Lock()
+
+	server.shuttingDown = true
+	httpServers := server.httpServers
+	cancelBase := server.cancelBase
+	server.httpServers = nil
+
+	server.lifecycleLock.Unlock()
+
+	if cancelBase == nil {
+		cancelBase = func() {}
+	}
+
+	// Every HTTP server stops accepting connections at the same time, and any
+	// connections still active once the context is done are closed
+	errs := make([]error, len(httpServers))
+	group := sync.WaitGroup{}
+
+	for i, httpServer := range httpServers {
+
+		group.Add(1)
+
+		go func(i int, httpServer *http.Server) {
+
+			defer group.Done()
+
+			if errs[i] = httpServer.Shutdown(ctx); errs[i] != nil {
+				httpServer.Close()
 			}
 
-		}
+		}(i, httpServer)
+
+	}
+
+	group.Wait()
+
+	err := joinErrors(errs)
+
+	if err == nil {
+		err = server.waitForRequestsUntil(ctx)
+	}
+
+	cancelBase()
+
+	return err
+
+}
 
+// waitForRequestsUntil waits for any in-flight requests to finish, or for the
+// context to be done
+func (server *Server) waitForRequestsUntil(ctx context.Context) error {
+
+	finished := make(chan struct{})
+
+	go func() {
+		server.waitForRequests()
+		close(finished)
 	}()
 
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+}
+
+// shutdownErrors are the errors from shutting down several HTTP servers
+type shutdownErrors []error
+
+// Error lists the errors
+func (errs shutdownErrors) Error() string {
+
+	messages := make([]string, len(errs))
+
+	for i, err := range errs {
+		messages[i] = err.Error()
+	}
+
+	return strings.Join(messages, "; ")
+
+}
+
+// Is checks whether any of the errors matches a target, so that errors.Is can
+// be used with the combined error
+func (errs shutdownErrors) Is(target error) bool {
+
+	for _, err := range errs {
+
+		if errors.Is(err, target) {
+			return true
+		}
+
+	}
+
+	return false
+
+}
+
+// joinErrors combines the non-nil errors in a list, returning nil if there
+// are none and the error itself if there is only one
+func joinErrors(errs []error) error {
+
+	combined := shutdownErrors{}
+
+	for _, err := range errs {
+
+		if err != nil {
+			combined = append(combined, err)
+		}
+
+	}
+
+	switch len(combined) {
+	case 0:
+		return nil
+	case 1:
+		return combined[0]
+	}
+
+	return combined
+
+}
+
+// startRequest records that a request (or a route action that may outlive its
+// request) has started, so that a shutdown can wait for it to finish
+func (server *Server) startRequest() {
+
+	server.inFlightLock.Lock()
+	defer server.inFlightLock.Unlock()
+
+	server.inFlight++
+
+}
+
+// finishRequest records that a request has finished, waking any shutdown that
+// is waiting for the last one
+func (server *Server) finishRequest() {
+
+	server.inFlightLock.Lock()
+	defer server.inFlightLock.Unlock()
+
+	server.inFlight--
+
+	if server.inFlight == 0 && server.inFlightDone != nil {
+		server.inFlightDone.Broadcast()
+	}
+
+}
+
+// waitForRequests blocks until there are no in-flight requests. Unlike a
+// sync.WaitGroup, requests can safely start while it is waiting, such as when
+// ServeHTTP is called directly during a shutdown
+func (server *Server) waitForRequests() {
+
+	server.inFlightLock.Lock()
+	defer server.inFlightLock.Unlock()
+
+	if server.inFlightDone == nil {
+		server.inFlightDone = sync.NewCond(&server.inFlightLock)
+	}
+
+	for server.inFlight > 0 {
+		server.inFlightDone.Wait()
+	}
+
+}
+
+// newHTTPServer creates and keeps track of a HTTP server that will route
+// requests through this server
+func (server *Server) newHTTPServer(useTLS bool) (*http.Server, error) {
+
+	httpServer := &http.Server{Handler: server}
+
+	// HTTPS requests
+	if useTLS {
+
+		certificate, err := tls.LoadX509KeyPair(server.CertPath, server.KeyPath)
+
+		if err != nil {
+			return nil, err
+		}
+
+		httpServer.TLSConfig = &tls.Config{
+			Certificates: []tls.Certificate{certificate},
+			MinVersion:   tls.VersionTLS12,
+		}
+
+	}
+
+	server.lifecycleLock.Lock()
+	defer server.lifecycleLock.Unlock()
+
+	if server.shuttingDown {
+		return nil, http.ErrServerClosed
+	}
+
+	if server.serveErrors == nil {
+		server.serveErrors = make(chan error, 1)
+	}
+
+	// Requests are given a context that can be cancelled if they are still
+	// running when a shutdown gives up waiting for them
+	if server.baseContext == nil {
+		server.baseContext, server.cancelBase = context.WithCancel(context.Background())
+	}
+
+	baseContext := server.baseContext
+	httpServer.BaseContext = func(listener net.Listener) context.Context {
+		return baseContext
+	}
+
+	server.httpServers = append(server.httpServers, httpServer)
+
+	return httpServer, nil
+
+}
+
+// serveListener serves requests from a listener until the HTTP server is shut
+// down or fails
+func serveListener(httpServer *http.Server, listener net.Listener) error {
+
+	if httpServer.TLSConfig != nil {
+		return httpServer.ServeTLS(listener, "", "")
+	}
+
+	return httpServer.Serve(listener)
+
+}
+
+// reportServeError passes an error from a background listener to Run, or logs
+// it if nothing is waiting for it
+func (server *Server) reportServeError(err error) {
+
+	select {
+	case server.serveErrors <- err:
+	default:
+		log.Println(err)
+	}
+
 }
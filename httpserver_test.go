@@ -1,9 +1,19 @@
 package jsonserver
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 // TestEnableTLSFailsWithBadCertPath tests that the server fails to start if an
@@ -32,7 +42,7 @@ func TestServerCanListenHTTPS(t *testing.T) {
 
 	testRouteSetUp()
 
-	response, err := http.Get("https://127.0.0.1:9999/")
+	response, err := http.Get(TestServerHTTPSURL + "/")
 
 	if err != nil {
 
@@ -70,7 +80,7 @@ func TestServerCanListenHTTP(t *testing.T) {
 
 	testRouteSetUp()
 
-	response, err := http.Get("http://127.0.0.1:9998/")
+	response, err := http.Get(TestServerHTTPURL + "/")
 
 	if err != nil {
 
@@ -108,7 +118,7 @@ func TestServerTimesOutHTTPS(t *testing.T) {
 
 	testRouteSetUp()
 
-	response, _ := http.Get("https://127.0.0.1:9999/timeout")
+	response, _ := http.Get(TestServerHTTPSURL + "/timeout")
 
 	if response.StatusCode != 503 {
 		t.Errorf("Request did not timeout like expected")
@@ -124,7 +134,7 @@ func TestServerTimesOutHTTP(t *testing.T) {
 
 	testRouteSetUp()
 
-	response, _ := http.Get("http://127.0.0.1:9998/timeout")
+	response, _ := http.Get(TestServerHTTPURL + "/timeout")
 
 	if response.StatusCode != 503 {
 		t.Errorf("Request did not timeout like expected")
@@ -139,7 +149,7 @@ func TestServerReturnsNotFound(t *testing.T) {
 
 	testRouteSetUp()
 
-	response, err := http.Get("https://127.0.0.1:9999/404")
+	response, err := http.Get(TestServerHTTPSURL + "/404")
 
 	if err != nil {
 
@@ -181,7 +191,7 @@ func TestServerReturnsOutputFromDenyingMiddleware(t *testing.T) {
 
 	testRouteSetUp()
 
-	response, err := http.Get("https://127.0.0.1:9999/middleware_deny")
+	response, err := http.Get(TestServerHTTPSURL + "/middleware_deny")
 
 	if err != nil {
 
@@ -217,3 +227,794 @@ func TestServerReturnsOutputFromDenyingMiddleware(t *testing.T) {
 	testRouteTearDown()
 
 }
+
+// TestStartReturnsListenError tests that the server reports a port that is
+// already in use rather than exiting
+func TestStartReturnsListenError(t *testing.T) {
+
+	listener, err := net.Listen("tcp", ":0")
+
+	if err != nil {
+		t.Fatalf("Unable to reserve a port")
+	}
+
+	defer listener.Close()
+
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	if NewServer().Start(port, 5) == nil {
+		t.Errorf("Server unexpectedly started on a port that is in use")
+	}
+
+}
+
+// TestShutdownWaitsForInFlightActions tests that shutting down the server
+// waits for running route actions to finish
+func TestShutdownWaitsForInFlightActions(t *testing.T) {
+
+	var finished int32
+
+	server := NewServer()
+	port := testFreePort(t)
+
+	server.RegisterRoute("GET", "/slow", []Middleware{}, func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) {
+		time.Sleep(500 * time.Millisecond)
+		atomic.StoreInt32(&finished, 1)
+		response.Write([]byte("GET /slow"))
+	})
+
+	if err := server.Start(port, 5); err != nil {
+		t.Fatalf("Unable to start server: %v", err)
+	}
+
+	responseCode := make(chan int, 1)
+
+	go func() {
+
+		response, err := http.Get("http://127.0.0.1:" + strconv.Itoa(port) + "/slow")
+
+		if err != nil {
+			responseCode <- 0
+			return
+		}
+
+		response.Body.Close()
+		responseCode <- response.StatusCode
+
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+
+	if err := server.Shutdown(context.Background()); err != nil {
+		t.Errorf("Unexpected error when shutting down: %v", err)
+	}
+
+	if atomic.LoadInt32(&finished) != 1 {
+		t.Errorf("Shutdown returned before the route action finished")
+	}
+
+	if code := <-responseCode; code != http.StatusOK {
+		t.Errorf("In-flight request was not completed (status code: %v)", code)
+	}
+
+	if server.Start(port, 5) == nil {
+		t.Errorf("Server unexpectedly restarted after shutting down")
+	}
+
+}
+
+// TestShutdownHonoursContext tests that shutting down gives up waiting for
+// route actions once its context is done
+func TestShutdownHonoursContext(t *testing.T) {
+
+	server := NewServer()
+	port := testFreePort(t)
+
+	server.RegisterRoute("GET", "/slow", []Middleware{}, func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) {
+		time.Sleep(2 * time.Second)
+	})
+
+	if err := server.Start(port, 5); err != nil {
+		t.Fatalf("Unable to start server: %v", err)
+	}
+
+	go http.Get("http://127.0.0.1:" + strconv.Itoa(port) + "/slow")
+
+	time.Sleep(100 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if server.Shutdown(ctx) == nil {
+		t.Errorf("Shutdown did not report that in-flight requests were abandoned")
+	}
+
+}
+
+// TestShutdownStopsEveryListener tests that giving up waiting for a request on
+// one address still stops the server listening on every other address
+func TestShutdownStopsEveryListener(t *testing.T) {
+
+	server := NewServer()
+	ports := []int{testFreePort(t), testFreePort(t)}
+	release := make(chan struct{})
+
+	defer close(release)
+
+	server.RegisterRoute("GET", "/slow", []Middleware{}, func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) {
+		<-release
+	})
+
+	server.RegisterRoute("GET", "/fast", []Middleware{}, func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) {})
+
+	for _, port := range ports {
+
+		if err := server.Listen("tcp", "127.0.0.1:"+strconv.Itoa(port), false); err != nil {
+			t.Fatalf("Unable to listen: %v", err)
+		}
+
+	}
+
+	go http.Get("http://127.0.0.1:" + strconv.Itoa(ports[0]) + "/slow")
+
+	time.Sleep(100 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Shutdown did not report that in-flight requests were abandoned (error: %v)", err)
+	}
+
+	for _, port := range ports {
+
+		if response, err := http.Get("http://127.0.0.1:" + strconv.Itoa(port) + "/fast"); err == nil {
+			response.Body.Close()
+			t.Errorf("Server is still serving requests on port %v after shutting down", port)
+		}
+
+	}
+
+}
+
+// TestRunStopsWhenContextIsCancelled tests that a running server shuts down
+// when its context is cancelled
+func TestRunStopsWhenContextIsCancelled(t *testing.T) {
+
+	server := NewServer()
+	port := testFreePort(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error, 1)
+
+	go func() {
+		result <- server.Run(ctx, port, 5)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+
+	select {
+
+	case err := <-result:
+
+		if err != nil {
+			t.Errorf("Unexpected error when running server: %v", err)
+		}
+
+	case <-time.After(5 * time.Second):
+
+		t.Errorf("Server did not stop when its context was cancelled")
+
+	}
+
+}
+
+// TestRunGivesUpWaitingAfterShutdownTimeout tests that a running server stops
+// waiting for a hung route action once its shutdown timeout has passed
+func TestRunGivesUpWaitingAfterShutdownTimeout(t *testing.T) {
+
+	server := NewServer()
+	port := testFreePort(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error, 1)
+	release := make(chan struct{})
+
+	defer close(release)
+
+	server.ShutdownTimeout = 200 * time.Millisecond
+
+	server.RegisterRoute("GET", "/hung", []Middleware{}, func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) {
+		<-release
+	})
+
+	go func() {
+		result <- server.Run(ctx, port, 0)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+
+	go http.Get("http://127.0.0.1:" + strconv.Itoa(port) + "/hung")
+
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+
+	select {
+
+	case err := <-result:
+
+		if err == nil {
+			t.Errorf("Run did not report that in-flight requests were abandoned")
+		}
+
+	case <-time.After(5 * time.Second):
+
+		t.Errorf("Run did not stop when its shutdown timeout passed")
+
+	}
+
+}
+
+// TestServeHTTPDuringShutdown tests that requests handled directly while the
+// server is shutting down are waited for
+func TestServeHTTPDuringShutdown(t *testing.T) {
+
+	var slowFinished int32
+
+	server := NewServer()
+	finished := make(chan struct{})
+
+	server.RegisterRoute("GET", "/slow", []Middleware{}, func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) {
+		time.Sleep(200 * time.Millisecond)
+		atomic.StoreInt32(&slowFinished, 1)
+	})
+
+	go func() {
+
+		for i := 0; i < 20; i++ {
+			server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+		}
+
+		close(finished)
+
+	}()
+
+	go server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/slow", nil))
+
+	time.Sleep(50 * time.Millisecond)
+
+	if err := server.Shutdown(context.Background()); err != nil {
+		t.Errorf("Unexpected error when shutting down: %v", err)
+	}
+
+	if atomic.LoadInt32(&slowFinished) != 1 {
+		t.Errorf("Shutdown returned before the route action finished")
+	}
+
+	<-finished
+
+}
+
+// TestRunReturnsListenError tests that running a server on a port that is
+// already in use returns an error
+func TestRunReturnsListenError(t *testing.T) {
+
+	listener, err := net.Listen("tcp", ":0")
+
+	if err != nil {
+		t.Fatalf("Unable to reserve a port")
+	}
+
+	defer listener.Close()
+
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	if NewServer().Run(context.Background(), port, 5) == nil {
+		t.Errorf("Server unexpectedly ran on a port that is in use")
+	}
+
+}
+
+// TestServeReturnsWhenShutDown tests serving on a caller-supplied listener
+// until the server is shut down
+func TestServeReturnsWhenShutDown(t *testing.T) {
+
+	server := testIndexServer()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatalf("Unable to create listener")
+	}
+
+	result := make(chan error, 1)
+
+	go func() {
+		result <- server.Serve(listener)
+	}()
+
+	if body := testGetBody(t, http.DefaultClient, "http://"+listener.Addr().String()+"/"); body != "GET /" {
+		t.Errorf("Could not reach route")
+	}
+
+	server.Shutdown(context.Background())
+
+	if err := <-result; err != http.ErrServerClosed {
+		t.Errorf("Unexpected error when serving (expected: %v, actual: %v)", http.ErrServerClosed, err)
+	}
+
+}
+
+// TestServeTLSFailsWithoutCertificate tests that serving TLS connections is
+// not possible before TLS has been enabled
+func TestServeTLSFailsWithoutCertificate(t *testing.T) {
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatalf("Unable to create listener")
+	}
+
+	if NewServer().ServeTLS(listener) == nil {
+		t.Errorf("Server unexpectedly served TLS connections without a certificate")
+	}
+
+}
+
+// TestListenOnMultipleAddresses tests serving the same routes over HTTPS, HTTP
+// and a Unix domain socket at once
+func TestListenOnMultipleAddresses(t *testing.T) {
+
+	server := testIndexServer()
+	httpsPort := testFreePort(t)
+	httpPort := testFreePort(t)
+	socketPath := filepath.Join(t.TempDir(), "jsonserver.sock")
+
+	server.EnableTLS("./test.crt", "./test.key")
+
+	if err := server.Listen("tcp", "127.0.0.1:"+strconv.Itoa(httpsPort), true); err != nil {
+		t.Fatalf("Unable to listen for HTTPS connections: %v", err)
+	}
+
+	if err := server.Listen("tcp", "127.0.0.1:"+strconv.Itoa(httpPort), false); err != nil {
+		t.Fatalf("Unable to listen for HTTP connections: %v", err)
+	}
+
+	if err := server.Listen("unix", socketPath, false); err != nil {
+		t.Fatalf("Unable to listen on Unix socket: %v", err)
+	}
+
+	defer server.Shutdown(context.Background())
+
+	socketClient := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network string, address string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socketPath)
+		},
+	}}
+
+	tlsClient := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+
+	if body := testGetBody(t, tlsClient, "https://127.0.0.1:"+strconv.Itoa(httpsPort)+"/"); body != "GET /" {
+		t.Errorf("Could not reach route over HTTPS")
+	}
+
+	if body := testGetBody(t, http.DefaultClient, "http://127.0.0.1:"+strconv.Itoa(httpPort)+"/"); body != "GET /" {
+		t.Errorf("Could not reach route over HTTP")
+	}
+
+	if body := testGetBody(t, socketClient, "http://unix/"); body != "GET /" {
+		t.Errorf("Could not reach route over Unix socket")
+	}
+
+}
+
+// testMethodServer creates a server with routes registered against a variety
+// of methods
+func testMethodServer() *Server {
+
+	server := NewServer()
+
+	server.RegisterRoute("GET|PUT", "/products/{id}", []Middleware{}, func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) {
+		response.Header().Set("X-Method", request.Method)
+		response.Write([]byte(request.Method + " /products/{id}"))
+	})
+
+	server.RegisterRoute("POST", "/products", []Middleware{}, func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) {
+		response.Write([]byte("POST /products"))
+	})
+
+	server.RegisterRoute("OPTIONS", "/products", []Middleware{}, func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) {
+		response.Write([]byte("OPTIONS /products"))
+	})
+
+	return server
+
+}
+
+// TestServerReturnsMethodNotAllowed tests receiving a 405 response listing the
+// allowed methods when a path exists under other methods
+func TestServerReturnsMethodNotAllowed(t *testing.T) {
+
+	response := testRequest(testMethodServer(), "DELETE", "/products/123", nil, nil)
+
+	if response.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Incorrect status code (expected: %v, actual: %v)", http.StatusMethodNotAllowed, response.Code)
+	}
+
+	if response.Header().Get("Allow") != "GET, HEAD, OPTIONS, PUT" {
+		t.Errorf("Incorrect Allow header (expected: %v, actual: %v)", "GET, HEAD, OPTIONS, PUT", response.Header().Get("Allow"))
+	}
+
+	if response.Body.String() != `{"message":"Method not allowed","success":false}` {
+		t.Errorf("Route did not return 'method not allowed' message")
+	}
+
+}
+
+// TestServerAnswersHeadFromGetRoute tests that HEAD requests are answered by
+// GET routes without a body
+func TestServerAnswersHeadFromGetRoute(t *testing.T) {
+
+	response := testRequest(testMethodServer(), "HEAD", "/products/123", nil, nil)
+
+	if response.Code != http.StatusOK {
+		t.Errorf("Incorrect status code (expected: %v, actual: %v)", http.StatusOK, response.Code)
+	}
+
+	if response.Header().Get("X-Method") != "HEAD" {
+		t.Errorf("GET route did not handle HEAD request")
+	}
+
+	if response.Body.String() != "" {
+		t.Errorf("HEAD response unexpectedly had a body")
+	}
+
+}
+
+// TestServerAnswersOptions tests that OPTIONS requests are answered
+// automatically unless an OPTIONS route has been registered
+func TestServerAnswersOptions(t *testing.T) {
+
+	server := testMethodServer()
+	response := testRequest(server, "OPTIONS", "/products/123", nil, nil)
+
+	if response.Code != http.StatusNoContent {
+		t.Errorf("Incorrect status code (expected: %v, actual: %v)", http.StatusNoContent, response.Code)
+	}
+
+	if response.Header().Get("Allow") != "GET, HEAD, OPTIONS, PUT" {
+		t.Errorf("Incorrect Allow header (expected: %v, actual: %v)", "GET, HEAD, OPTIONS, PUT", response.Header().Get("Allow"))
+	}
+
+	response = httptest.NewRecorder()
+
+	server.ServeHTTP(response, httptest.NewRequest("OPTIONS", "/products", nil))
+
+	if response.Body.String() != "OPTIONS /products" {
+		t.Errorf("Registered OPTIONS route did not execute")
+	}
+
+	response = httptest.NewRecorder()
+
+	server.ServeHTTP(response, httptest.NewRequest("OPTIONS", "/categories", nil))
+
+	if response.Code != http.StatusNotFound {
+		t.Errorf("Incorrect status code (expected: %v, actual: %v)", http.StatusNotFound, response.Code)
+	}
+
+}
+
+// TestServerMiddlewareRunsOnEveryRequest tests that server middleware runs on
+// requests that match a route, do not match a route and are denied by route
+// middleware
+func TestServerMiddlewareRunsOnEveryRequest(t *testing.T) {
+
+	var calls int32
+
+	server := NewServer()
+
+	server.Use(func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) (bool, int) {
+		atomic.AddInt32(&calls, 1)
+		ctx.Value("state").(*RequestState).Set("server", "ran")
+		return true, 0
+	})
+
+	server.RegisterRoute("GET", "/allow", []Middleware{}, func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) {
+		response.Write([]byte("GET /allow " + ctx.Value("state").(*RequestState).Get("server").(string)))
+	})
+
+	server.RegisterRoute("GET", "/deny", []Middleware{func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) (bool, int) {
+		return false, 403
+	}}, func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) {})
+
+	response := testRequest(server, "GET", "/allow", nil, nil)
+
+	if response.Body.String() != "GET /allow ran" {
+		t.Errorf("Route did not share request state with server middleware")
+	}
+
+	server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/deny", nil))
+	server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/404", nil))
+
+	if atomic.LoadInt32(&calls) != 3 {
+		t.Errorf("Server middleware call count mismatch (expected: %v, actual: %v)", 3, atomic.LoadInt32(&calls))
+	}
+
+}
+
+// TestServerMiddlewareDeniesRequest tests that server middleware can deny
+// requests before any route runs
+func TestServerMiddlewareDeniesRequest(t *testing.T) {
+
+	server := NewServer()
+	routeRan := false
+
+	server.Use(func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) (bool, int) {
+		return false, 429
+	})
+
+	server.RegisterRoute("GET", "/", []Middleware{}, func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) {
+		routeRan = true
+	})
+
+	response := testRequest(server, "GET", "/", nil, nil)
+
+	if routeRan {
+		t.Errorf("Route ran despite server middleware denying access")
+	}
+
+	if response.Code != 429 || response.Body.String() != `{"message":"Access denied","success":false}` {
+		t.Errorf("Server middleware denial was not returned")
+	}
+
+}
+
+// TestServerWrappersRunAroundEveryRequest tests that server wrappers run before
+// and after the handling of every request, outermost first
+func TestServerWrappersRunAroundEveryRequest(t *testing.T) {
+
+	server := NewServer()
+	order := []string{}
+
+	wrapper := func(name string) Wrapper {
+
+		return func(next RouteAction) RouteAction {
+
+			return func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) {
+				order = append(order, "before "+name)
+				response.Header().Set("X-"+name, "set")
+				next(ctx, request, response, body)
+				order = append(order, "after "+name)
+			}
+
+		}
+
+	}
+
+	server.Wrap(wrapper("outer"), wrapper("inner"))
+
+	response := testRequest(server, "GET", "/404", nil, nil)
+
+	if strings.Join(order, ", ") != "before outer, before inner, after inner, after outer" {
+		t.Errorf("Wrapper order mismatch (actual: %v)", order)
+	}
+
+	if response.Header().Get("X-outer") != "set" || response.Header().Get("X-inner") != "set" || response.Code != http.StatusNotFound {
+		t.Errorf("Wrappers did not wrap the 'not found' response")
+	}
+
+}
+
+// TestServerRecoversFromPanics tests that panics in actions and middleware
+// result in an error response and are reported to the OnPanic hook
+func TestServerRecoversFromPanics(t *testing.T) {
+
+	server := NewServer()
+	reported := []interface{}{}
+	stacks := []string{}
+
+	server.OnPanic = func(ctx context.Context, request *http.Request, recovered interface{}, stack []byte) {
+		reported = append(reported, recovered)
+		stacks = append(stacks, string(stack))
+	}
+
+	server.RegisterRoute("GET", "/action", []Middleware{}, func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) {
+		panic("action panic")
+	})
+
+	server.RegisterRoute("GET", "/middleware", []Middleware{func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) (bool, int) {
+		panic("middleware panic")
+	}}, func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) {})
+
+	for _, path := range []string{"/action", "/middleware"} {
+
+		response := testRequest(server, "GET", path, nil, nil)
+
+		if response.Code != http.StatusInternalServerError {
+			t.Errorf("Incorrect status code for %v (expected: %v, actual: %v)", path, http.StatusInternalServerError, response.Code)
+		}
+
+		if response.Body.String() != `{"message":"Internal server error","success":false}` {
+			t.Errorf("Incorrect body for %v (actual: %v)", path, response.Body.String())
+		}
+
+	}
+
+	if len(reported) != 2 || reported[0] != "action panic" || reported[1] != "middleware panic" {
+		t.Errorf("Panics were not reported (actual: %v)", reported)
+	}
+
+	if len(stacks) != 2 || !strings.Contains(stacks[0], "TestServerRecoversFromPanics") {
+		t.Errorf("Panic stack was not reported")
+	}
+
+}
+
+// TestServerAbortsPartialResponseOnPanic tests that a panic after part of the
+// response has been sent aborts the response rather than appending an error
+func TestServerAbortsPartialResponseOnPanic(t *testing.T) {
+
+	server := NewServer()
+	reported := []interface{}{}
+
+	server.OnPanic = func(ctx context.Context, request *http.Request, recovered interface{}, stack []byte) {
+		reported = append(reported, recovered)
+	}
+
+	server.RegisterRoute("GET", "/", []Middleware{}, func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) {
+		response.Write([]byte(`{"partial":`))
+		panic("action panic")
+	})
+
+	response := httptest.NewRecorder()
+
+	defer func() {
+
+		if recover() != http.ErrAbortHandler {
+			t.Errorf("Partial response was not aborted")
+		}
+
+		if response.Body.String() != `{"partial":` {
+			t.Errorf("Error was appended to the partial response (actual: %v)", response.Body.String())
+		}
+
+		if len(reported) != 1 || reported[0] != "action panic" {
+			t.Errorf("Panic was not reported (actual: %v)", reported)
+		}
+
+	}()
+
+	server.ServeHTTP(response, httptest.NewRequest("GET", "/", nil))
+
+}
+
+// TestServerDoesNotRecoverFromAbort tests that deliberately aborting a
+// response is left to net/http
+func TestServerDoesNotRecoverFromAbort(t *testing.T) {
+
+	server := NewServer()
+
+	server.RegisterRoute("GET", "/", []Middleware{}, func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) {
+		panic(http.ErrAbortHandler)
+	})
+
+	defer func() {
+
+		if recover() != http.ErrAbortHandler {
+			t.Errorf("Abort was unexpectedly recovered")
+		}
+
+	}()
+
+	server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+}
+
+// TestClientDisconnectCancelsContext tests that the context passed to an
+// action is cancelled when the client goes away
+func TestClientDisconnectCancelsContext(t *testing.T) {
+
+	server := NewServer()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	cancelled := make(chan error, 1)
+
+	if err != nil {
+		t.Fatalf("Unable to create listener")
+	}
+
+	server.RegisterRoute("GET", "/slow", []Middleware{}, func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) {
+
+		select {
+		case <-ctx.Done():
+			cancelled <- ctx.Err()
+		case <-time.After(5 * time.Second):
+			cancelled <- nil
+		}
+
+	})
+
+	go server.Serve(listener)
+	defer server.Shutdown(context.Background())
+
+	client := &http.Client{Timeout: 100 * time.Millisecond}
+
+	client.Get("http://" + listener.Addr().String() + "/slow")
+
+	if err := <-cancelled; err != context.Canceled {
+		t.Errorf("Context was not cancelled (expected: %v, actual: %v)", context.Canceled, err)
+	}
+
+}
+
+// TestShutdownCancelsContextWhenAbandoningRequests tests that the contexts of
+// requests still running when a shutdown gives up waiting are cancelled
+func TestShutdownCancelsContextWhenAbandoningRequests(t *testing.T) {
+
+	server := NewServer()
+	port := testFreePort(t)
+	cancelled := make(chan error, 1)
+
+	server.RegisterRoute("GET", "/slow", []Middleware{}, func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) {
+
+		select {
+		case <-ctx.Done():
+			cancelled <- ctx.Err()
+		case <-time.After(5 * time.Second):
+			cancelled <- nil
+		}
+
+	})
+
+	if err := server.Start(port, 30); err != nil {
+		t.Fatalf("Unable to start server: %v", err)
+	}
+
+	go http.Get("http://127.0.0.1:" + strconv.Itoa(port) + "/slow")
+
+	time.Sleep(100 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	server.Shutdown(ctx)
+
+	if err := <-cancelled; err != context.Canceled {
+		t.Errorf("Context was not cancelled (expected: %v, actual: %v)", context.Canceled, err)
+	}
+
+}
+
+// testGetBody makes a GET request and returns the response body
+func testGetBody(t *testing.T, client *http.Client, url string) string {
+
+	response, err := client.Get(url)
+
+	if err != nil {
+		t.Errorf("Unable to make request: %v", err)
+		return ""
+	}
+
+	defer response.Body.Close()
+
+	body, err := ioutil.ReadAll(response.Body)
+
+	if err != nil {
+		t.Errorf("Unexpected error thrown when attempting to read response")
+	}
+
+	return string(body)
+
+}
+
+// testFreePort finds a port that is not currently in use
+func testFreePort(t *testing.T) int {
+
+	listener, err := net.Listen("tcp", ":0")
+
+	if err != nil {
+		t.Fatalf("Unable to find a free port")
+	}
+
+	defer listener.Close()
+
+	return listener.Addr().(*net.TCPAddr).Port
+
+}
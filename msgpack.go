@@ -0,0 +1,417 @@
+package jsonserver
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// MessagePackCodec encodes and decodes MessagePack. Values are converted by
+// way of JSON, so they honour the same struct tags as JSON, and []byte values
+// are encoded as base64 strings (while binary values in request bodies can be
+// decoded into []byte fields)
+type MessagePackCodec struct{}
+
+// errMessagePackTruncated is returned when MessagePack ends part way through
+// a value
+var errMessagePackTruncated = errors.New("messagepack: unexpected end of data")
+
+// ContentType is the Content-Type header sent with MessagePack responses
+func (codec MessagePackCodec) ContentType() string {
+
+	return "application/msgpack"
+
+}
+
+// MediaTypes lists the media types of MessagePack
+func (codec MessagePackCodec) MediaTypes() []string {
+
+	return []string{"application/msgpack", "application/x-msgpack", "application/vnd.msgpack"}
+
+}
+
+// Encode encodes a value as MessagePack
+func (codec MessagePackCodec) Encode(value interface{}) ([]byte, error) {
+
+	tree, err := toTree(value)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return appendMessagePack([]byte{}, tree), nil
+
+}
+
+// Decode decodes MessagePack into a value
+func (codec MessagePackCodec) Decode(body []byte, value interface{}) error {
+
+	decoder := messagePackDecoder{data: body}
+	tree, err := decoder.decode(0)
+
+	if err != nil {
+		return err
+	}
+
+	if decoder.offset != len(body) {
+		return errors.New("messagepack: unexpected data after value")
+	}
+
+	return fromTree(tree, value)
+
+}
+
+// appendMessagePack appends the MessagePack encoding of a tree to a buffer
+func appendMessagePack(buffer []byte, tree interface{}) []byte {
+
+	switch node := tree.(type) {
+
+	case nil:
+
+		return append(buffer, 0xc0)
+
+	case bool:
+
+		if node {
+			return append(buffer, 0xc3)
+		}
+
+		return append(buffer, 0xc2)
+
+	case int64:
+
+		return appendMessagePackInt(buffer, node)
+
+	case uint64:
+
+		return binary.BigEndian.AppendUint64(append(buffer, 0xcf), node)
+
+	case float64:
+
+		return binary.BigEndian.AppendUint64(append(buffer, 0xcb), math.Float64bits(node))
+
+	case string:
+
+		length := len(node)
+
+		switch {
+		case length < 32:
+			buffer = append(buffer, 0xa0|byte(length))
+		case length <= math.MaxUint8:
+			buffer = append(buffer, 0xd9, byte(length))
+		case length <= math.MaxUint16:
+			buffer = binary.BigEndian.AppendUint16(append(buffer, 0xda), uint16(length))
+		default:
+			buffer = binary.BigEndian.AppendUint32(append(buffer, 0xdb), uint32(length))
+		}
+
+		return append(buffer, node...)
+
+	case []interface{}:
+
+		buffer = appendMessagePackLength(buffer, len(node), 0x90, 0xdc)
+
+		for _, value := range node {
+			buffer = appendMessagePack(buffer, value)
+		}
+
+		return buffer
+
+	case map[string]interface{}:
+
+		buffer = appendMessagePackLength(buffer, len(node), 0x80, 0xde)
+
+		for _, key := range sortedKeys(node) {
+			buffer = appendMessagePack(buffer, key)
+			buffer = appendMessagePack(buffer, node[key])
+		}
+
+		return buffer
+
+	}
+
+	panic(fmt.Sprintf("messagepack: cannot encode %T", tree))
+
+}
+
+// appendMessagePackInt appends the smallest MessagePack encoding of an integer
+func appendMessagePackInt(buffer []byte, integer int64) []byte {
+
+	switch {
+	case integer >= 0 && integer <= math.MaxInt8:
+		return append(buffer, byte(integer))
+	case integer >= -32 && integer < 0:
+		return append(buffer, byte(integer))
+	case integer >= 0 && integer <= math.MaxUint8:
+		return append(buffer, 0xcc, byte(integer))
+	case integer >= 0 && integer <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(buffer, 0xcd), uint16(integer))
+	case integer >= 0 && integer <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(buffer, 0xce), uint32(integer))
+	case integer >= 0:
+		return binary.BigEndian.AppendUint64(append(buffer, 0xcf), uint64(integer))
+	case integer >= math.MinInt8:
+		return append(buffer, 0xd0, byte(integer))
+	case integer >= math.MinInt16:
+		return binary.BigEndian.AppendUint16(append(buffer, 0xd1), uint16(integer))
+	case integer >= math.MinInt32:
+		return binary.BigEndian.AppendUint32(append(buffer, 0xd2), uint32(integer))
+	}
+
+	return binary.BigEndian.AppendUint64(append(buffer, 0xd3), uint64(integer))
+
+}
+
+// appendMessagePackLength appends the header of an array or map, using the
+// fixed form for small lengths
+func appendMessagePackLength(buffer []byte, length int, fixed byte, format byte) []byte {
+
+	if length < 16 {
+		return append(buffer, fixed|byte(length))
+	}
+
+	if length <= math.MaxUint16 {
+		return binary.BigEndian.AppendUint16(append(buffer, format), uint16(length))
+	}
+
+	return binary.BigEndian.AppendUint32(append(buffer, format+1), uint32(length))
+
+}
+
+// messagePackDecoder decodes MessagePack into a tree
+type messagePackDecoder struct {
+	data   []byte
+	offset int
+}
+
+// decode decodes the next value, where depth guards against deeply nested
+// data exhausting the stack
+func (decoder *messagePackDecoder) decode(depth int) (interface{}, error) {
+
+	if depth > maxDecodeDepth {
+		return nil, errors.New("messagepack: data is nested too deeply")
+	}
+
+	format, err := decoder.read(1)
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch code := format[0]; {
+
+	case code <= 0x7f:
+		return int64(code), nil
+	case code >= 0xe0:
+		return int64(int8(code)), nil
+	case code >= 0x80 && code <= 0x8f:
+		return decoder.decodeMap(int(code&0x0f), depth)
+	case code >= 0x90 && code <= 0x9f:
+		return decoder.decodeArray(int(code&0x0f), depth)
+	case code >= 0xa0 && code <= 0xbf:
+		return decoder.decodeString(int(code & 0x1f))
+
+	}
+
+	switch format[0] {
+
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		return decoder.decodeBinary(format[0] - 0xc4)
+	case 0xca:
+		bits, err := decoder.readUint(4)
+		return float64(math.Float32frombits(uint32(bits))), err
+	case 0xcb:
+		bits, err := decoder.readUint(8)
+		return math.Float64frombits(bits), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		return decoder.readUint(1 << (format[0] - 0xcc))
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		return decoder.readInt(1 << (format[0] - 0xd0))
+	case 0xd9, 0xda, 0xdb:
+		length, err := decoder.readUint(1 << (format[0] - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return decoder.decodeString(int(length))
+	case 0xdc, 0xdd:
+		length, err := decoder.readUint(2 << (format[0] - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return decoder.decodeArray(int(length), depth)
+	case 0xde, 0xdf:
+		length, err := decoder.readUint(2 << (format[0] - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return decoder.decodeMap(int(length), depth)
+
+	}
+
+	return nil, fmt.Errorf("messagepack: unsupported format 0x%02x", format[0])
+
+}
+
+// decodeString decodes a string of a given length
+func (decoder *messagePackDecoder) decodeString(length int) (interface{}, error) {
+
+	data, err := decoder.read(length)
+
+	return string(data), err
+
+}
+
+// decodeBinary decodes binary data whose length is stored in 1, 2 or 4 bytes
+// depending on the size class
+func (decoder *messagePackDecoder) decodeBinary(sizeClass byte) (interface{}, error) {
+
+	length, err := decoder.readUint(1 << sizeClass)
+
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := decoder.read(int(length))
+
+	return append([]byte{}, data...), err
+
+}
+
+// decodeArray decodes an array with a given number of elements
+func (decoder *messagePackDecoder) decodeArray(length int, depth int) (interface{}, error) {
+
+	// Every element takes at least a byte, so the length can be checked before
+	// allocating anything
+	if length > len(decoder.data)-decoder.offset {
+		return nil, errMessagePackTruncated
+	}
+
+	array := make([]interface{}, length)
+
+	for i := range array {
+
+		value, err := decoder.decode(depth + 1)
+
+		if err != nil {
+			return nil, err
+		}
+
+		array[i] = value
+
+	}
+
+	return array, nil
+
+}
+
+// decodeMap decodes a map with a given number of entries, converting scalar
+// keys to strings
+func (decoder *messagePackDecoder) decodeMap(length int, depth int) (interface{}, error) {
+
+	if length > len(decoder.data)-decoder.offset {
+		return nil, errMessagePackTruncated
+	}
+
+	node := make(map[string]interface{}, length)
+
+	for i := 0; i < length; i++ {
+
+		key, err := decoder.decode(depth + 1)
+
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := decoder.decode(depth + 1)
+
+		if err != nil {
+			return nil, err
+		}
+
+		stringKey, err := treeKey(key)
+
+		if err != nil {
+			return nil, err
+		}
+
+		node[stringKey] = value
+
+	}
+
+	return node, nil
+
+}
+
+// readUint reads a big-endian unsigned integer of a given number of bytes
+func (decoder *messagePackDecoder) readUint(size int) (uint64, error) {
+
+	data, err := decoder.read(size)
+
+	if err != nil {
+		return 0, err
+	}
+
+	integer := uint64(0)
+
+	for _, b := range data {
+		integer = integer<<8 | uint64(b)
+	}
+
+	return integer, nil
+
+}
+
+// readInt reads a big-endian signed integer of a given number of bytes
+func (decoder *messagePackDecoder) readInt(size int) (interface{}, error) {
+
+	integer, err := decoder.readUint(size)
+
+	if err != nil {
+		return nil, err
+	}
+
+	shift := uint(64 - size*8)
+
+	return int64(integer<<shift) >> shift, nil
+
+}
+
+// read reads a given number of bytes
+func (decoder *messagePackDecoder) read(size int) ([]byte, error) {
+
+	if size < 0 || size > len(decoder.data)-decoder.offset {
+		return nil, errMessagePackTruncated
+	}
+
+	data := decoder.data[decoder.offset : decoder.offset+size]
+	decoder.offset += size
+
+	return data, nil
+
+}
+
+// treeKey converts a decoded map key into a string, as JSON requires
+func treeKey(key interface{}) (string, error) {
+
+	switch value := key.(type) {
+	case string:
+		return value, nil
+	case int64:
+		return strconv.FormatInt(value, 10), nil
+	case uint64:
+		return strconv.FormatUint(value, 10), nil
+	case bool:
+		return strconv.FormatBool(value), nil
+	}
+
+	return "", fmt.Errorf("unsupported map key of type %T", key)
+
+}
@@ -0,0 +1,111 @@
+package jsonserver
+
+import (
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestMessagePackEncode tests encoding values as MessagePack
+func TestMessagePackEncode(t *testing.T) {
+
+	values := map[string]interface{}{
+		"82a16101a16292c3c0":              JSON{"a": 1, "b": []interface{}{true, nil}},
+		"ff":                              -1,
+		"7f":                              127,
+		"ccc8":                            200,
+		"d1ff38":                          -200,
+		"cdffff":                          65535,
+		"cfffffffffffffffff":              uint64(18446744073709551615),
+		"cb3ff8000000000000":              1.5,
+		"c2":                              false,
+		"a0":                              "",
+		"90":                              []int{},
+		"d928" + strings.Repeat("61", 40): strings.Repeat("a", 40),
+	}
+
+	for expected, value := range values {
+
+		encoded, err := MessagePackCodec{}.Encode(value)
+
+		if err != nil || hex.EncodeToString(encoded) != expected {
+			t.Errorf("Incorrect MessagePack for %v (expected: %v, actual: %x, error: %v)", value, expected, encoded, err)
+		}
+
+	}
+
+}
+
+// TestMessagePackDecode tests decoding MessagePack into values
+func TestMessagePackDecode(t *testing.T) {
+
+	type testDecoded struct {
+		Name   string   `json:"name"`
+		Count  int      `json:"count"`
+		Ratio  float64  `json:"ratio"`
+		Tags   []string `json:"tags"`
+		Binary []byte   `json:"binary"`
+	}
+
+	// {"name":"Chair","count":-3,"ratio":0.5 (float32),"tags":["a"],"binary":<0102>}
+	body, _ := hex.DecodeString("85a46e616d65a54368616972a5636f756e74fda5726174696fca3f000000a47461677391a161a662696e617279c4020102")
+	expected := testDecoded{Name: "Chair", Count: -3, Ratio: 0.5, Tags: []string{"a"}, Binary: []byte{1, 2}}
+	decoded := testDecoded{}
+
+	if err := (MessagePackCodec{}).Decode(body, &decoded); err != nil || !reflect.DeepEqual(decoded, expected) {
+		t.Errorf("MessagePack was not decoded correctly (expected: %v, actual: %v, error: %v)", expected, decoded, err)
+	}
+
+}
+
+// TestMessagePackRoundTrip tests that encoded values decode back to the same
+// value
+func TestMessagePackRoundTrip(t *testing.T) {
+
+	value := map[string]interface{}{
+		"integers": []interface{}{0.0, 1.0, -32.0, -33.0, 255.0, 70000.0, -70000.0, 5e9, -5e9},
+		"floats":   []interface{}{0.25, -1e100},
+		"strings":  []interface{}{"", strings.Repeat("x", 300), strings.Repeat("y", 70000)},
+		"nested":   map[string]interface{}{"list": make([]interface{}, 20), "map": map[string]interface{}{}},
+	}
+
+	encoded, err := MessagePackCodec{}.Encode(value)
+
+	if err != nil {
+		t.Fatalf("Unexpected error encoding MessagePack: %v", err)
+	}
+
+	decoded := map[string]interface{}{}
+
+	if err := (MessagePackCodec{}).Decode(encoded, &decoded); err != nil || !reflect.DeepEqual(decoded, value) {
+		t.Errorf("MessagePack did not round trip (error: %v)", err)
+	}
+
+}
+
+// TestMessagePackDecodeErrors tests that malformed MessagePack is rejected
+func TestMessagePackDecodeErrors(t *testing.T) {
+
+	bodies := []string{
+		"",
+		"a5616263",
+		"92c3",
+		"dcffff",
+		"c3c3",
+		"c1",
+		"81c0c0",
+	}
+
+	for _, body := range bodies {
+
+		data, _ := hex.DecodeString(body)
+		var decoded interface{}
+
+		if err := (MessagePackCodec{}).Decode(data, &decoded); err == nil {
+			t.Errorf("Malformed MessagePack %v was decoded as %v", body, decoded)
+		}
+
+	}
+
+}
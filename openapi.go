@@ -0,0 +1,342 @@
+package jsonserver
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// OpenAPIInfo describes the API in a generated OpenAPI document
+type OpenAPIInfo struct {
+	Title       string
+	Version     string
+	Description string
+}
+
+// QueryParam documents a query string parameter accepted by a route, where
+// the type is a JSON Schema type that defaults to string
+type QueryParam struct {
+	Name        string
+	Description string
+	Required    bool
+	Type        string
+}
+
+// RouteDocs holds the metadata used to document a route in a generated
+// OpenAPI document, where response types are keyed by HTTP code (with a nil
+// type for responses without a body)
+type RouteDocs struct {
+	Summary     string
+	Description string
+	Tags        []string
+	RequestBody reflect.Type
+	Responses   map[int]reflect.Type
+	QueryParams []QueryParam
+	Hidden      bool
+}
+
+// openAPIMethods are the methods that OpenAPI can document
+var openAPIMethods = map[string]bool{"GET": true, "PUT": true, "POST": true, "DELETE": true, "OPTIONS": true, "HEAD": true, "PATCH": true, "TRACE": true}
+
+// constraintSchemas are the schemas of route parameters with built-in
+// constraints
+var constraintSchemas = map[string]JSON{
+	"int":   {"type": "integer"},
+	"float": {"type": "number"},
+	"uuid":  {"type": "string", "format": "uuid"},
+	"date":  {"type": "string", "format": "date"},
+}
+
+// WithSummary documents a short summary of what a route does
+func WithSummary(summary string) RouteOption {
+
+	return func(route *Route) {
+		route.Docs.Summary = summary
+	}
+
+}
+
+// WithDescription documents a longer description of what a route does
+func WithDescription(description string) RouteOption {
+
+	return func(route *Route) {
+		route.Docs.Description = description
+	}
+
+}
+
+// WithTags documents tags that group a route with related routes
+func WithTags(tags ...string) RouteOption {
+
+	return func(route *Route) {
+		route.Docs.Tags = append(route.Docs.Tags, tags...)
+	}
+
+}
+
+// WithRequestBody documents the type of a route's request body, given as a
+// value of that type (such as Product{})
+func WithRequestBody(value interface{}) RouteOption {
+
+	return func(route *Route) {
+		route.Docs.RequestBody = reflect.TypeOf(value)
+	}
+
+}
+
+// WithResponse documents a response that a route can send, along with the
+// type of its body given as a value of that type (or nil if it has no body)
+func WithResponse(statusCode int, value interface{}) RouteOption {
+
+	return func(route *Route) {
+
+		if route.Docs.Responses == nil {
+			route.Docs.Responses = map[int]reflect.Type{}
+		}
+
+		route.Docs.Responses[statusCode] = reflect.TypeOf(value)
+
+	}
+
+}
+
+// WithQueryParams documents query string parameters that a route accepts
+func WithQueryParams(params ...QueryParam) RouteOption {
+
+	return func(route *Route) {
+		route.Docs.QueryParams = append(route.Docs.QueryParams, params...)
+	}
+
+}
+
+// WithoutDocs leaves a route out of generated OpenAPI documents
+func WithoutDocs() RouteOption {
+
+	return func(route *Route) {
+		route.Docs.Hidden = true
+	}
+
+}
+
+// OpenAPI generates an OpenAPI 3.1 document describing the registered routes,
+// with request and response bodies documented as JSON
+func (router *Router) OpenAPI(info OpenAPIInfo) JSON {
+
+	return router.openAPI(info, []string{"application/json"})
+
+}
+
+// OpenAPI generates an OpenAPI 3.1 document describing the registered routes,
+// with request and response bodies documented in every format that the
+// server's codecs handle
+func (server *Server) OpenAPI(info OpenAPIInfo) JSON {
+
+	mediaTypes := []string{}
+
+	for _, codec := range server.availableCodecs() {
+		mediaTypes = append(mediaTypes, codec.MediaTypes()[0])
+	}
+
+	return server.Router.openAPI(info, mediaTypes)
+
+}
+
+// ServeOpenAPI registers a GET route that serves an OpenAPI 3.1 document
+// describing the server's routes, generated when it is requested so that it
+// includes routes registered later on
+func (server *Server) ServeOpenAPI(path string, info OpenAPIInfo, middleware []Middleware) error {
+
+	return server.RegisterRoute("GET", path, middleware, func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) {
+
+		document := server.OpenAPI(info)
+
+		WriteResponse(response, &document, http.StatusOK)
+
+	}, WithoutDocs())
+
+}
+
+// openAPI generates an OpenAPI 3.1 document describing the registered routes,
+// with bodies documented in a number of media types
+func (router *Router) openAPI(info OpenAPIInfo, mediaTypes []string) JSON {
+
+	routes := router.load().routes
+	generator := newSchemaGenerator()
+	paths := JSON{}
+
+	for method, methodRoutes := range routes {
+
+		if !openAPIMethods[method] {
+			continue
+		}
+
+		for _, route := range methodRoutes {
+
+			if route.Docs.Hidden {
+				continue
+			}
+
+			path, pathParams := openAPIPath(route.Path)
+
+			if _, ok := paths[path]; !ok {
+				paths[path] = JSON{}
+			}
+
+			paths[path].(JSON)[strings.ToLower(method)] = generator.operation(route.Docs, pathParams, mediaTypes)
+
+		}
+
+	}
+
+	infoObject := JSON{"title": info.Title, "version": info.Version}
+
+	if info.Description != "" {
+		infoObject["description"] = info.Description
+	}
+
+	document := JSON{"openapi": "3.1.0", "info": infoObject, "paths": paths}
+
+	if len(generator.components) > 0 {
+		document["components"] = JSON{"schemas": generator.components}
+	}
+
+	return document
+
+}
+
+// operation builds the OpenAPI operation object for a route
+func (generator *schemaGenerator) operation(docs RouteDocs, pathParams []JSON, mediaTypes []string) JSON {
+
+	operation := JSON{}
+	parameters := append([]JSON{}, pathParams...)
+
+	for _, queryParam := range docs.QueryParams {
+
+		paramType := queryParam.Type
+
+		if paramType == "" {
+			paramType = "string"
+		}
+
+		parameter := JSON{"name": queryParam.Name, "in": "query", "required": queryParam.Required, "schema": JSON{"type": paramType}}
+
+		if queryParam.Description != "" {
+			parameter["description"] = queryParam.Description
+		}
+
+		parameters = append(parameters, parameter)
+
+	}
+
+	if len(parameters) > 0 {
+		operation["parameters"] = parameters
+	}
+
+	if docs.Summary != "" {
+		operation["summary"] = docs.Summary
+	}
+
+	if docs.Description != "" {
+		operation["description"] = docs.Description
+	}
+
+	if len(docs.Tags) > 0 {
+		operation["tags"] = docs.Tags
+	}
+
+	if docs.RequestBody != nil {
+		operation["requestBody"] = JSON{"required": true, "content": generator.content(docs.RequestBody, mediaTypes)}
+	}
+
+	if len(docs.Responses) > 0 {
+
+		responses := JSON{}
+
+		for statusCode, responseType := range docs.Responses {
+
+			description := http.StatusText(statusCode)
+
+			if description == "" {
+				description = "Response"
+			}
+
+			response := JSON{"description": description}
+
+			if responseType != nil {
+				response["content"] = generator.content(responseType, mediaTypes)
+			}
+
+			responses[strconv.Itoa(statusCode)] = response
+
+		}
+
+		operation["responses"] = responses
+
+	}
+
+	return operation
+
+}
+
+// content builds the OpenAPI content object for a body in each media type
+func (generator *schemaGenerator) content(bodyType reflect.Type, mediaTypes []string) JSON {
+
+	schema := generator.schema(bodyType)
+	content := JSON{}
+
+	for _, mediaType := range mediaTypes {
+		content[mediaType] = JSON{"schema": schema}
+	}
+
+	return content
+
+}
+
+// openAPIPath converts a route path into an OpenAPI path template, along with
+// the parameter objects for its wildcards (where a final wildcard is named
+// catchAll)
+func openAPIPath(routePath string) (string, []JSON) {
+
+	routePathFragments := strings.Split(normalisePath(routePath), "/")
+	pathParams := []JSON{}
+
+	for i, routePathFragment := range routePathFragments {
+
+		paramName, constraintSource, isWildcard := parseWildcard(routePathFragment)
+
+		if routePathFragment == ":" && i == len(routePathFragments)-1 {
+			paramName, isWildcard = "catchAll", true
+		}
+
+		if !isWildcard {
+			continue
+		}
+
+		schema := JSON{"type": "string"}
+
+		// Built-in constraint schemas are copied so that changes to a document
+		// do not affect later ones
+		if constraintSchema, ok := constraintSchemas[constraintSource]; ok {
+
+			schema = JSON{}
+
+			for keyword, value := range constraintSchema {
+				schema[keyword] = value
+			}
+
+		} else if constraintSource != "" {
+
+			schema = JSON{"type": "string", "pattern": "^(?:" + constraintSource + ")$"}
+
+		}
+
+		routePathFragments[i] = "{" + paramName + "}"
+		pathParams = append(pathParams, JSON{"name": paramName, "in": "path", "required": true, "schema": schema})
+
+	}
+
+	return "/" + strings.Join(routePathFragments, "/"), pathParams
+
+}
@@ -0,0 +1,207 @@
+package jsonserver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// testOpenAPIAction is a route action used to test OpenAPI documents
+func testOpenAPIAction(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) {
+
+	WriteResponse(response, &JSON{"success": true}, http.StatusOK)
+
+}
+
+// testOpenAPIDocument converts a generated document into its JSON form so that
+// it can be compared with expected values
+func testOpenAPIDocument(t *testing.T, document JSON) JSON {
+
+	encoded, err := json.Marshal(document)
+
+	if err != nil {
+		t.Fatalf("Document could not be encoded (error: %v)", err)
+	}
+
+	decoded := JSON{}
+
+	json.Unmarshal(encoded, &decoded)
+
+	return decoded
+
+}
+
+// testOpenAPIExpected decodes an expected value from JSON
+func testOpenAPIExpected(source string) interface{} {
+
+	var expected interface{}
+
+	json.Unmarshal([]byte(source), &expected)
+
+	return expected
+
+}
+
+// TestOpenAPIDocument tests generating a document from route metadata
+func TestOpenAPIDocument(t *testing.T) {
+
+	router := Router{}
+
+	router.RegisterRoute("GET|PUT", "/products/{id:int}", []Middleware{}, testOpenAPIAction,
+		WithSummary("Product"),
+		WithDescription("A single product"),
+		WithTags("products"),
+		WithRequestBody(testProduct{}),
+		WithResponse(http.StatusOK, testProduct{}),
+		WithResponse(http.StatusNotFound, nil),
+		WithQueryParams(QueryParam{Name: "fields", Description: "Fields to include"}, QueryParam{Name: "version", Required: true, Type: "integer"}))
+
+	router.RegisterRoute("GET", "/files/{kind:[a-z]+}/:", []Middleware{}, testOpenAPIAction)
+	router.RegisterRoute("GET", "/internal", []Middleware{}, testOpenAPIAction, WithoutDocs())
+	router.RegisterRoute("CONNECT", "/tunnel", []Middleware{}, testOpenAPIAction)
+
+	document := testOpenAPIDocument(t, router.OpenAPI(OpenAPIInfo{Title: "Shop", Version: "1.0.0", Description: "A shop"}))
+
+	expected := testOpenAPIExpected(`{
+		"openapi": "3.1.0",
+		"info": {"title": "Shop", "version": "1.0.0", "description": "A shop"},
+		"paths": {
+			"/products/{id}": {
+				"get": {
+					"summary": "Product",
+					"description": "A single product",
+					"tags": ["products"],
+					"parameters": [
+						{"name": "id", "in": "path", "required": true, "schema": {"type": "integer"}},
+						{"name": "fields", "in": "query", "required": false, "description": "Fields to include", "schema": {"type": "string"}},
+						{"name": "version", "in": "query", "required": true, "schema": {"type": "integer"}}
+					],
+					"requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/testProduct"}}}},
+					"responses": {
+						"200": {"description": "OK", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/testProduct"}}}},
+						"404": {"description": "Not Found"}
+					}
+				}
+			},
+			"/files/{kind}/{catchAll}": {
+				"get": {
+					"parameters": [
+						{"name": "kind", "in": "path", "required": true, "schema": {"type": "string", "pattern": "^(?:[a-z]+)$"}},
+						{"name": "catchAll", "in": "path", "required": true, "schema": {"type": "string"}}
+					]
+				}
+			}
+		},
+		"components": {
+			"schemas": {
+				"testProduct": {
+					"type": "object",
+					"properties": {"name": {"type": "string"}, "price": {"type": "number", "minimum": 0}, "meta": {}},
+					"required": ["name"]
+				}
+			}
+		}
+	}`).(map[string]interface{})
+
+	// Both methods of the route are documented identically
+	expected["paths"].(map[string]interface{})["/products/{id}"].(map[string]interface{})["put"] = expected["paths"].(map[string]interface{})["/products/{id}"].(map[string]interface{})["get"]
+
+	if !reflect.DeepEqual(document, JSON(expected)) {
+		t.Errorf("Incorrect document (expected: %v, actual: %v)", expected, document)
+	}
+
+}
+
+// TestOpenAPIDocumentWithoutRoutes tests that an empty document has no
+// components
+func TestOpenAPIDocumentWithoutRoutes(t *testing.T) {
+
+	router := Router{}
+	document := testOpenAPIDocument(t, router.OpenAPI(OpenAPIInfo{Title: "Empty", Version: "0.1.0"}))
+	expected := testOpenAPIExpected(`{"openapi":"3.1.0","info":{"title":"Empty","version":"0.1.0"},"paths":{}}`)
+
+	if !reflect.DeepEqual(document, JSON(expected.(map[string]interface{}))) {
+		t.Errorf("Incorrect document (expected: %v, actual: %v)", expected, document)
+	}
+
+}
+
+// TestOpenAPIDocumentsJSONRouteBody tests that routes registered with typed
+// bodies have their bodies documented automatically
+func TestOpenAPIDocumentsJSONRouteBody(t *testing.T) {
+
+	document := testOpenAPIDocument(t, testBindingServer().OpenAPI(OpenAPIInfo{Title: "Shop", Version: "1.0.0"}))
+	operation := document["paths"].(map[string]interface{})["/products"].(map[string]interface{})["post"]
+	expected := testOpenAPIExpected(`{"requestBody":{"required":true,"content":{"application/json":{"schema":{"$ref":"#/components/schemas/testProduct"}}}}}`)
+
+	if !reflect.DeepEqual(operation, expected) {
+		t.Errorf("Body was not documented (expected: %v, actual: %v)", expected, operation)
+	}
+
+}
+
+// TestOpenAPIDocumentsCodecMediaTypes tests that bodies are documented in the
+// format of every codec registered with a server
+func TestOpenAPIDocumentsCodecMediaTypes(t *testing.T) {
+
+	server := NewServer()
+
+	server.RegisterCodec(MessagePackCodec{})
+	server.RegisterRoute("POST", "/products", []Middleware{}, testOpenAPIAction, WithRequestBody(""))
+
+	document := testOpenAPIDocument(t, server.OpenAPI(OpenAPIInfo{Title: "Shop", Version: "1.0.0"}))
+	operation := document["paths"].(map[string]interface{})["/products"].(map[string]interface{})["post"]
+	expected := testOpenAPIExpected(`{"requestBody":{"required":true,"content":{"application/json":{"schema":{"type":"string"}},"application/msgpack":{"schema":{"type":"string"}}}}}`)
+
+	if !reflect.DeepEqual(operation, expected) {
+		t.Errorf("Media types were not documented (expected: %v, actual: %v)", expected, operation)
+	}
+
+}
+
+// TestOpenAPIDocumentsAreIndependent tests that changing a generated document
+// does not affect documents generated later
+func TestOpenAPIDocumentsAreIndependent(t *testing.T) {
+
+	router := Router{}
+
+	router.RegisterRoute("GET", "/products/{id:int}", []Middleware{}, testOpenAPIAction)
+
+	for i := 0; i < 2; i++ {
+
+		document := router.OpenAPI(OpenAPIInfo{Title: "Shop", Version: "1.0.0"})
+		schema := document["paths"].(JSON)["/products/{id}"].(JSON)["get"].(JSON)["parameters"].([]JSON)[0]["schema"].(JSON)
+
+		if !reflect.DeepEqual(schema, JSON{"type": "integer"}) {
+			t.Errorf("Document was affected by changes to an earlier document (actual: %v)", schema)
+		}
+
+		schema["description"] = "Product ID"
+
+	}
+
+}
+
+// TestServeOpenAPI tests serving a document that includes routes registered
+// after it, but not itself
+func TestServeOpenAPI(t *testing.T) {
+
+	server := NewServer()
+
+	if err := server.ServeOpenAPI("/openapi.json", OpenAPIInfo{Title: "Shop", Version: "1.0.0"}, []Middleware{}); err != nil {
+		t.Fatalf("Document route could not be registered (error: %v)", err)
+	}
+
+	server.RegisterRoute("GET", "/products", []Middleware{}, testOpenAPIAction)
+
+	response := testRequest(server, "GET", "/openapi.json", nil, nil)
+
+	expected := `{"info":{"title":"Shop","version":"1.0.0"},"openapi":"3.1.0","paths":{"/products":{"get":{}}}}`
+
+	if response.Code != http.StatusOK || response.Body.String() != expected {
+		t.Errorf("Incorrect document served (status code: %v, body: %v)", response.Code, response.Body.String())
+	}
+
+}
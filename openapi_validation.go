@@ -0,0 +1,1446 @@
+package jsonserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// OpenAPIValidator validates requests, and optionally responses, against the
+// operations described by an OpenAPI 3 document
+type OpenAPIValidator struct {
+	document  map[string]interface{}
+	paths     []specPath
+	basePaths []string
+	patterns  map[string]*regexp.Regexp
+}
+
+// specPath is a path template from an OpenAPI document, along with the
+// parameters shared by its operations and the operations keyed by method
+type specPath struct {
+	pattern    *regexp.Regexp
+	names      []string
+	literals   int
+	parameters []interface{}
+	operations map[string]map[string]interface{}
+}
+
+// specMatch is the operation that a request matches, along with the path it
+// is found at and the values of the path's parameters
+type specMatch struct {
+	path       *specPath
+	operation  map[string]interface{}
+	pathValues map[string]string
+}
+
+// specValidation collects the rules that values break while they are
+// validated against schemas, where properties are checked according to
+// whether they belong to a request or a response
+type specValidation struct {
+	validator *OpenAPIValidator
+	response  bool
+	errors    ValidationErrors
+	depth     int
+}
+
+// recordingWriter passes a response through to the client while keeping a
+// copy of its HTTP code and body
+type recordingWriter struct {
+	response   http.ResponseWriter
+	statusCode int
+	body       bytes.Buffer
+}
+
+// maxReferenceHops limits how many references are followed in a row, guarding
+// against references that refer to each other
+const maxReferenceHops = 64
+
+// maxSchemaDepth limits how deeply schemas are followed while validating a
+// value, guarding against schemas that refer to themselves indefinitely
+const maxSchemaDepth = 4 * maxDecodeDepth
+
+// specFormats check the formats of strings, where formats that are not listed
+// are not checked
+var specFormats = map[string]func(value string) bool{
+	"date": func(value string) bool {
+		_, err := time.Parse(dateLayout, value)
+		return err == nil
+	},
+	"date-time": func(value string) bool {
+		_, err := time.Parse(time.RFC3339, value)
+		return err == nil
+	},
+	"uuid": func(value string) bool {
+		return uuidPattern.MatchString(value)
+	},
+	"email": func(value string) bool {
+		address, err := mail.ParseAddress(value)
+		return err == nil && address.Address == value
+	},
+	"ipv4": func(value string) bool {
+		ip := net.ParseIP(value)
+		return ip != nil && ip.To4() != nil && !strings.Contains(value, ":")
+	},
+	"ipv6": func(value string) bool {
+		return net.ParseIP(value) != nil && strings.Contains(value, ":")
+	},
+	"uri": func(value string) bool {
+		parsed, err := url.Parse(value)
+		return err == nil && parsed.IsAbs()
+	},
+	"byte": func(value string) bool {
+		_, err := base64.StdEncoding.DecodeString(value)
+		return err == nil
+	},
+}
+
+// LoadOpenAPIValidator creates a validator from an OpenAPI 3 document in a
+// JSON or YAML file
+func LoadOpenAPIValidator(path string) (*OpenAPIValidator, error) {
+
+	spec, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return NewOpenAPIValidator(spec)
+
+}
+
+// NewOpenAPIValidator creates a validator from an OpenAPI 3 document in JSON
+// or YAML form. Only references within the document are supported, and an
+// error is returned if any of them cannot be resolved or any pattern cannot be
+// compiled
+func NewOpenAPIValidator(spec []byte) (*OpenAPIValidator, error) {
+
+	var tree interface{}
+	var err error
+
+	if trimmed := bytes.TrimSpace(spec); len(trimmed) > 0 && trimmed[0] == '{' {
+		tree, err = decodeSpecJSON(spec)
+	} else {
+		tree, err = decodeYAML(spec)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("openapi: spec could not be decoded: %w", err)
+	}
+
+	document, ok := tree.(map[string]interface{})
+	version, _ := document["openapi"].(string)
+
+	if !ok || !strings.HasPrefix(version, "3.") {
+		return nil, errors.New("openapi: spec is not an OpenAPI 3 document")
+	}
+
+	validator := &OpenAPIValidator{document: document, patterns: map[string]*regexp.Regexp{}}
+
+	if err := validator.checkNode(document); err != nil {
+		return nil, err
+	}
+
+	paths, _ := document["paths"].(map[string]interface{})
+
+	for _, template := range sortedKeys(paths) {
+
+		pathItem := validator.resolveMap(paths[template])
+		pattern, names, literals := compilePathTemplate(template)
+		path := specPath{pattern: pattern, names: names, literals: literals, operations: map[string]map[string]interface{}{}}
+
+		path.parameters, _ = pathItem["parameters"].([]interface{})
+
+		for method, operation := range pathItem {
+
+			if operation, ok := operation.(map[string]interface{}); ok && openAPIMethods[strings.ToUpper(method)] {
+				path.operations[strings.ToUpper(method)] = operation
+			}
+
+		}
+
+		validator.paths = append(validator.paths, path)
+
+	}
+
+	validator.basePaths = specBasePaths(document)
+
+	return validator, nil
+
+}
+
+// Middleware creates middleware that validates each request against the
+// operation that it matches before the route's action runs. Requests whose
+// path is not in the document are denied with a 404 HTTP code, those whose
+// method is not are denied with a 405 HTTP code and an Allow header, and those
+// that break the document's rules are denied with a 400 HTTP code and a list
+// of every violation
+func (validator *OpenAPIValidator) Middleware() Middleware {
+
+	return ErrorMiddleware(func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) error {
+
+		match, allowedMethods := validator.match(request)
+
+		if match == nil && len(allowedMethods) > 0 {
+			return Deny(http.StatusMethodNotAllowed, "Method not allowed").WithHeader("Allow", strings.Join(allowedMethods, ", "))
+		}
+
+		if match == nil {
+			return Deny(http.StatusNotFound, "Could not find "+request.URL.Path)
+		}
+
+		requestBody := []byte{}
+
+		if body != nil {
+			requestBody = *body
+		}
+
+		if validationErrors := validator.validateRequest(ctx, request, requestBody, match); len(validationErrors) > 0 {
+
+			denial := Deny(http.StatusBadRequest, "Request does not match the API specification")
+			denial.Body["errors"] = validationErrors
+
+			return denial
+
+		}
+
+		return nil
+
+	}).Middleware()
+
+}
+
+// ValidateResponses creates a wrapper that checks each response against the
+// responses of the operation that its request matches, passing any violations
+// to a function while sending the response unchanged. It is intended for tests
+// that check that a server keeps to its own specification
+func (validator *OpenAPIValidator) ValidateResponses(report func(request *http.Request, err error)) Wrapper {
+
+	return func(next RouteAction) RouteAction {
+
+		return func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) {
+
+			writer := &recordingWriter{response: response}
+
+			next(ctx, request, writer, body)
+
+			if err := validator.validateResponse(ctx, request, writer); err != nil {
+				report(request, err)
+			}
+
+		}
+
+	}
+
+}
+
+// validateRequest checks the parameters and body of a request against the
+// operation that it matches
+func (validator *OpenAPIValidator) validateRequest(ctx context.Context, request *http.Request, body []byte, match *specMatch) ValidationErrors {
+
+	validation := &specValidation{validator: validator}
+	operationParameters, _ := match.operation["parameters"].([]interface{})
+	parameters := map[string]map[string]interface{}{}
+	order := []string{}
+
+	// Parameters of the operation override those of its path with the same
+	// name and location
+	for _, parameterList := range [][]interface{}{match.path.parameters, operationParameters} {
+
+		for _, node := range parameterList {
+
+			parameter := validator.resolveMap(node)
+			name, _ := parameter["name"].(string)
+			in, _ := parameter["in"].(string)
+			key := in + ":" + name
+
+			if in == "header" {
+				key = in + ":" + http.CanonicalHeaderKey(name)
+			}
+
+			if _, exists := parameters[key]; !exists {
+				order = append(order, key)
+			}
+
+			parameters[key] = parameter
+
+		}
+
+	}
+
+	for _, key := range order {
+		validation.parameter(request, Query(ctx), match.pathValues, parameters[key])
+	}
+
+	if requestBody := validator.resolveMap(match.operation["requestBody"]); requestBody != nil {
+
+		content, _ := requestBody["content"].(map[string]interface{})
+		required, _ := requestBody["required"].(bool)
+
+		validation.content(ctx, content, request.Header.Get("Content-Type"), body, required)
+
+	}
+
+	return validation.errors
+
+}
+
+// validateResponse checks a recorded response against the responses of the
+// operation that its request matches
+func (validator *OpenAPIValidator) validateResponse(ctx context.Context, request *http.Request, writer *recordingWriter) error {
+
+	match, _ := validator.match(request)
+
+	if match == nil {
+		return fmt.Errorf("openapi: no operation matches %v %v", request.Method, request.URL.Path)
+	}
+
+	statusCode := writer.statusCode
+
+	if statusCode == 0 {
+		statusCode = http.StatusOK
+	}
+
+	responses := validator.resolveMap(match.operation["responses"])
+	statusText := strconv.Itoa(statusCode)
+	responseSpec, ok := responses[statusText]
+
+	// Responses can be given for a range of HTTP codes, or as a default
+	for _, key := range []string{statusText[:1] + "XX", statusText[:1] + "xx", "default"} {
+
+		if !ok {
+			responseSpec, ok = responses[key]
+		}
+
+	}
+
+	if !ok {
+		return ValidationErrors{{Field: "status", Rule: "responses", Message: "must be one of " + strings.Join(sortedKeys(responses), ", ")}}
+	}
+
+	validation := &specValidation{validator: validator, response: true}
+	responseMap := validator.resolveMap(responseSpec)
+	content, _ := responseMap["content"].(map[string]interface{})
+	headers, _ := responseMap["headers"].(map[string]interface{})
+
+	for _, name := range sortedKeys(headers) {
+
+		if http.CanonicalHeaderKey(name) == "Content-Type" {
+			continue
+		}
+
+		header := validator.resolveMap(headers[name])
+		required, _ := header["required"].(bool)
+
+		validation.parameterValues("header."+name, "header", writer.Header().Values(name), required, header)
+
+	}
+
+	if request.Method != http.MethodHead {
+		validation.content(ctx, content, writer.Header().Get("Content-Type"), writer.body.Bytes(), len(content) > 0)
+	}
+
+	if len(validation.errors) > 0 {
+		return validation.errors
+	}
+
+	return nil
+
+}
+
+// match finds the operation that a request matches, preferring paths with the
+// most literal segments. If the path is found but not the method, the methods
+// that are available are listed instead
+func (validator *OpenAPIValidator) match(request *http.Request) (*specMatch, []string) {
+
+	requestPath := normalisePath(request.URL.EscapedPath())
+	allowedMethods := []string{}
+	var best *specMatch
+
+	for _, basePath := range validator.basePaths {
+
+		relativePath, ok := trimBasePath(requestPath, basePath)
+
+		if !ok {
+			continue
+		}
+
+		for i := range validator.paths {
+
+			path := &validator.paths[i]
+			submatches := path.pattern.FindStringSubmatch(relativePath)
+
+			if submatches == nil {
+				continue
+			}
+
+			operation, ok := path.operations[request.Method]
+
+			// HEAD requests are answered by GET routes, so they follow GET operations
+			if !ok && request.Method == http.MethodHead {
+				operation, ok = path.operations[http.MethodGet]
+			}
+
+			if !ok {
+
+				for method := range path.operations {
+					allowedMethods = append(allowedMethods, method)
+				}
+
+				continue
+
+			}
+
+			if best != nil && best.path.literals >= path.literals {
+				continue
+			}
+
+			pathValues := map[string]string{}
+
+			for j, name := range path.names {
+
+				value, err := url.PathUnescape(submatches[j+1])
+
+				if err != nil {
+					value = submatches[j+1]
+				}
+
+				pathValues[name] = value
+
+			}
+
+			best = &specMatch{path: path, operation: operation, pathValues: pathValues}
+
+		}
+
+	}
+
+	if best != nil {
+		return best, nil
+	}
+
+	sort.Strings(allowedMethods)
+
+	return nil, uniqueSorted(allowedMethods)
+
+}
+
+// checkNode checks that every reference within part of the document can be
+// resolved, and compiles every pattern
+func (validator *OpenAPIValidator) checkNode(node interface{}) error {
+
+	switch value := node.(type) {
+
+	case map[string]interface{}:
+
+		for _, key := range sortedKeys(value) {
+
+			child := value[key]
+
+			// Examples are arbitrary values rather than part of the document
+			if key == "example" || key == "examples" {
+				continue
+			}
+
+			if reference, ok := child.(string); ok && key == "$ref" {
+
+				if _, err := validator.resolve(map[string]interface{}{"$ref": reference}); err != nil {
+					return err
+				}
+
+				continue
+
+			}
+
+			if pattern, ok := child.(string); ok && key == "pattern" {
+
+				compiled, err := regexp.Compile(pattern)
+
+				if err != nil {
+					return fmt.Errorf("openapi: invalid pattern %q: %w", pattern, err)
+				}
+
+				validator.patterns[pattern] = compiled
+
+				continue
+
+			}
+
+			if err := validator.checkNode(child); err != nil {
+				return err
+			}
+
+		}
+
+	case []interface{}:
+
+		for _, child := range value {
+
+			if err := validator.checkNode(child); err != nil {
+				return err
+			}
+
+		}
+
+	}
+
+	return nil
+
+}
+
+// resolve follows the reference in an object (and any reference that it in
+// turn refers to), returning the object itself if it is not a reference
+func (validator *OpenAPIValidator) resolve(node interface{}) (interface{}, error) {
+
+	for hops := 0; hops < maxReferenceHops; hops++ {
+
+		object, isObject := node.(map[string]interface{})
+		reference, isReference := object["$ref"].(string)
+
+		if !isObject || !isReference {
+			return node, nil
+		}
+
+		fragment, err := url.PathUnescape(strings.TrimPrefix(reference, "#"))
+
+		if !strings.HasPrefix(reference, "#") || err != nil || (fragment != "" && !strings.HasPrefix(fragment, "/")) {
+			return nil, fmt.Errorf("openapi: unsupported reference %q", reference)
+		}
+
+		node = validator.document
+
+		for _, token := range strings.Split(fragment, "/")[1:] {
+
+			token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+
+			switch parent := node.(type) {
+
+			case map[string]interface{}:
+
+				child, ok := parent[token]
+
+				if !ok {
+					return nil, fmt.Errorf("openapi: unresolvable reference %q", reference)
+				}
+
+				node = child
+
+			case []interface{}:
+
+				index, err := strconv.Atoi(token)
+
+				if err != nil || index < 0 || index >= len(parent) {
+					return nil, fmt.Errorf("openapi: unresolvable reference %q", reference)
+				}
+
+				node = parent[index]
+
+			default:
+
+				return nil, fmt.Errorf("openapi: unresolvable reference %q", reference)
+
+			}
+
+		}
+
+	}
+
+	return nil, errors.New("openapi: references refer to each other")
+
+}
+
+// resolveMap follows the reference in an object, returning nil if the result
+// is not an object. References are checked when the document is loaded, so
+// they always resolve
+func (validator *OpenAPIValidator) resolveMap(node interface{}) map[string]interface{} {
+
+	resolved, _ := validator.resolve(node)
+	object, _ := resolved.(map[string]interface{})
+
+	return object
+
+}
+
+// parameter validates a path, query, header or cookie parameter of a request
+func (validation *specValidation) parameter(request *http.Request, query url.Values, pathValues map[string]string, parameter map[string]interface{}) {
+
+	name, _ := parameter["name"].(string)
+	in, _ := parameter["in"].(string)
+	required, _ := parameter["required"].(bool)
+	var values []string
+
+	switch in {
+
+	case "path":
+
+		if value, ok := pathValues[name]; ok {
+			values = []string{value}
+		}
+
+		required = true
+
+	case "query":
+
+		values = query[name]
+
+	case "header":
+
+		// These headers are described by other parts of the document
+		switch http.CanonicalHeaderKey(name) {
+		case "Accept", "Content-Type", "Authorization":
+			return
+		}
+
+		values = request.Header.Values(name)
+
+	case "cookie":
+
+		if cookie, err := request.Cookie(name); err == nil {
+			values = []string{cookie.Value}
+		}
+
+	default:
+
+		return
+
+	}
+
+	validation.parameterValues(in+"."+name, in, values, required, parameter)
+
+}
+
+// parameterValues validates the values of a parameter (or a response header)
+// found in a given location
+func (validation *specValidation) parameterValues(field string, in string, values []string, required bool, parameter map[string]interface{}) {
+
+	if len(values) == 0 {
+
+		if required {
+			validation.fail(field, "required", "is required")
+		}
+
+		return
+
+	}
+
+	// Parameters can be encoded in a media type rather than as plain strings
+	if content, ok := parameter["content"].(map[string]interface{}); ok && parameter["schema"] == nil {
+
+		for _, mediaType := range sortedKeys(content) {
+
+			if !isJSONMediaType(mediaType) {
+				continue
+			}
+
+			value, err := decodeSpecJSON([]byte(values[0]))
+
+			if err != nil {
+				validation.fail(field, "format", "must be valid JSON")
+				return
+			}
+
+			validation.validate(validation.validator.resolveMap(content[mediaType])["schema"], value, field)
+
+		}
+
+		return
+
+	}
+
+	explode, ok := parameter["explode"].(bool)
+
+	if !ok {
+		explode = in == "query" || in == "cookie"
+	}
+
+	separator := ","
+
+	switch parameter["style"] {
+	case "spaceDelimited":
+		separator = " "
+	case "pipeDelimited":
+		separator = "|"
+	}
+
+	validation.validate(parameter["schema"], validation.parameterValue(parameter["schema"], values, explode, separator), field)
+
+}
+
+// parameterValue converts the string values of a parameter into the types
+// that its schema expects, leaving values that cannot be converted as strings
+// so that they fail validation
+func (validation *specValidation) parameterValue(schemaNode interface{}, values []string, explode bool, separator string) interface{} {
+
+	schema := validation.validator.resolveMap(schemaNode)
+
+	for _, schemaType := range schemaTypes(schema) {
+
+		if schemaType != "array" {
+			continue
+		}
+
+		if len(values) == 1 && !explode {
+			values = strings.Split(values[0], separator)
+		}
+
+		items := make([]interface{}, len(values))
+
+		for i, value := range values {
+			items[i] = validation.scalarValue(schema["items"], value)
+		}
+
+		return items
+
+	}
+
+	return validation.scalarValue(schema, values[0])
+
+}
+
+// scalarValue converts a string into the type that a schema expects
+func (validation *specValidation) scalarValue(schemaNode interface{}, value string) interface{} {
+
+	for _, schemaType := range schemaTypes(validation.validator.resolveMap(schemaNode)) {
+
+		switch schemaType {
+
+		case "integer":
+
+			if integer, err := strconv.ParseInt(value, 10, 64); err == nil {
+				return integer
+			}
+
+		case "number":
+
+			if number, err := strconv.ParseFloat(value, 64); err == nil && !math.IsNaN(number) && !math.IsInf(number, 0) {
+				return number
+			}
+
+		case "boolean":
+
+			if value == "true" || value == "false" {
+				return value == "true"
+			}
+
+		}
+
+	}
+
+	return value
+
+}
+
+// content validates a body against the media types that it can have, where
+// bodies are only checked against schemas if they are JSON or can be decoded
+// by one of the server's codecs
+func (validation *specValidation) content(ctx context.Context, content map[string]interface{}, contentType string, body []byte, required bool) {
+
+	if len(body) == 0 {
+
+		if required {
+			validation.fail("body", "required", "is required")
+		}
+
+		return
+
+	}
+
+	if len(content) == 0 {
+		return
+	}
+
+	mediaType := "application/json"
+
+	if strings.TrimSpace(contentType) != "" {
+
+		parsed, _, err := mime.ParseMediaType(contentType)
+
+		if err != nil {
+			parsed = contentType
+		}
+
+		mediaType = strings.ToLower(parsed)
+
+	}
+
+	media, ok := matchMediaType(content, mediaType)
+
+	if !ok {
+		validation.fail("body", "contentType", "must have a content type of "+strings.Join(sortedKeys(content), ", "))
+		return
+	}
+
+	value, decoded, err := decodeSpecBody(ctx, mediaType, body)
+
+	if err != nil {
+		validation.fail("body", "format", "could not be decoded as "+mediaType)
+		return
+	}
+
+	if decoded {
+		validation.validate(validation.validator.resolveMap(media)["schema"], value, "body")
+	}
+
+}
+
+// validate checks a value against a schema, recording each rule that it
+// breaks
+func (validation *specValidation) validate(schemaNode interface{}, value interface{}, field string) {
+
+	if validation.depth++; validation.depth > maxSchemaDepth {
+		validation.fail(field, "schema", "is nested too deeply to validate")
+		validation.depth--
+		return
+	}
+
+	defer func() { validation.depth-- }()
+
+	// Schemas can be booleans, where false allows nothing
+	if allowed, ok := schemaNode.(bool); ok {
+
+		if !allowed {
+			validation.fail(field, "schema", "is not allowed")
+		}
+
+		return
+
+	}
+
+	schema := validation.validator.resolveMap(schemaNode)
+
+	if schema == nil {
+		return
+	}
+
+	if nullable, _ := schema["nullable"].(bool); nullable && value == nil {
+		return
+	}
+
+	if types := schemaTypes(schema); len(types) > 0 && !matchesSchemaType(value, types) {
+		validation.fail(field, "type", "must be of type "+strings.Join(types, " or "))
+		return
+	}
+
+	if options, ok := schema["enum"].([]interface{}); ok && !containsSpecValue(options, value) {
+
+		descriptions := make([]string, len(options))
+
+		for i, option := range options {
+			descriptions[i] = describeSpecValue(option)
+		}
+
+		validation.fail(field, "enum", "must be one of "+strings.Join(descriptions, ", "))
+
+	}
+
+	if constant, ok := schema["const"]; ok && !containsSpecValue([]interface{}{constant}, value) {
+		validation.fail(field, "const", "must be "+describeSpecValue(constant))
+	}
+
+	switch typedValue := value.(type) {
+	case string:
+		validation.validateString(schema, typedValue, field)
+	case []interface{}:
+		validation.validateArray(schema, typedValue, field)
+	case map[string]interface{}:
+		validation.validateObject(schema, typedValue, field)
+	default:
+		if number, ok := specNumber(value); ok {
+			validation.validateNumber(schema, number, field)
+		}
+	}
+
+	validation.validateComposition(schema, value, field)
+
+}
+
+// validateString checks a string against the string rules of a schema
+func (validation *specValidation) validateString(schema map[string]interface{}, value string, field string) {
+
+	length := float64(utf8.RuneCountInString(value))
+
+	if minimum, ok := specNumber(schema["minLength"]); ok && length < minimum {
+		validation.fail(field, "minLength", "must have a length of at least "+formatSpecNumber(minimum))
+	}
+
+	if maximum, ok := specNumber(schema["maxLength"]); ok && length > maximum {
+		validation.fail(field, "maxLength", "must have a length of at most "+formatSpecNumber(maximum))
+	}
+
+	if pattern, ok := schema["pattern"].(string); ok && validation.validator.patterns[pattern] != nil && !validation.validator.patterns[pattern].MatchString(value) {
+		validation.fail(field, "pattern", "must match the pattern "+pattern)
+	}
+
+	if format, ok := schema["format"].(string); ok && specFormats[format] != nil && !specFormats[format](value) {
+		validation.fail(field, "format", "must be a valid "+format)
+	}
+
+}
+
+// validateNumber checks a number against the numeric rules of a schema, where
+// exclusive limits can be numbers or (in OpenAPI 3.0) flags that make the
+// minimum and maximum exclusive
+func (validation *specValidation) validateNumber(schema map[string]interface{}, value float64, field string) {
+
+	minimum, hasMinimum := specNumber(schema["minimum"])
+	maximum, hasMaximum := specNumber(schema["maximum"])
+
+	if exclusive, _ := schema["exclusiveMinimum"].(bool); exclusive && hasMinimum && value <= minimum {
+		validation.fail(field, "exclusiveMinimum", "must be greater than "+formatSpecNumber(minimum))
+	} else if hasMinimum && value < minimum {
+		validation.fail(field, "minimum", "must be at least "+formatSpecNumber(minimum))
+	}
+
+	if exclusive, _ := schema["exclusiveMaximum"].(bool); exclusive && hasMaximum && value >= maximum {
+		validation.fail(field, "exclusiveMaximum", "must be less than "+formatSpecNumber(maximum))
+	} else if hasMaximum && value > maximum {
+		validation.fail(field, "maximum", "must be at most "+formatSpecNumber(maximum))
+	}
+
+	if limit, ok := specNumber(schema["exclusiveMinimum"]); ok && value <= limit {
+		validation.fail(field, "exclusiveMinimum", "must be greater than "+formatSpecNumber(limit))
+	}
+
+	if limit, ok := specNumber(schema["exclusiveMaximum"]); ok && value >= limit {
+		validation.fail(field, "exclusiveMaximum", "must be less than "+formatSpecNumber(limit))
+	}
+
+	if divisor, ok := specNumber(schema["multipleOf"]); ok && divisor > 0 {
+
+		quotient := value / divisor
+
+		if math.Abs(quotient-math.Round(quotient)) > 1e-9 {
+			validation.fail(field, "multipleOf", "must be a multiple of "+formatSpecNumber(divisor))
+		}
+
+	}
+
+}
+
+// validateArray checks an array against the array rules of a schema, along
+// with each of its items
+func (validation *specValidation) validateArray(schema map[string]interface{}, value []interface{}, field string) {
+
+	length := float64(len(value))
+
+	if minimum, ok := specNumber(schema["minItems"]); ok && length < minimum {
+		validation.fail(field, "minItems", "must have a length of at least "+formatSpecNumber(minimum))
+	}
+
+	if maximum, ok := specNumber(schema["maxItems"]); ok && length > maximum {
+		validation.fail(field, "maxItems", "must have a length of at most "+formatSpecNumber(maximum))
+	}
+
+	if unique, _ := schema["uniqueItems"].(bool); unique {
+
+		seen := map[string]bool{}
+
+		for _, item := range value {
+
+			encoded, _ := json.Marshal(item)
+
+			if seen[string(encoded)] {
+				validation.fail(field, "uniqueItems", "must not contain duplicate items")
+				break
+			}
+
+			seen[string(encoded)] = true
+
+		}
+
+	}
+
+	// Items covered by prefixItems (in OpenAPI 3.1) are not checked against items
+	prefixItems, _ := schema["prefixItems"].([]interface{})
+
+	for i, item := range value {
+
+		itemField := field + "[" + strconv.Itoa(i) + "]"
+
+		if i < len(prefixItems) {
+			validation.validate(prefixItems[i], item, itemField)
+		} else if itemSchema, ok := schema["items"]; ok {
+			validation.validate(itemSchema, item, itemField)
+		}
+
+	}
+
+}
+
+// validateObject checks an object against the object rules of a schema, along
+// with each of its properties. Read-only properties are not required in
+// requests and write-only properties are not required in responses
+func (validation *specValidation) validateObject(schema map[string]interface{}, value map[string]interface{}, field string) {
+
+	properties, _ := schema["properties"].(map[string]interface{})
+	required, _ := schema["required"].([]interface{})
+	length := float64(len(value))
+
+	for _, name := range required {
+
+		name, _ := name.(string)
+
+		if _, ok := value[name]; ok {
+			continue
+		}
+
+		property := validation.validator.resolveMap(properties[name])
+		readOnly, _ := property["readOnly"].(bool)
+		writeOnly, _ := property["writeOnly"].(bool)
+
+		if (readOnly && !validation.response) || (writeOnly && validation.response) {
+			continue
+		}
+
+		validation.fail(joinFieldPath(field, name), "required", "is required")
+
+	}
+
+	if minimum, ok := specNumber(schema["minProperties"]); ok && length < minimum {
+		validation.fail(field, "minProperties", "must have at least "+formatSpecNumber(minimum)+" properties")
+	}
+
+	if maximum, ok := specNumber(schema["maxProperties"]); ok && length > maximum {
+		validation.fail(field, "maxProperties", "must have at most "+formatSpecNumber(maximum)+" properties")
+	}
+
+	additionalProperties, hasAdditionalProperties := schema["additionalProperties"]
+
+	for _, name := range sortedKeys(value) {
+
+		propertyField := joinFieldPath(field, name)
+
+		if property, ok := properties[name]; ok {
+			validation.validate(property, value[name], propertyField)
+		} else if allowed, ok := additionalProperties.(bool); ok && !allowed {
+			validation.fail(propertyField, "additionalProperties", "is not allowed")
+		} else if hasAdditionalProperties {
+			validation.validate(additionalProperties, value[name], propertyField)
+		}
+
+	}
+
+}
+
+// validateComposition checks a value against the allOf, anyOf, oneOf and not
+// rules of a schema
+func (validation *specValidation) validateComposition(schema map[string]interface{}, value interface{}, field string) {
+
+	if allOf, ok := schema["allOf"].([]interface{}); ok {
+
+		for _, subschema := range allOf {
+			validation.validate(subschema, value, field)
+		}
+
+	}
+
+	if anyOf, ok := schema["anyOf"].([]interface{}); ok && validation.countMatches(anyOf, value, field) == 0 {
+		validation.fail(field, "anyOf", "must match at least one schema")
+	}
+
+	if oneOf, ok := schema["oneOf"].([]interface{}); ok && validation.countMatches(oneOf, value, field) != 1 {
+		validation.fail(field, "oneOf", "must match exactly one schema")
+	}
+
+	if not, ok := schema["not"]; ok && validation.countMatches([]interface{}{not}, value, field) == 1 {
+		validation.fail(field, "not", "must not match the schema")
+	}
+
+}
+
+// countMatches counts the schemas that a value satisfies
+func (validation *specValidation) countMatches(schemas []interface{}, value interface{}, field string) int {
+
+	matches := 0
+
+	for _, subschema := range schemas {
+
+		attempt := &specValidation{validator: validation.validator, response: validation.response, depth: validation.depth}
+		attempt.validate(subschema, value, field)
+
+		if len(attempt.errors) == 0 {
+			matches++
+		}
+
+	}
+
+	return matches
+
+}
+
+// fail records a rule that a value breaks
+func (validation *specValidation) fail(field string, rule string, message string) {
+
+	validation.errors = append(validation.errors, FieldError{Field: field, Rule: rule, Message: message})
+
+}
+
+// Header returns the headers that will be sent with the response
+func (writer *recordingWriter) Header() http.Header {
+
+	return writer.response.Header()
+
+}
+
+// Write sends part of the response body, keeping a copy of it
+func (writer *recordingWriter) Write(body []byte) (int, error) {
+
+	if writer.statusCode == 0 {
+		writer.statusCode = http.StatusOK
+	}
+
+	writer.body.Write(body)
+
+	return writer.response.Write(body)
+
+}
+
+// WriteHeader sends the response's HTTP code, keeping a copy of it
+func (writer *recordingWriter) WriteHeader(statusCode int) {
+
+	if writer.statusCode == 0 {
+		writer.statusCode = statusCode
+	}
+
+	writer.response.WriteHeader(statusCode)
+
+}
+
+// compilePathTemplate converts an OpenAPI path template into a regular
+// expression that matches normalised paths, along with the names of its
+// parameters and its number of literal segments
+func compilePathTemplate(template string) (*regexp.Regexp, []string, int) {
+
+	segments := strings.Split(normalisePath(template), "/")
+	names := []string{}
+	literals := 0
+
+	for i, segment := range segments {
+
+		pattern := ""
+
+		if !strings.Contains(segment, "{") {
+			literals++
+		}
+
+		// Parameters can make up part of a segment, such as {name}.{format}
+		for segment != "" {
+
+			start := strings.Index(segment, "{")
+			end := strings.Index(segment, "}")
+
+			if start == -1 || end < start {
+				pattern += regexp.QuoteMeta(segment)
+				break
+			}
+
+			pattern += regexp.QuoteMeta(segment[:start]) + "([^/]+)"
+			names = append(names, segment[start+1:end])
+			segment = segment[end+1:]
+
+		}
+
+		segments[i] = pattern
+
+	}
+
+	return regexp.MustCompile("^" + strings.Join(segments, "/") + "$"), names, literals
+
+}
+
+// specBasePaths lists the normalised paths of the document's server URLs, with
+// the longest first so that it is removed from request paths in preference to
+// shorter ones. Documents without servers are served from the root
+func specBasePaths(document map[string]interface{}) []string {
+
+	servers, _ := document["servers"].([]interface{})
+	found := map[string]bool{}
+	basePaths := []string{}
+
+	for _, server := range servers {
+
+		serverMap, _ := server.(map[string]interface{})
+		serverURL, _ := serverMap["url"].(string)
+		parsed, err := url.Parse(serverURL)
+
+		if err == nil && !found[normalisePath(parsed.EscapedPath())] {
+			found[normalisePath(parsed.EscapedPath())] = true
+			basePaths = append(basePaths, normalisePath(parsed.EscapedPath()))
+		}
+
+	}
+
+	if len(basePaths) == 0 {
+		basePaths = []string{""}
+	}
+
+	sort.SliceStable(basePaths, func(i, j int) bool {
+		return len(basePaths[i]) > len(basePaths[j])
+	})
+
+	return basePaths
+
+}
+
+// trimBasePath removes a base path from the start of a normalised path,
+// reporting whether the path starts with it
+func trimBasePath(path string, basePath string) (string, bool) {
+
+	switch {
+	case basePath == "":
+		return path, true
+	case path == basePath:
+		return "", true
+	case strings.HasPrefix(path, basePath+"/"):
+		return path[len(basePath)+1:], true
+	}
+
+	return "", false
+
+}
+
+// matchMediaType finds the media type object for a media type, falling back
+// on ranges such as application/* and */*
+func matchMediaType(content map[string]interface{}, mediaType string) (interface{}, bool) {
+
+	mainType, _, _ := strings.Cut(mediaType, "/")
+
+	for _, candidate := range []string{mediaType, mainType + "/*", "*/*"} {
+
+		for key, media := range content {
+
+			parsed, _, err := mime.ParseMediaType(key)
+
+			if err == nil && strings.EqualFold(parsed, candidate) {
+				return media, true
+			}
+
+		}
+
+	}
+
+	return nil, false
+
+}
+
+// decodeSpecBody decodes a body for validation, reporting whether its media
+// type could be decoded at all
+func decodeSpecBody(ctx context.Context, mediaType string, body []byte) (interface{}, bool, error) {
+
+	if isJSONMediaType(mediaType) {
+		value, err := decodeSpecJSON(body)
+		return value, true, err
+	}
+
+	for _, codec := range serverFromContext(ctx).availableCodecs() {
+
+		if handlesMediaType(codec, mediaType) {
+
+			var tree interface{}
+			err := codec.Decode(body, &tree)
+
+			return tree, true, err
+
+		}
+
+	}
+
+	return nil, false, nil
+
+}
+
+// decodeSpecJSON decodes a single JSON value, with numbers converted as they
+// are by the codecs
+func decodeSpecJSON(body []byte) (interface{}, error) {
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	var tree interface{}
+
+	if err := decoder.Decode(&tree); err != nil {
+		return nil, err
+	}
+
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, errors.New("unexpected data after JSON value")
+	}
+
+	return convertNumbers(tree), nil
+
+}
+
+// isJSONMediaType checks whether a media type is JSON, including structured
+// syntax suffixes such as application/problem+json
+func isJSONMediaType(mediaType string) bool {
+
+	mediaType = strings.ToLower(mediaType)
+
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+
+}
+
+// schemaTypes lists the types that a schema allows, which can be a single type
+// or (in OpenAPI 3.1) a list of them
+func schemaTypes(schema map[string]interface{}) []string {
+
+	switch schemaType := schema["type"].(type) {
+
+	case string:
+
+		return []string{schemaType}
+
+	case []interface{}:
+
+		types := []string{}
+
+		for _, option := range schemaType {
+
+			if option, ok := option.(string); ok {
+				types = append(types, option)
+			}
+
+		}
+
+		return types
+
+	}
+
+	return nil
+
+}
+
+// matchesSchemaType checks whether a value has one of a number of types
+func matchesSchemaType(value interface{}, types []string) bool {
+
+	for _, schemaType := range types {
+
+		number, isNumber := specNumber(value)
+
+		switch schemaType {
+		case "null":
+			if value == nil {
+				return true
+			}
+		case "boolean":
+			if _, ok := value.(bool); ok {
+				return true
+			}
+		case "string":
+			if _, ok := value.(string); ok {
+				return true
+			}
+		case "integer":
+			if isNumber && number == math.Trunc(number) && !math.IsInf(number, 0) {
+				return true
+			}
+		case "number":
+			if isNumber {
+				return true
+			}
+		case "array":
+			if _, ok := value.([]interface{}); ok {
+				return true
+			}
+		case "object":
+			if _, ok := value.(map[string]interface{}); ok {
+				return true
+			}
+		}
+
+	}
+
+	return false
+
+}
+
+// containsSpecValue checks whether a list contains a value, comparing them as
+// JSON so that numbers of different types are equal
+func containsSpecValue(options []interface{}, value interface{}) bool {
+
+	encodedValue, _ := json.Marshal(value)
+
+	for _, option := range options {
+
+		if encodedOption, _ := json.Marshal(option); bytes.Equal(encodedOption, encodedValue) {
+			return true
+		}
+
+	}
+
+	return false
+
+}
+
+// describeSpecValue describes a value from a schema for an error message,
+// where values other than strings are described as JSON
+func describeSpecValue(value interface{}) string {
+
+	if text, ok := value.(string); ok {
+		return text
+	}
+
+	encoded, _ := json.Marshal(value)
+
+	return string(encoded)
+
+}
+
+// specNumber converts a decoded number into a float64, reporting whether the
+// value is a number at all
+func specNumber(value interface{}) (float64, bool) {
+
+	switch number := value.(type) {
+	case int64:
+		return float64(number), true
+	case uint64:
+		return float64(number), true
+	case float64:
+		return number, true
+	case int:
+		return float64(number), true
+	}
+
+	return 0, false
+
+}
+
+// formatSpecNumber formats a number from a schema for an error message
+func formatSpecNumber(number float64) string {
+
+	return strconv.FormatFloat(number, 'f', -1, 64)
+
+}
+
+// uniqueSorted removes repeated strings from a sorted list
+func uniqueSorted(values []string) []string {
+
+	unique := []string{}
+
+	for i, value := range values {
+
+		if i == 0 || value != values[i-1] {
+			unique = append(unique, value)
+		}
+
+	}
+
+	return unique
+
+}
@@ -0,0 +1,287 @@
+package jsonserver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testSpec is an OpenAPI document used to test validating requests
+const testSpec = `
+openapi: 3.0.3
+info:
+  title: Shop
+  version: 1.0.0
+servers:
+  - url: https://shop.example.com/api
+paths:
+  /products:
+    post:
+      parameters:
+        - name: X-Request-Id
+          in: header
+          required: true
+          schema:
+            type: string
+            format: uuid
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema:
+              $ref: '#/components/schemas/Product'
+      responses:
+        '201':
+          description: Created
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Product'
+  /products/{id}:
+    parameters:
+      - name: id
+        in: path
+        required: true
+        schema:
+          type: integer
+          minimum: 1
+    get:
+      parameters:
+        - name: fields
+          in: query
+          schema:
+            type: array
+            items:
+              type: string
+              enum: [name, price]
+        - name: limit
+          in: query
+          schema:
+            type: integer
+            maximum: 50
+      responses:
+        '200':
+          description: OK
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Product'
+        4XX:
+          description: Error
+components:
+  schemas:
+    Product:
+      type: object
+      additionalProperties: false
+      required: [id, name, price]
+      properties:
+        id:
+          type: integer
+          readOnly: true
+        name:
+          type: string
+          minLength: 2
+          pattern: '^[A-Z]'
+        price:
+          type: number
+          exclusiveMinimum: true
+          minimum: 0
+        tags:
+          type: array
+          uniqueItems: true
+          items:
+            type: string
+        colour:
+          type: string
+          nullable: true
+          enum: [red, green, null]
+`
+
+// testValidatorServer creates a server whose routes validate requests (and
+// responses) against the test document
+func testValidatorServer(t *testing.T, responses map[string]string, report func(request *http.Request, err error)) *Server {
+
+	validator, err := NewOpenAPIValidator([]byte(testSpec))
+
+	if err != nil {
+		t.Fatalf("Spec could not be loaded (error: %v)", err)
+	}
+
+	server := NewServer()
+	middleware := []Middleware{validator.Middleware()}
+
+	action := func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) {
+
+		response.Header().Set("Content-Type", "application/json")
+
+		if request.Method == "POST" {
+			response.WriteHeader(http.StatusCreated)
+		}
+
+		response.Write([]byte(responses[request.URL.Path]))
+
+	}
+
+	if report != nil {
+		server.Wrap(validator.ValidateResponses(report))
+	}
+
+	server.RegisterRoute("POST|DELETE", "/api/products", middleware, action)
+	server.RegisterRoute("GET", "/api/products/{id}", middleware, action)
+	server.RegisterRoute("GET", "/elsewhere", middleware, action)
+
+	return server
+
+}
+
+// TestOpenAPIValidatorPermitsValidRequests tests that requests that match the
+// document reach the route's action
+func TestOpenAPIValidatorPermitsValidRequests(t *testing.T) {
+
+	server := testValidatorServer(t, map[string]string{}, nil)
+	requestID := map[string]string{"X-Request-Id": "123e4567-e89b-12d3-a456-426614174000"}
+
+	requests := []*httptest.ResponseRecorder{
+		testRequest(server, "GET", "/api/products/4?fields=name&fields=price&limit=10", nil, nil),
+		testRequest(server, "HEAD", "/api/products/4", nil, nil),
+		testRequest(server, "POST", "/api/products", strings.NewReader(`{"name":"Chair","price":9.5,"tags":["wood"],"colour":null}`), requestID),
+		testRequest(server, "POST", "/api/products/", strings.NewReader(`{"name":"Table","price":20}`), requestID),
+	}
+
+	for i, response := range requests {
+
+		if response.Code != http.StatusOK && response.Code != http.StatusCreated {
+			t.Errorf("Request %v was denied (status code: %v, body: %v)", i, response.Code, response.Body.String())
+		}
+
+	}
+
+}
+
+// TestOpenAPIValidatorDeniesInvalidRequests tests that requests that break the
+// document's rules receive a 400 response listing every violation
+func TestOpenAPIValidatorDeniesInvalidRequests(t *testing.T) {
+
+	server := testValidatorServer(t, map[string]string{}, nil)
+
+	requests := map[*httptest.ResponseRecorder]string{
+		testRequest(server, "GET", "/api/products/0?fields=name,colour&limit=many", nil, nil):                                                                                           `{"errors":[{"field":"path.id","rule":"minimum","message":"must be at least 1"},{"field":"query.fields[0]","rule":"enum","message":"must be one of name, price"},{"field":"query.limit","rule":"type","message":"must be of type integer"}],"message":"Request does not match the API specification","success":false}`,
+		testRequest(server, "POST", "/api/products", strings.NewReader(`{"name":"chair","price":0,"tags":["a","a"],"colour":"blue","size":3}`), map[string]string{"X-Request-Id": "1"}): `{"errors":[{"field":"header.X-Request-Id","rule":"format","message":"must be a valid uuid"},{"field":"body.colour","rule":"enum","message":"must be one of red, green, null"},{"field":"body.name","rule":"pattern","message":"must match the pattern ^[A-Z]"},{"field":"body.price","rule":"exclusiveMinimum","message":"must be greater than 0"},{"field":"body.size","rule":"additionalProperties","message":"is not allowed"},{"field":"body.tags","rule":"uniqueItems","message":"must not contain duplicate items"}],"message":"Request does not match the API specification","success":false}`,
+		testRequest(server, "POST", "/api/products", nil, nil):                                                                                                                          `{"errors":[{"field":"header.X-Request-Id","rule":"required","message":"is required"},{"field":"body","rule":"required","message":"is required"}],"message":"Request does not match the API specification","success":false}`,
+		testRequest(server, "POST", "/api/products", strings.NewReader(`{"name":`), nil):                                                                                                `{"errors":[{"field":"header.X-Request-Id","rule":"required","message":"is required"},{"field":"body","rule":"format","message":"could not be decoded as application/json"}],"message":"Request does not match the API specification","success":false}`,
+		testRequest(server, "POST", "/api/products", strings.NewReader(`name: Chair`), map[string]string{"Content-Type": "application/yaml"}):                                           `{"errors":[{"field":"header.X-Request-Id","rule":"required","message":"is required"},{"field":"body","rule":"contentType","message":"must have a content type of application/json"}],"message":"Request does not match the API specification","success":false}`,
+	}
+
+	for response, expected := range requests {
+
+		if response.Code != http.StatusBadRequest || response.Body.String() != expected {
+			t.Errorf("Incorrect response (status code: %v, body: %v)", response.Code, response.Body.String())
+		}
+
+	}
+
+}
+
+// TestOpenAPIValidatorDeniesUndocumentedRequests tests that requests for
+// paths and methods that are not in the document are denied
+func TestOpenAPIValidatorDeniesUndocumentedRequests(t *testing.T) {
+
+	server := testValidatorServer(t, map[string]string{}, nil)
+
+	notFound := testRequest(server, "GET", "/elsewhere", nil, nil)
+	notAllowed := testRequest(server, "DELETE", "/api/products", nil, nil)
+
+	if notFound.Code != http.StatusNotFound || notFound.Body.String() != `{"message":"Could not find /elsewhere","success":false}` {
+		t.Errorf("Undocumented path was not denied (status code: %v, body: %v)", notFound.Code, notFound.Body.String())
+	}
+
+	if notAllowed.Code != http.StatusMethodNotAllowed || notAllowed.Header().Get("Allow") != "POST" {
+		t.Errorf("Undocumented method was not denied (status code: %v, allow: %v)", notAllowed.Code, notAllowed.Header().Get("Allow"))
+	}
+
+}
+
+// TestOpenAPIValidatorValidatesResponses tests that responses that break the
+// document's rules are reported without being changed
+func TestOpenAPIValidatorValidatesResponses(t *testing.T) {
+
+	reported := map[string]string{}
+
+	server := testValidatorServer(t, map[string]string{
+		"/api/products/1": `{"id":1,"name":"Chair","price":9.5}`,
+		"/api/products/2": `{"id":"2","name":"Chair"}`,
+		"/api/products":   `{"name":"Chair","price":9.5}`,
+	}, func(request *http.Request, err error) {
+		reported[request.URL.Path] = err.Error()
+	})
+
+	valid := testRequest(server, "GET", "/api/products/1", nil, nil)
+	invalid := testRequest(server, "GET", "/api/products/2", nil, nil)
+	testRequest(server, "POST", "/api/products", strings.NewReader(`{"name":"Chair","price":9.5}`), map[string]string{"X-Request-Id": "123e4567-e89b-12d3-a456-426614174000"})
+
+	expected := map[string]string{
+		"/api/products/2": "body.price: is required; body.id: must be of type integer",
+		"/api/products":   "body.id: is required",
+	}
+
+	if len(reported) != len(expected) || reported["/api/products/2"] != expected["/api/products/2"] || reported["/api/products"] != expected["/api/products"] {
+		t.Errorf("Incorrect violations reported (expected: %v, actual: %v)", expected, reported)
+	}
+
+	if valid.Code != http.StatusOK || invalid.Code != http.StatusOK || invalid.Body.String() != `{"id":"2","name":"Chair"}` {
+		t.Errorf("Responses were changed (status codes: %v and %v, body: %v)", valid.Code, invalid.Code, invalid.Body.String())
+	}
+
+}
+
+// TestLoadOpenAPIValidator tests loading a JSON document from a file
+func TestLoadOpenAPIValidator(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "openapi.json")
+
+	os.WriteFile(path, []byte(`{"openapi":"3.1.0","info":{"title":"Shop","version":"1.0.0"},"paths":{"/files/{name}.{format}":{"get":{"parameters":[{"name":"format","in":"path","schema":{"type":"string","enum":["csv"]}}],"responses":{"200":{"description":"OK"}}}}}}`), 0644)
+
+	validator, err := LoadOpenAPIValidator(path)
+
+	if err != nil {
+		t.Fatalf("Spec could not be loaded (error: %v)", err)
+	}
+
+	match, _ := validator.match(httptest.NewRequest("GET", "/files/report.pdf", nil))
+
+	if match == nil || match.pathValues["name"] != "report" || match.pathValues["format"] != "pdf" {
+		t.Fatalf("Request was not matched (match: %v)", match)
+	}
+
+	if validationErrors := validator.validateRequest(context.Background(), httptest.NewRequest("GET", "/files/report.pdf", nil), []byte{}, match); len(validationErrors) != 1 || validationErrors[0].Field != "path.format" {
+		t.Errorf("Path parameter was not validated (errors: %v)", validationErrors)
+	}
+
+}
+
+// TestOpenAPIValidatorRejectsInvalidSpecs tests that documents that cannot be
+// used are rejected when they are loaded
+func TestOpenAPIValidatorRejectsInvalidSpecs(t *testing.T) {
+
+	specs := map[string]string{
+		`{"swagger":"2.0"}`: "openapi: spec is not an OpenAPI 3 document",
+		`{"openapi":"3.0.0","paths":{"/":{"get":{"responses":{"200":{"$ref":"#/components/responses/Missing"}}}}}}`:                             `openapi: unresolvable reference "#/components/responses/Missing"`,
+		`{"openapi":"3.0.0","paths":{},"components":{"schemas":{"A":{"$ref":"#/components/schemas/B"},"B":{"$ref":"#/components/schemas/A"}}}}`: "openapi: references refer to each other",
+		`{"openapi":"3.0.0","paths":{},"components":{"schemas":{"A":{"$ref":"other.yaml#/A"}}}}`:                                                `openapi: unsupported reference "other.yaml#/A"`,
+		`{"openapi":"3.0.0","paths":{},"components":{"schemas":{"A":{"type":"string","pattern":"("}}}}`:                                         "openapi: invalid pattern \"(\": error parsing regexp: missing closing ): `(`",
+		"openapi: [3.0.0": "openapi: spec could not be decoded",
+	}
+
+	for spec, expected := range specs {
+
+		if _, err := NewOpenAPIValidator([]byte(spec)); err == nil || !strings.HasPrefix(err.Error(), expected) {
+			t.Errorf("Incorrect error for %v (error: %v)", spec, err)
+		}
+
+	}
+
+}
@@ -1,18 +1,100 @@
 package jsonserver
 
 import (
+	"bytes"
 	"encoding/json"
 	"net/http"
 )
 
+// WriteOption is a function that configures how WriteJSON writes a response
+type WriteOption func(*writeOptions)
+
+// writeOptions holds the configuration used by WriteJSON
+type writeOptions struct {
+	indent     string
+	escapeHTML bool
+	headers    http.Header
+}
+
+// failedWriteBody is sent in place of a value that could not be encoded
+var failedWriteBody = []byte(`{"message":"Internal server error","success":false}`)
+
+// WithIndent indents JSON responses, with each level of nesting indented by
+// the given string
+func WithIndent(indent string) WriteOption {
+
+	return func(options *writeOptions) {
+		options.indent = indent
+	}
+
+}
+
+// WithHTMLEscaping sets whether <, > and & are escaped within strings in JSON
+// responses, which they are by default
+func WithHTMLEscaping(enabled bool) WriteOption {
+
+	return func(options *writeOptions) {
+		options.escapeHTML = enabled
+	}
+
+}
+
+// WithResponseHeader adds a header to a JSON response, replacing any header
+// that would otherwise be sent with the same key (including Content-Type)
+func WithResponseHeader(key string, value string) WriteOption {
+
+	return func(options *writeOptions) {
+		options.headers.Add(key, value)
+	}
+
+}
+
 // WriteResponse writes a JSON response back to the client
 func WriteResponse(response http.ResponseWriter, body *JSON, statusCode int) {
 
+	WriteJSON(response, statusCode, *body)
+
+}
+
+// WriteJSON writes any value back to the client as JSON. The value is encoded
+// before anything is written, so if it cannot be encoded a 500 response is
+// sent instead and the encoding error is returned; otherwise any error from
+// writing the response is returned
+func WriteJSON(response http.ResponseWriter, statusCode int, value interface{}, options ...WriteOption) error {
+
+	writeOptions := writeOptions{escapeHTML: true, headers: http.Header{}}
+
+	for _, option := range options {
+		option(&writeOptions)
+	}
+
+	buffer := bytes.Buffer{}
+	encoder := json.NewEncoder(&buffer)
+
+	encoder.SetEscapeHTML(writeOptions.escapeHTML)
+	encoder.SetIndent("", writeOptions.indent)
+
+	if err := encoder.Encode(value); err != nil {
+
+		response.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		response.WriteHeader(http.StatusInternalServerError)
+		response.Write(failedWriteBody)
+
+		return err
+
+	}
+
 	response.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	for key, values := range writeOptions.headers {
+		response.Header()[key] = values
+	}
+
 	response.WriteHeader(statusCode)
 
-	jsonString, _ := json.Marshal(*body)
+	// The encoder ends the JSON with a newline that is not part of the value
+	_, err := response.Write(bytes.TrimSuffix(buffer.Bytes(), []byte("\n")))
 
-	response.Write(jsonString)
+	return err
 
 }
@@ -1,6 +1,7 @@
 package jsonserver
 
 import (
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -29,3 +30,90 @@ func TestWriteResponse(t *testing.T) {
 	}
 
 }
+
+// testFailingWriter is a response writer whose writes fail
+type testFailingWriter struct {
+	*httptest.ResponseRecorder
+}
+
+// Write fails
+func (writer testFailingWriter) Write(body []byte) (int, error) {
+
+	return 0, errors.New("connection reset")
+
+}
+
+// TestWriteJSON tests writing values other than JSON objects back to the client
+func TestWriteJSON(t *testing.T) {
+
+	type testItem struct {
+		Name string `json:"name"`
+	}
+
+	values := map[string]interface{}{
+		`[{"name":"Chair"},{"name":"Table"}]`: []testItem{{"Chair"}, {"Table"}},
+		`{"name":"Chair"}`:                    &testItem{"Chair"},
+		`42`:                                  42,
+		`"\u003cb\u003e"`:                     "<b>",
+		`null`:                                nil,
+	}
+
+	for expected, value := range values {
+
+		responseWriter := httptest.NewRecorder()
+
+		if err := WriteJSON(responseWriter, http.StatusOK, value); err != nil {
+			t.Errorf("Unexpected error writing %v: %v", expected, err)
+		}
+
+		if responseWriter.Code != http.StatusOK || responseWriter.Body.String() != expected {
+			t.Errorf("Incorrect body (expected: %v, actual: %v)", expected, responseWriter.Body.String())
+		}
+
+	}
+
+}
+
+// TestWriteJSONOptions tests indenting, HTML escaping and extra headers
+func TestWriteJSONOptions(t *testing.T) {
+
+	responseWriter := httptest.NewRecorder()
+
+	WriteJSON(responseWriter, http.StatusCreated, JSON{"html": "<b>"}, WithIndent("  "), WithHTMLEscaping(false), WithResponseHeader("Location", "/items/1"), WithResponseHeader("Content-Type", "application/vnd.api+json"))
+
+	if responseWriter.Body.String() != "{\n  \"html\": \"<b>\"\n}" {
+		t.Errorf("Incorrect body (actual: %v)", responseWriter.Body.String())
+	}
+
+	if responseWriter.Header().Get("Location") != "/items/1" || responseWriter.Header().Get("Content-Type") != "application/vnd.api+json" {
+		t.Errorf("Extra headers were not sent (headers: %v)", responseWriter.Header())
+	}
+
+}
+
+// TestWriteJSONEncodingError tests that a 500 response is sent and the error
+// returned if a value cannot be encoded
+func TestWriteJSONEncodingError(t *testing.T) {
+
+	responseWriter := httptest.NewRecorder()
+
+	err := WriteJSON(responseWriter, http.StatusOK, JSON{"channel": make(chan int)}, WithResponseHeader("Location", "/items/1"))
+
+	if err == nil {
+		t.Errorf("Encoding error was not returned")
+	}
+
+	if responseWriter.Code != http.StatusInternalServerError || responseWriter.Body.String() != `{"message":"Internal server error","success":false}` || responseWriter.Header().Get("Location") != "" {
+		t.Errorf("Error response was not sent (status code: %v, body: %v)", responseWriter.Code, responseWriter.Body.String())
+	}
+
+}
+
+// TestWriteJSONWriteError tests that errors writing the response are returned
+func TestWriteJSONWriteError(t *testing.T) {
+
+	if err := WriteJSON(testFailingWriter{httptest.NewRecorder()}, http.StatusOK, 42); err == nil {
+		t.Errorf("Write error was not returned")
+	}
+
+}
@@ -0,0 +1,94 @@
+package jsonserver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+)
+
+// problemContentType is the content type of RFC 7807 problem details
+const problemContentType = "application/problem+json"
+
+// Problem describes an error using RFC 7807 problem details, where any
+// extension members are written alongside the standard members
+type Problem struct {
+	Type       string
+	Title      string
+	Status     int
+	Detail     string
+	Instance   string
+	Extensions JSON
+}
+
+// MarshalJSON flattens the problem's extension members into the same object as
+// its standard members, leaving out any standard members that are empty
+func (problem Problem) MarshalJSON() ([]byte, error) {
+
+	body := map[string]interface{}{}
+
+	for key, value := range problem.Extensions {
+		body[key] = value
+	}
+
+	members := map[string]string{"type": problem.Type, "title": problem.Title, "detail": problem.Detail, "instance": problem.Instance}
+
+	for key, value := range members {
+
+		if value != "" {
+			body[key] = value
+		} else {
+			delete(body, key)
+		}
+
+	}
+
+	if problem.Status != 0 {
+		body["status"] = problem.Status
+	} else {
+		delete(body, "status")
+	}
+
+	return json.Marshal(body)
+
+}
+
+// WriteProblem writes an application/problem+json response back to the client,
+// with a type of about:blank and a title matching the HTTP code if the problem
+// does not have its own
+func WriteProblem(response http.ResponseWriter, problem *Problem) {
+
+	statusCode := problem.Status
+
+	if statusCode == 0 {
+		statusCode = http.StatusInternalServerError
+	}
+
+	withDefaults := *problem
+	withDefaults.Status = statusCode
+
+	if withDefaults.Type == "" {
+		withDefaults.Type = "about:blank"
+	}
+
+	if withDefaults.Title == "" {
+		withDefaults.Title = http.StatusText(statusCode)
+	}
+
+	response.Header().Set("Content-Type", problemContentType)
+	response.WriteHeader(statusCode)
+
+	jsonString, _ := json.Marshal(withDefaults)
+
+	response.Write(jsonString)
+
+}
+
+// serverFromContext obtains the server handling a request from its context, or
+// nil if the request is not being handled by a server
+func serverFromContext(ctx context.Context) *Server {
+
+	server, _ := ctx.Value(serverKey).(*Server)
+
+	return server
+
+}
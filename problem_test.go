@@ -0,0 +1,150 @@
+package jsonserver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testProblemServer creates a server that writes errors as problem details
+func testProblemServer() *Server {
+
+	server := NewServer()
+	server.ProblemDetails = true
+	server.MaxBodySize = 20
+
+	server.RegisterRoute("GET", "/forbidden", []Middleware{ErrorMiddleware(func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) error {
+		denial := Deny(http.StatusUnauthorized, "Token expired").WithHeader("WWW-Authenticate", "Bearer")
+		denial.Body["retry"] = true
+		return denial
+	}).Middleware()}, func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) {})
+
+	server.RegisterRoute("GET", "/denied", []Middleware{func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) (bool, int) {
+		return false, http.StatusForbidden
+	}}, func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) {})
+
+	server.RegisterRoute("GET", "/panic", []Middleware{}, func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) {
+		panic("oops")
+	})
+
+	server.RegisterRoute("GET", "/slow", []Middleware{}, func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) {
+		<-ctx.Done()
+	}, WithTimeout(10*time.Millisecond))
+
+	server.RegisterRoute("POST", "/upload", []Middleware{}, func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) {})
+
+	RegisterJSONRoute(server, "POST", "/products", []Middleware{}, func(ctx context.Context, request *http.Request, response http.ResponseWriter, product *testProduct) {})
+
+	server.OnPanic = func(ctx context.Context, request *http.Request, recovered interface{}, stack []byte) {}
+
+	return server
+
+}
+
+// TestProblemMarshalJSON tests that extension members are flattened alongside
+// the standard members and that empty members are left out
+func TestProblemMarshalJSON(t *testing.T) {
+
+	problem := Problem{Type: "https://example.com/out-of-stock", Status: 409, Detail: "Only 2 left", Extensions: JSON{"remaining": 2, "title": "Ignored"}}
+	expected := `{"detail":"Only 2 left","remaining":2,"status":409,"type":"https://example.com/out-of-stock"}`
+
+	jsonString, err := json.Marshal(problem)
+
+	if err != nil || string(jsonString) != expected {
+		t.Errorf("Problem was not marshalled correctly (expected: %v, actual: %v)", expected, string(jsonString))
+	}
+
+}
+
+// TestWriteProblem tests that problems are written with defaults filled in
+func TestWriteProblem(t *testing.T) {
+
+	response := httptest.NewRecorder()
+
+	WriteProblem(response, &Problem{Status: http.StatusConflict, Detail: "Already exists"})
+
+	expected := `{"detail":"Already exists","status":409,"title":"Conflict","type":"about:blank"}`
+
+	if response.Code != http.StatusConflict || response.Header().Get("Content-Type") != "application/problem+json" || response.Body.String() != expected {
+		t.Errorf("Problem was not written correctly (status code: %v, content type: %v, body: %v)", response.Code, response.Header().Get("Content-Type"), response.Body.String())
+	}
+
+}
+
+// TestServerProblemDetails tests that framework errors are written as problem
+// details when they are enabled
+func TestServerProblemDetails(t *testing.T) {
+
+	tests := []struct {
+		method   string
+		path     string
+		body     string
+		status   int
+		expected string
+	}{
+		{"GET", "/missing", "", 404, `{"detail":"Could not find /missing","instance":"/missing","status":404,"title":"Not Found","type":"about:blank"}`},
+		{"DELETE", "/panic", "", 405, `{"detail":"Method not allowed","instance":"/panic","status":405,"title":"Method Not Allowed","type":"about:blank"}`},
+		{"GET", "/forbidden", "", 401, `{"detail":"Token expired","instance":"/forbidden","retry":true,"status":401,"title":"Unauthorized","type":"about:blank"}`},
+		{"GET", "/denied", "", 403, `{"detail":"Access denied","instance":"/denied","status":403,"title":"Forbidden","type":"about:blank"}`},
+		{"GET", "/panic", "", 500, `{"detail":"Internal server error","instance":"/panic","status":500,"title":"Internal Server Error","type":"about:blank"}`},
+		{"GET", "/slow", "", 503, `{"detail":"Request timed out","instance":"/slow","status":503,"title":"Service Unavailable","type":"about:blank"}`},
+		{"POST", "/upload", "012345678901234567890", 413, `{"detail":"Request body too large","instance":"/upload","status":413,"title":"Request Entity Too Large","type":"about:blank"}`},
+		{"POST", "/products", `{"price":1}`, 400, `{"detail":"Request body is invalid","errors":[{"field":"name","rule":"required","message":"is required"}],"instance":"/products","status":400,"title":"Bad Request","type":"about:blank"}`},
+	}
+
+	server := testProblemServer()
+
+	for _, test := range tests {
+
+		response := testRequest(server, test.method, test.path, strings.NewReader(test.body), nil)
+
+		if response.Code != test.status || response.Header().Get("Content-Type") != "application/problem+json" || response.Body.String() != test.expected {
+			t.Errorf("Incorrect problem for %v %v (status code: %v, content type: %v, body: %v)", test.method, test.path, response.Code, response.Header().Get("Content-Type"), response.Body.String())
+		}
+
+	}
+
+}
+
+// TestServerProblemDetailsKeepsHeaders tests that headers needed by error
+// responses are still sent with problem details
+func TestServerProblemDetailsKeepsHeaders(t *testing.T) {
+
+	server := testProblemServer()
+	requests := map[string]*http.Request{
+		"WWW-Authenticate": httptest.NewRequest("GET", "/forbidden", nil),
+		"Allow":            httptest.NewRequest("DELETE", "/panic", nil),
+	}
+
+	for header, request := range requests {
+
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, request)
+
+		if response.Header().Get(header) == "" {
+			t.Errorf("%v header was not sent for %v", header, request.URL.Path)
+		}
+
+	}
+
+}
+
+// TestServerErrorsWithoutProblemDetails tests that framework errors keep the
+// standard error format unless problem details are enabled
+func TestServerErrorsWithoutProblemDetails(t *testing.T) {
+
+	server := testProblemServer()
+	server.ProblemDetails = false
+
+	response := testRequest(server, "GET", "/forbidden", nil, nil)
+
+	if response.Header().Get("Content-Type") != "application/json; charset=UTF-8" || response.Body.String() != `{"message":"Token expired","retry":true,"success":false}` {
+		t.Errorf("Standard error format was not used (content type: %v, body: %v)", response.Header().Get("Content-Type"), response.Body.String())
+	}
+
+}
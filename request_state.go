@@ -1,13 +1,36 @@
 package jsonserver
 
-// RequestState allows storage of miscellaneous state objects that can be referred to throughout a request
+import (
+	"sort"
+	"sync"
+)
+
+// RequestState allows storage of miscellaneous state objects that can be
+// referred to throughout a request, and is safe for concurrent use
 type RequestState struct {
-	state map[string]interface{}
+	state     map[string]interface{}
+	cleanups  []func()
+	completed bool
+	denial    *Denial
+	lock      sync.RWMutex
+}
+
+// GetAs obtains a state value as a particular type, reporting whether it
+// exists and has that type
+func GetAs[T any](requestState *RequestState, key string) (T, bool) {
+
+	value, ok := requestState.Get(key).(T)
+
+	return value, ok
+
 }
 
 // Get obtains a state value (or nil if it does not exist)
 func (requestState *RequestState) Get(key string) interface{} {
 
+	requestState.lock.RLock()
+	defer requestState.lock.RUnlock()
+
 	if value, ok := requestState.state[key]; ok {
 		return value
 	}
@@ -19,6 +42,9 @@ func (requestState *RequestState) Get(key string) interface{} {
 // Set stores a state value
 func (requestState *RequestState) Set(key string, value interface{}) {
 
+	requestState.lock.Lock()
+	defer requestState.lock.Unlock()
+
 	if requestState.state == nil {
 		requestState.state = map[string]interface{}{}
 	}
@@ -26,3 +52,100 @@ func (requestState *RequestState) Set(key string, value interface{}) {
 	requestState.state[key] = value
 
 }
+
+// Delete removes a state value
+func (requestState *RequestState) Delete(key string) {
+
+	requestState.lock.Lock()
+	defer requestState.lock.Unlock()
+
+	delete(requestState.state, key)
+
+}
+
+// Has checks whether a state value exists
+func (requestState *RequestState) Has(key string) bool {
+
+	requestState.lock.RLock()
+	defer requestState.lock.RUnlock()
+
+	_, ok := requestState.state[key]
+
+	return ok
+
+}
+
+// Keys lists the keys of all state values in alphabetical order
+func (requestState *RequestState) Keys() []string {
+
+	requestState.lock.RLock()
+	defer requestState.lock.RUnlock()
+
+	keys := make([]string, 0, len(requestState.state))
+
+	for key := range requestState.state {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+
+}
+
+// Cleanup registers a function to be called when the request completes, such
+// as to close a per-request resource. Cleanup functions are called in the
+// reverse order to which they were registered, and immediately if the request
+// has already completed
+func (requestState *RequestState) Cleanup(cleanup func()) {
+
+	requestState.lock.Lock()
+
+	if requestState.completed {
+		requestState.lock.Unlock()
+		cleanup()
+		return
+	}
+
+	requestState.cleanups = append(requestState.cleanups, cleanup)
+
+	requestState.lock.Unlock()
+
+}
+
+// complete marks the request as completed and calls its cleanup functions
+func (requestState *RequestState) complete() {
+
+	requestState.lock.Lock()
+
+	cleanups := requestState.cleanups
+	requestState.cleanups = nil
+	requestState.completed = true
+
+	requestState.lock.Unlock()
+
+	for i := len(cleanups) - 1; i >= 0; i-- {
+		cleanups[i]()
+	}
+
+}
+
+// setDenial records why middleware denied access to the request
+func (requestState *RequestState) setDenial(denial *Denial) {
+
+	requestState.lock.Lock()
+	defer requestState.lock.Unlock()
+
+	requestState.denial = denial
+
+}
+
+// getDenial obtains why middleware denied access to the request, if it said
+func (requestState *RequestState) getDenial() *Denial {
+
+	requestState.lock.RLock()
+	defer requestState.lock.RUnlock()
+
+	return requestState.denial
+
+}
@@ -1,6 +1,12 @@
 package jsonserver
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 )
 
@@ -20,3 +26,162 @@ func TestRequestStateGetterAndSetter(t *testing.T) {
 	}
 
 }
+
+// TestRequestStateTypedAccess tests obtaining state values as particular types
+func TestRequestStateTypedAccess(t *testing.T) {
+
+	requestState := &RequestState{}
+
+	requestState.Set("count", 3)
+
+	if value, ok := GetAs[int](requestState, "count"); !ok || value != 3 {
+		t.Errorf("Typed state mismatch (expected: %v, actual: %v)", 3, value)
+	}
+
+	if value, ok := GetAs[string](requestState, "count"); ok || value != "" {
+		t.Errorf("State unexpectedly obtained as the wrong type")
+	}
+
+	if _, ok := GetAs[int](requestState, "missing"); ok {
+		t.Errorf("Missing state unexpectedly obtained")
+	}
+
+}
+
+// TestRequestStateHasDeleteAndKeys tests checking for, removing and listing
+// state values
+func TestRequestStateHasDeleteAndKeys(t *testing.T) {
+
+	requestState := &RequestState{}
+
+	if requestState.Has("foo") || len(requestState.Keys()) != 0 {
+		t.Errorf("Empty state unexpectedly had values")
+	}
+
+	requestState.Set("foo", "bar")
+	requestState.Set("baz", nil)
+
+	if !requestState.Has("foo") || !requestState.Has("baz") {
+		t.Errorf("State values not found")
+	}
+
+	if keys := strings.Join(requestState.Keys(), ","); keys != "baz,foo" {
+		t.Errorf("Keys mismatch (expected: %v, actual: %v)", "baz,foo", keys)
+	}
+
+	requestState.Delete("foo")
+
+	if requestState.Has("foo") || requestState.Get("foo") != nil {
+		t.Errorf("State value not deleted")
+	}
+
+}
+
+// TestRequestStateConcurrentAccess tests using the state from several
+// goroutines at once (and is most useful when run with the race detector)
+func TestRequestStateConcurrentAccess(t *testing.T) {
+
+	requestState := &RequestState{}
+	waitGroup := sync.WaitGroup{}
+
+	for i := 0; i < 50; i++ {
+
+		waitGroup.Add(1)
+
+		go func(i int) {
+
+			defer waitGroup.Done()
+
+			key := strconv.Itoa(i)
+
+			requestState.Set(key, i)
+			requestState.Get(key)
+			requestState.Has(key)
+			requestState.Keys()
+
+		}(i)
+
+	}
+
+	waitGroup.Wait()
+
+	if len(requestState.Keys()) != 50 {
+		t.Errorf("State value count mismatch (expected: %v, actual: %v)", 50, len(requestState.Keys()))
+	}
+
+}
+
+// TestRequestStateCleanup tests that cleanup functions run in reverse order
+// when the request completes
+func TestRequestStateCleanup(t *testing.T) {
+
+	server := NewServer()
+	order := []string{}
+
+	server.RegisterRoute("GET", "/", []Middleware{}, func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) {
+
+		State(ctx).Cleanup(func() {
+			order = append(order, "first")
+		})
+
+		State(ctx).Cleanup(func() {
+			order = append(order, "second")
+		})
+
+		order = append(order, "action")
+
+	})
+
+	server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	if strings.Join(order, ", ") != "action, second, first" {
+		t.Errorf("Cleanup order mismatch (actual: %v)", order)
+	}
+
+}
+
+// TestRequestStateCleanupAfterPanic tests that cleanup functions still run
+// when an action panics
+func TestRequestStateCleanupAfterPanic(t *testing.T) {
+
+	server := NewServer()
+	cleanedUp := false
+
+	server.OnPanic = func(ctx context.Context, request *http.Request, recovered interface{}, stack []byte) {}
+
+	server.RegisterRoute("GET", "/", []Middleware{}, func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) {
+
+		State(ctx).Cleanup(func() {
+			cleanedUp = true
+		})
+
+		panic("action panic")
+
+	})
+
+	server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	if !cleanedUp {
+		t.Errorf("Cleanup function did not run")
+	}
+
+}
+
+// TestRequestStateCleanupAfterCompletion tests that cleanup functions
+// registered after the request has completed run immediately
+func TestRequestStateCleanupAfterCompletion(t *testing.T) {
+
+	requestState := &RequestState{}
+	cleanedUp := false
+
+	requestState.complete()
+
+	requestState.Cleanup(func() {
+		cleanedUp = true
+	})
+
+	if !cleanedUp {
+		t.Errorf("Cleanup function did not run")
+	}
+
+}
@@ -2,13 +2,54 @@ package jsonserver
 
 import (
 	"strings"
+	"time"
 )
 
 // Route structs define executable HTTP routes
 type Route struct {
-	Path       string
-	Action     RouteAction
-	Middleware []Middleware
+	Name          string
+	Path          string
+	Action        RouteAction
+	Middleware    []Middleware
+	Wrappers      []Wrapper
+	Timeout       time.Duration
+	MaxBodySize   int64
+	StreamBody    bool
+	DecodeOptions DecodeOptions
+	Docs          RouteDocs
+}
+
+// RouteOption configures optional behaviour of a route when it is registered
+type RouteOption func(route *Route)
+
+// WithWrappers wraps a route's action in wrappers, which run after the route's
+// middleware has allowed the request, with the first wrapper outermost
+func WithWrappers(wrappers ...Wrapper) RouteOption {
+
+	return func(route *Route) {
+		route.Wrappers = append(route.Wrappers, wrappers...)
+	}
+
+}
+
+// WithTimeout overrides the server's timeout for a route, where a negative
+// timeout disables it (so that the route's response is not buffered)
+func WithTimeout(timeout time.Duration) RouteOption {
+
+	return func(route *Route) {
+		route.Timeout = timeout
+	}
+
+}
+
+// WithName names a route, so that it can be identified in the route table and
+// its URL can be built with URL
+func WithName(name string) RouteOption {
+
+	return func(route *Route) {
+		route.Name = name
+	}
+
 }
 
 // MatchesPath checks whether the route's path matches a given path and returns any wildcard values
@@ -27,7 +68,7 @@ func (route *Route) MatchesPath(path string) (bool, RouteParams) {
 
 		for i, routePathFragment := range routePathFragments {
 
-			isWildcard := strings.HasPrefix(routePathFragment, "{") && strings.HasSuffix(routePathFragment, "}")
+			wildcardKey, constraintSource, isWildcard := parseWildcard(routePathFragment)
 			isFinalWildcard := hasFinalWildcard && i == (len(routePathFragments)-1)
 
 			// The route path no longer matches
@@ -35,6 +76,17 @@ func (route *Route) MatchesPath(path string) (bool, RouteParams) {
 				return false, RouteParams{}
 			}
 
+			// The wildcard's value does not satisfy its constraint
+			if isWildcard && isFinalWildcard == false {
+
+				constraint, err := compileConstraint(constraintSource)
+
+				if err != nil || (constraint != nil && !constraint.matches(pathFragments[i])) {
+					return false, RouteParams{}
+				}
+
+			}
+
 			// The route matches on a final wildcard, so compile the remaining route param values
 			if isFinalWildcard {
 
@@ -43,7 +95,6 @@ func (route *Route) MatchesPath(path string) (bool, RouteParams) {
 				// The route matches on a wildcard, so obtain its key and value
 			} else if isWildcard {
 
-				wildcardKey := routePathFragment[1 : len(routePathFragment)-1]
 				wildcardValues[wildcardKey] = pathFragments[i]
 
 			}
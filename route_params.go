@@ -0,0 +1,74 @@
+package jsonserver
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// dateLayout is the format of route parameters using the date constraint
+const dateLayout = "2006-01-02"
+
+// String obtains a route parameter's value, returning an error if it is not set
+func (routeParams RouteParams) String(name string) (string, error) {
+
+	if value, ok := routeParams[name]; ok {
+		return value, nil
+	}
+
+	return "", fmt.Errorf("route parameter %v is not set", name)
+
+}
+
+// Int obtains a route parameter's value as an int
+func (routeParams RouteParams) Int(name string) (int, error) {
+
+	value, err := routeParams.String(name)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.Atoi(value)
+
+}
+
+// Int64 obtains a route parameter's value as an int64
+func (routeParams RouteParams) Int64(name string) (int64, error) {
+
+	value, err := routeParams.String(name)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseInt(value, 10, 64)
+
+}
+
+// Float64 obtains a route parameter's value as a float64
+func (routeParams RouteParams) Float64(name string) (float64, error) {
+
+	value, err := routeParams.String(name)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseFloat(value, 64)
+
+}
+
+// Date obtains a route parameter's value as a time, parsed from the YYYY-MM-DD
+// format used by the date constraint
+func (routeParams RouteParams) Date(name string) (time.Time, error) {
+
+	value, err := routeParams.String(name)
+
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return time.Parse(dateLayout, value)
+
+}
@@ -0,0 +1,66 @@
+package jsonserver
+
+import (
+	"testing"
+	"time"
+)
+
+// TestRouteParamsTypedAccessors tests obtaining route parameters as typed
+// values
+func TestRouteParamsTypedAccessors(t *testing.T) {
+
+	routeParams := RouteParams{"id": "42", "big": "9007199254740993", "price": "9.99", "day": "2024-02-29", "slug": "chair"}
+
+	if value, err := routeParams.String("slug"); value != "chair" || err != nil {
+		t.Errorf("String mismatch (expected: %v, actual: %v)", "chair", value)
+	}
+
+	if value, err := routeParams.Int("id"); value != 42 || err != nil {
+		t.Errorf("Int mismatch (expected: %v, actual: %v)", 42, value)
+	}
+
+	if value, err := routeParams.Int64("big"); value != 9007199254740993 || err != nil {
+		t.Errorf("Int64 mismatch (expected: %v, actual: %v)", 9007199254740993, value)
+	}
+
+	if value, err := routeParams.Float64("price"); value != 9.99 || err != nil {
+		t.Errorf("Float64 mismatch (expected: %v, actual: %v)", 9.99, value)
+	}
+
+	if value, err := routeParams.Date("day"); !value.Equal(time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)) || err != nil {
+		t.Errorf("Date mismatch (expected: %v, actual: %v)", "2024-02-29", value)
+	}
+
+}
+
+// TestRouteParamsTypedAccessorErrors tests that missing and malformed route
+// parameters are reported
+func TestRouteParamsTypedAccessorErrors(t *testing.T) {
+
+	routeParams := RouteParams{"slug": "chair"}
+
+	if _, err := routeParams.String("id"); err == nil {
+		t.Errorf("Missing parameter was not reported")
+	}
+
+	if _, err := routeParams.Int("id"); err == nil {
+		t.Errorf("Missing parameter was not reported")
+	}
+
+	if _, err := routeParams.Int("slug"); err == nil {
+		t.Errorf("Malformed int was not reported")
+	}
+
+	if _, err := routeParams.Int64("slug"); err == nil {
+		t.Errorf("Malformed int64 was not reported")
+	}
+
+	if _, err := routeParams.Float64("slug"); err == nil {
+		t.Errorf("Malformed float was not reported")
+	}
+
+	if _, err := routeParams.Date("slug"); err == nil {
+		t.Errorf("Malformed date was not reported")
+	}
+
+}
@@ -0,0 +1,228 @@
+package jsonserver
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// RouteInfo describes a registered route, where Middleware is the number of
+// middleware functions that run before its action (including those of any
+// group it belongs to)
+type RouteInfo struct {
+	Method     string `json:"method"`
+	Path       string `json:"path"`
+	Name       string `json:"name"`
+	Middleware int    `json:"middleware"`
+}
+
+// RouteConflict describes two routes registered against the same method that
+// can both match the same URL, where the route that handles it depends on the
+// order in which they were registered
+type RouteConflict struct {
+	Method          string
+	Path            string
+	ConflictingPath string
+}
+
+// TestingT is the part of *testing.T used to report route conflicts in tests
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+// RouteTable lists the registered routes, ordered by path and then method
+func (router *Router) RouteTable() []RouteInfo {
+
+	table := []RouteInfo{}
+
+	for method, routes := range router.load().routes {
+
+		for _, route := range routes {
+			table = append(table, RouteInfo{Method: method, Path: route.Path, Name: route.Name, Middleware: len(route.Middleware)})
+		}
+
+	}
+
+	sort.Slice(table, func(i, j int) bool {
+
+		if table[i].Path != table[j].Path {
+			return table[i].Path < table[j].Path
+		}
+
+		return table[i].Method < table[j].Method
+
+	})
+
+	return table
+
+}
+
+// ServeRouteTable registers a GET route that serves the route table as JSON,
+// which is intended for debugging
+func (server *Server) ServeRouteTable(path string, middleware []Middleware) error {
+
+	return server.RegisterRoute("GET", path, middleware, func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) {
+
+		WriteResponse(response, &JSON{"routes": server.Router.RouteTable()}, http.StatusOK)
+
+	}, WithoutDocs())
+
+}
+
+// Conflicts lists pairs of routes registered against the same method that can
+// both match the same URL. Registering a route with the same shape as an
+// existing route is already an error, but routes whose wildcards have
+// different constraints that accept some of the same values (such as {id:int}
+// and {id:[0-9a-f]+}) are tried in the order in which they were registered,
+// even if a later fragment of the route registered second is more specific
+func (router *Router) Conflicts() []RouteConflict {
+
+	routes := router.load().routes
+	methods := []string{}
+	conflicts := []RouteConflict{}
+
+	for method := range routes {
+		methods = append(methods, method)
+	}
+
+	sort.Strings(methods)
+
+	for _, method := range methods {
+
+		methodRoutes := routes[method]
+
+		for i := range methodRoutes {
+
+			for j := i + 1; j < len(methodRoutes); j++ {
+
+				if pathsConflict(methodRoutes[i].Path, methodRoutes[j].Path) {
+					conflicts = append(conflicts, RouteConflict{Method: method, Path: methodRoutes[j].Path, ConflictingPath: methodRoutes[i].Path})
+				}
+
+			}
+
+		}
+
+	}
+
+	return conflicts
+
+}
+
+// Error describes the conflict
+func (conflict RouteConflict) Error() string {
+
+	return conflict.Method + " " + conflict.Path + " conflicts with " + conflict.ConflictingPath
+
+}
+
+// AssertNoRouteConflicts fails a test for every pair of conflicting routes
+// registered with a router
+func AssertNoRouteConflicts(t TestingT, router *Router) {
+
+	t.Helper()
+
+	for _, conflict := range router.Conflicts() {
+		t.Errorf("Route conflict: %v", conflict.Error())
+	}
+
+}
+
+// pathsConflict checks whether two route paths with different shapes can
+// match the same URL, with the route chosen depending on the order in which
+// they were registered. This is the case when the first fragments in which
+// the paths differ are constrained wildcards that accept some of the same
+// values (as their branches are tried in registration order, and the first to
+// match wins), and the rest of the paths can match the same fragments
+func pathsConflict(first string, second string) bool {
+
+	firstFragments := strings.Split(normalisePath(first), "/")
+	secondFragments := strings.Split(normalisePath(second), "/")
+	diverged := false
+
+	for i := 0; i < len(firstFragments) || i < len(secondFragments); i++ {
+
+		if i == len(firstFragments) || i == len(secondFragments) {
+			return false
+		}
+
+		firstIsFinalWildcard := i == len(firstFragments)-1 && firstFragments[i] == ":"
+		secondIsFinalWildcard := i == len(secondFragments)-1 && secondFragments[i] == ":"
+		_, firstConstraint, firstIsWildcard := parseWildcard(firstFragments[i])
+		_, secondConstraint, secondIsWildcard := parseWildcard(secondFragments[i])
+
+		switch {
+
+		// A final wildcard matches whatever remains of the URL, so it only
+		// conflicts once the paths are in different branches
+		case firstIsFinalWildcard || secondIsFinalWildcard:
+
+			return diverged
+
+		case diverged:
+
+			if !fragmentsOverlap(firstFragments[i], secondFragments[i]) {
+				return false
+			}
+
+		// Fragments that are the same kind of fragment with the same constraint
+		// (or static fragments with the same text) share a branch
+		case firstIsWildcard == secondIsWildcard && firstConstraint == secondConstraint && (firstIsWildcard || firstFragments[i] == secondFragments[i]):
+
+			continue
+
+		// Otherwise the more specific fragment is preferred, unless both are
+		// constrained wildcards
+		case !firstIsWildcard || !secondIsWildcard || firstConstraint == "" || secondConstraint == "":
+
+			return false
+
+		case !constraintsOverlap(firstConstraint, secondConstraint):
+
+			return false
+
+		default:
+
+			diverged = true
+
+		}
+
+	}
+
+	return diverged
+
+}
+
+// fragmentsOverlap checks whether two route path fragments can match the same
+// URL fragment
+func fragmentsOverlap(first string, second string) bool {
+
+	_, firstConstraint, firstIsWildcard := parseWildcard(first)
+	_, secondConstraint, secondIsWildcard := parseWildcard(second)
+
+	switch {
+
+	case !firstIsWildcard && !secondIsWildcard:
+
+		return first == second
+
+	case firstIsWildcard && secondIsWildcard:
+
+		return firstConstraint == "" || secondConstraint == "" || constraintsOverlap(firstConstraint, secondConstraint)
+
+	}
+
+	// A wildcard matches a static fragment that satisfies its constraint
+	staticFragment, constraintSource := first, secondConstraint
+
+	if firstIsWildcard {
+		staticFragment, constraintSource = second, firstConstraint
+	}
+
+	constraint, err := compileConstraint(constraintSource)
+
+	return err == nil && (constraint == nil || constraint.matches(staticFragment))
+
+}
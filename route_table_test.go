@@ -0,0 +1,120 @@
+package jsonserver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// testReporter records the failures reported by test helpers
+type testReporter struct {
+	failures []string
+}
+
+// Helper does nothing, as failures are recorded rather than reported
+func (reporter *testReporter) Helper() {}
+
+// Errorf records a failure
+func (reporter *testReporter) Errorf(format string, args ...interface{}) {
+
+	reporter.failures = append(reporter.failures, fmt.Sprintf(format, args...))
+
+}
+
+// TestRouteTable tests listing the registered routes
+func TestRouteTable(t *testing.T) {
+
+	router := Router{}
+	api := router.Group("/api", testTableMiddleware)
+
+	router.RegisterRoute("GET|DELETE", "/products/{id:int}", []Middleware{}, testOpenAPIAction, WithName("product"))
+	api.RegisterRoute("POST", "/orders", []Middleware{testTableMiddleware}, testOpenAPIAction)
+
+	expected := []RouteInfo{
+		{Method: "POST", Path: "/api/orders", Middleware: 2},
+		{Method: "DELETE", Path: "/products/{id:int}", Name: "product"},
+		{Method: "GET", Path: "/products/{id:int}", Name: "product"},
+	}
+
+	if table := router.RouteTable(); !reflect.DeepEqual(table, expected) {
+		t.Errorf("Incorrect route table (expected: %v, actual: %v)", expected, table)
+	}
+
+}
+
+// TestServeRouteTable tests serving the route table as JSON
+func TestServeRouteTable(t *testing.T) {
+
+	server := NewServer()
+
+	server.ServeRouteTable("/debug/routes", []Middleware{testTableMiddleware})
+	server.RegisterRoute("GET", "/products", []Middleware{}, testOpenAPIAction, WithName("products"))
+
+	response := testRequest(server, "GET", "/debug/routes", nil, nil)
+
+	expected := `{"routes":[{"method":"GET","path":"/debug/routes","name":"","middleware":1},{"method":"GET","path":"/products","name":"products","middleware":0}]}`
+
+	if response.Code != http.StatusOK || response.Body.String() != expected {
+		t.Errorf("Incorrect route table served (status code: %v, body: %v)", response.Code, response.Body.String())
+	}
+
+}
+
+// TestRouteConflicts tests finding routes that can match the same URL with
+// the same precedence
+func TestRouteConflicts(t *testing.T) {
+
+	router := Router{}
+
+	router.RegisterRoute("GET", "/products/{id:int}", []Middleware{}, testOpenAPIAction)
+	router.RegisterRoute("GET", "/products/{id:uuid}", []Middleware{}, testOpenAPIAction)
+	router.RegisterRoute("GET|PUT", "/products/{sku:[0-9A-Z]+}", []Middleware{}, testOpenAPIAction)
+	router.RegisterRoute("GET", "/products/new", []Middleware{}, testOpenAPIAction)
+	router.RegisterRoute("GET", "/products/{id}", []Middleware{}, testOpenAPIAction)
+	router.RegisterRoute("GET", "/files/{kind:[a-z]+}/:", []Middleware{}, testOpenAPIAction)
+	router.RegisterRoute("GET", "/files/{kind:(?i)PDF}/:", []Middleware{}, testOpenAPIAction)
+	router.RegisterRoute("GET", "/files/{kind:[a-z]+}/{name}", []Middleware{}, testOpenAPIAction)
+	router.RegisterRoute("GET", "/a/{x:int}/{z}", []Middleware{}, testOpenAPIAction)
+	router.RegisterRoute("GET", "/a/{y:[0-9]+}/b", []Middleware{}, testOpenAPIAction)
+	router.RegisterRoute("GET", "/a/{y:[0-9]+}/{z:[0-9]+}/c", []Middleware{}, testOpenAPIAction)
+	router.RegisterRoute("GET", "/a/{y:[0-9]+}/{z:[a-z]+}/d", []Middleware{}, testOpenAPIAction)
+	router.RegisterRoute("GET", "/a/{x:int}/{z:[a-z]+}/d/e", []Middleware{}, testOpenAPIAction)
+
+	expected := []RouteConflict{
+		{Method: "GET", Path: "/products/{sku:[0-9A-Z]+}", ConflictingPath: "/products/{id:int}"},
+		{Method: "GET", Path: "/files/{kind:(?i)PDF}/:", ConflictingPath: "/files/{kind:[a-z]+}/:"},
+		{Method: "GET", Path: "/files/{kind:[a-z]+}/{name}", ConflictingPath: "/files/{kind:(?i)PDF}/:"},
+		{Method: "GET", Path: "/a/{y:[0-9]+}/b", ConflictingPath: "/a/{x:int}/{z}"},
+	}
+
+	if conflicts := router.Conflicts(); !reflect.DeepEqual(conflicts, expected) {
+		t.Errorf("Incorrect conflicts (expected: %v, actual: %v)", expected, conflicts)
+	}
+
+	reporter := &testReporter{}
+
+	AssertNoRouteConflicts(reporter, &router)
+
+	if len(reporter.failures) != 4 || reporter.failures[0] != "Route conflict: GET /products/{sku:[0-9A-Z]+} conflicts with /products/{id:int}" {
+		t.Errorf("Conflicts were not reported (failures: %v)", reporter.failures)
+	}
+
+	reporter = &testReporter{}
+
+	AssertNoRouteConflicts(reporter, &Router{})
+
+	if len(reporter.failures) != 0 {
+		t.Errorf("Conflicts were reported without any routes (failures: %v)", reporter.failures)
+	}
+
+}
+
+// testTableMiddleware is middleware that permits every request, used to test
+// the route table
+func testTableMiddleware(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) (bool, int) {
+
+	return true, 0
+
+}
@@ -142,6 +142,34 @@ func TestMatchesURLWithOnlyFinalWildcard(t *testing.T) {
 
 }
 
+// TestMatchesConstrainedURL tests route path matching against URLs that do and
+// do not satisfy wildcard constraints
+func TestMatchesConstrainedURL(t *testing.T) {
+
+	action := func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) {}
+	route := Route{Path: "/shop/{category:[a-z]+}/products/{id:int}", Action: action, Middleware: []Middleware{}}
+	matches, params := route.MatchesPath("/shop/kitchen/products/123")
+
+	if matches != true {
+		t.Errorf("Route mismatch (pattern %v should cover URL %v)", route.Path, "/shop/kitchen/products/123")
+	}
+
+	if len(params) != 2 || params["id"] != "123" || params["category"] != "kitchen" {
+		t.Errorf("Param mismatch (expected: %v, actual: %v)", "map[category:kitchen id:123]", params)
+	}
+
+	matches, params = route.MatchesPath("/shop/kitchen/products/chair")
+
+	if matches != false {
+		t.Errorf("Erroneous route match (pattern %v should not cover URL %v)", route.Path, "/shop/kitchen/products/chair")
+	}
+
+	if len(params) != 0 {
+		t.Errorf("Param mismatch (expected: %v, actual: %v)", "[]", params)
+	}
+
+}
+
 // TestNormalisePath tests normalisation of URL paths
 func TestNormalisePath(t *testing.T) {
 
@@ -0,0 +1,105 @@
+package jsonserver
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// ErrUnknownRouteName is returned when building the URL of a route that has
+// not been registered
+var ErrUnknownRouteName = errors.New("unknown route name")
+
+// ErrDuplicateRouteName is returned when registering a route with a name that
+// is already used by a route with a different path
+var ErrDuplicateRouteName = errors.New("duplicate route name")
+
+// URL builds the path of a named route from the values of its parameters,
+// which are escaped as necessary, followed by a query string if there are any
+// query parameters. The value of a final wildcard is given as {catchAll} and
+// can contain slashes. An error is returned if no route has the name, or if a
+// parameter is missing, does not satisfy its constraint or cannot be matched
+// by the route (as it contains a slash, or is a . or .. segment that would be
+// resolved away)
+func (router *Router) URL(name string, routeParams RouteParams, query url.Values) (string, error) {
+
+	path, ok := router.load().names[name]
+
+	if !ok {
+		return "", fmt.Errorf("%w: %v", ErrUnknownRouteName, name)
+	}
+
+	routePathFragments := strings.Split(normalisePath(path), "/")
+
+	for i, routePathFragment := range routePathFragments {
+
+		paramName, constraintSource, isWildcard := parseWildcard(routePathFragment)
+
+		if routePathFragment == ":" && i == len(routePathFragments)-1 {
+			paramName, isWildcard = "{catchAll}", true
+		}
+
+		if !isWildcard {
+			continue
+		}
+
+		value, err := routeParams.String(paramName)
+
+		if err != nil {
+			return "", fmt.Errorf("cannot build URL for route %v: %w", name, err)
+		}
+
+		if value == "" {
+			return "", fmt.Errorf("cannot build URL for route %v: route parameter %v is empty", name, paramName)
+		}
+
+		// Paths are matched after they have been decoded, so an escaped slash
+		// would split the value across fragments
+		if paramName != "{catchAll}" && strings.Contains(value, "/") {
+			return "", fmt.Errorf("cannot build URL for route %v: route parameter %v contains a slash", name, paramName)
+		}
+
+		for _, segment := range strings.Split(value, "/") {
+
+			if segment == "." || segment == ".." {
+				return "", fmt.Errorf("cannot build URL for route %v: route parameter %v contains a dot segment", name, paramName)
+			}
+
+		}
+
+		constraint, _ := compileConstraint(constraintSource)
+
+		if constraint != nil && !constraint.matches(value) {
+			return "", fmt.Errorf("cannot build URL for route %v: route parameter %v does not satisfy constraint %v", name, paramName, constraintSource)
+		}
+
+		escapedValue := url.PathEscape(value)
+
+		// A final wildcard's value keeps its slashes, which can only come from the
+		// value itself as any percent signs in it have been escaped
+		if paramName == "{catchAll}" {
+			escapedValue = strings.ReplaceAll(escapedValue, "%2F", "/")
+		}
+
+		routePathFragments[i] = escapedValue
+
+	}
+
+	builtURL := "/" + strings.Join(routePathFragments, "/")
+
+	if len(query) > 0 {
+		builtURL += "?" + query.Encode()
+	}
+
+	return builtURL, nil
+
+}
+
+// URL builds the path of a named route from the values of its parameters,
+// followed by a query string if there are any query parameters
+func (server *Server) URL(name string, routeParams RouteParams, query url.Values) (string, error) {
+
+	return server.Router.URL(name, routeParams, query)
+
+}
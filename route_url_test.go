@@ -0,0 +1,144 @@
+package jsonserver
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+// testURLRouter creates a router with named routes
+func testURLRouter() *Router {
+
+	router := &Router{}
+
+	router.RegisterRoute("GET|DELETE", "/products/{id:int}", []Middleware{}, testOpenAPIAction, WithName("product.show"))
+	router.RegisterRoute("GET", "/products/{id:int}/reviews/{slug}", []Middleware{}, testOpenAPIAction, WithName("product.review"))
+	router.RegisterRoute("GET", "/files/:", []Middleware{}, testOpenAPIAction, WithName("files"))
+	router.RegisterRoute("GET", "/", []Middleware{}, testOpenAPIAction, WithName("home"))
+
+	return router
+
+}
+
+// TestRouteURL tests building the URLs of named routes
+func TestRouteURL(t *testing.T) {
+
+	router := testURLRouter()
+
+	urls := map[string]struct {
+		name        string
+		routeParams RouteParams
+		query       url.Values
+	}{
+		"/products/42":                         {"product.show", RouteParams{"id": "42"}, nil},
+		"/products/42?fields=name&page=2":      {"product.show", RouteParams{"id": "42", "unused": "x"}, url.Values{"page": {"2"}, "fields": {"name"}}},
+		"/products/7/reviews/good%20bad%3F%23": {"product.review", RouteParams{"id": "7", "slug": "good bad?#"}, url.Values{}},
+		"/files/reports/2024/q1%25.pdf":        {"files", RouteParams{"{catchAll}": "reports/2024/q1%.pdf"}, nil},
+		"/":                                    {"home", RouteParams{}, nil},
+	}
+
+	for expected, arguments := range urls {
+
+		if builtURL, err := router.URL(arguments.name, arguments.routeParams, arguments.query); err != nil || builtURL != expected {
+			t.Errorf("Incorrect URL for %v (expected: %v, actual: %v, error: %v)", arguments.name, expected, builtURL, err)
+		}
+
+	}
+
+}
+
+// TestRouteURLErrors tests that URLs cannot be built for unknown routes or
+// with invalid parameters
+func TestRouteURLErrors(t *testing.T) {
+
+	router := testURLRouter()
+
+	cases := map[string]struct {
+		name        string
+		routeParams RouteParams
+	}{
+		"unknown route name: product.edit":                                                            {"product.edit", RouteParams{"id": "42"}},
+		"cannot build URL for route product.show: route parameter id is not set":                      {"product.show", RouteParams{}},
+		"cannot build URL for route product.show: route parameter id is empty":                        {"product.show", RouteParams{"id": ""}},
+		"cannot build URL for route product.show: route parameter id does not satisfy constraint int": {"product.show", RouteParams{"id": "abc"}},
+		"cannot build URL for route files: route parameter {catchAll} is not set":                     {"files", RouteParams{"id": "42"}},
+		"cannot build URL for route product.review: route parameter slug contains a slash":            {"product.review", RouteParams{"id": "7", "slug": "good/bad"}},
+		"cannot build URL for route product.review: route parameter slug contains a dot segment":      {"product.review", RouteParams{"id": "7", "slug": ".."}},
+		"cannot build URL for route files: route parameter {catchAll} contains a dot segment":         {"files", RouteParams{"{catchAll}": "reports/../secrets"}},
+	}
+
+	for expected, arguments := range cases {
+
+		if _, err := router.URL(arguments.name, arguments.routeParams, nil); err == nil || err.Error() != expected {
+			t.Errorf("Incorrect error (expected: %v, actual: %v)", expected, err)
+		}
+
+	}
+
+	if _, err := router.URL("product.edit", RouteParams{}, nil); !errors.Is(err, ErrUnknownRouteName) {
+		t.Errorf("Unknown route error was not returned (error: %v)", err)
+	}
+
+}
+
+// TestRouteURLDispatchesToRoute tests that built URLs are dispatched back to
+// the named route with the same parameters
+func TestRouteURLDispatchesToRoute(t *testing.T) {
+
+	var dispatched RouteParams
+
+	server := NewServer()
+	action := func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) {
+		dispatched = Params(ctx)
+	}
+
+	server.RegisterRoute("GET", "/products/{id:int}/reviews/{slug}", []Middleware{}, action, WithName("product.review"))
+	server.RegisterRoute("GET", "/files/:", []Middleware{}, action, WithName("files"))
+
+	cases := map[string]RouteParams{
+		"product.review": {"id": "7", "slug": "good bad?#%20 ünïcode;a=b"},
+		"files":          {"{catchAll}": "reports/2024/q1 %.pdf"},
+	}
+
+	for name, routeParams := range cases {
+
+		builtURL, err := server.URL(name, routeParams, nil)
+
+		if err != nil {
+			t.Errorf("Unexpected error building URL for %v: %v", name, err)
+			continue
+		}
+
+		dispatched = nil
+
+		server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", builtURL, nil))
+
+		if !reflect.DeepEqual(dispatched, routeParams) {
+			t.Errorf("URL %v was not dispatched to %v (expected: %v, actual: %v)", builtURL, name, routeParams, dispatched)
+		}
+
+	}
+
+}
+
+// TestRegisterRouteWithDuplicateName tests that a name cannot be shared by
+// routes with different paths
+func TestRegisterRouteWithDuplicateName(t *testing.T) {
+
+	router := testURLRouter()
+
+	if err := router.RegisterRoute("PUT", "/products/{id:int}", []Middleware{}, testOpenAPIAction, WithName("product.show")); err != nil {
+		t.Errorf("Name could not be shared by a route with the same path (error: %v)", err)
+	}
+
+	err := router.RegisterRoute("GET", "/items/{id:int}", []Middleware{}, testOpenAPIAction, WithName("product.show"))
+
+	if !errors.Is(err, ErrDuplicateRouteName) || len(router.Routes["GET"]) != 4 {
+		t.Errorf("Duplicate name was not rejected (error: %v)", err)
+	}
+
+}
@@ -3,34 +3,152 @@ package jsonserver
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/url"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 )
 
-// Router represents an instance of a router
+// Router represents an instance of a router. Its routes are held in an
+// immutable table that is replaced as a whole whenever they change, so that
+// requests are matched without locking and each request keeps using the table
+// that it started with
 type Router struct {
-	Routes     map[string][]Route
+
+	// Routes lists the registered routes by method. It is kept up to date for
+	// compatibility, but changing it has no effect on which routes are matched
+	//
+	// Deprecated: use RouteTable to list the registered routes
+	Routes map[string][]Route
+
+	// RoutesLock is held while the routes are changed, and guards Routes
 	RoutesLock sync.RWMutex
+
+	table atomic.Pointer[routeTable]
+}
+
+// routeTable is an immutable set of routes, along with a tree of each
+// method's routes and the paths of named routes. Changes are made to a copy of
+// the table, which shares everything that the change does not touch
+type routeTable struct {
+	routes map[string][]*Route
+	trees  map[string]*routeNode
+	names  map[string]string
 }
 
-// RegisterRoute stores a closure to execute against a method and path
-func (router *Router) RegisterRoute(method string, path string, middleware []Middleware, action RouteAction) {
+// ErrRouteNotFound is returned when unregistering a route that has not been
+// registered
+var ErrRouteNotFound = errors.New("route not found")
+
+// RegisterRoute stores a closure to execute against a method and path,
+// returning an error (and registering nothing) if the path has the same shape
+// as a route already registered against one of the methods, or the route's
+// name is already used by a route with a different path
+func (router *Router) RegisterRoute(method string, path string, middleware []Middleware, action RouteAction, options ...RouteOption) error {
 
 	methods := strings.Split(strings.ToUpper(method), "|")
 
+	if err := validateConstraints(path); err != nil {
+		return err
+	}
+
+	routes := make([]*Route, len(methods))
+
+	for i := range methods {
+
+		routes[i] = &Route{Path: path, Action: action, Middleware: middleware}
+
+		for _, option := range options {
+			option(routes[i])
+		}
+
+	}
+
+	router.RoutesLock.Lock()
+	defer router.RoutesLock.Unlock()
+
+	table, err := router.load().register(methods, routes)
+
+	if err != nil {
+		return err
+	}
+
+	router.table.Store(table)
+
+	if router.Routes == nil {
+		router.Routes = map[string][]Route{}
+	}
+
+	for i, method := range methods {
+		router.Routes[method] = append(router.Routes[method], *routes[i])
+	}
+
+	return nil
+
+}
+
+// UnregisterRoute removes the route registered against a method (or several,
+// separated by pipes) and path, returning an error wrapping ErrRouteNotFound
+// (and removing nothing) if there is no such route for one of the methods.
+// Requests already being handled by the route are unaffected
+func (router *Router) UnregisterRoute(method string, path string) error {
+
+	methods := strings.Split(strings.ToUpper(method), "|")
+
+	router.RoutesLock.Lock()
+	defer router.RoutesLock.Unlock()
+
+	table, err := router.load().unregister(methods, path)
+
+	if err != nil {
+		return err
+	}
+
+	router.table.Store(table)
+
 	for _, method := range methods {
 
-		router.RoutesLock.Lock()
+		remainingRoutes := []Route{}
+
+		for _, route := range router.Routes[method] {
+
+			if normalisePath(route.Path) != normalisePath(path) {
+				remainingRoutes = append(remainingRoutes, route)
+			}
 
-		if router.Routes == nil {
-			router.Routes = map[string][]Route{}
 		}
 
-		router.Routes[method] = append(router.Routes[method], Route{Path: path, Action: action, Middleware: middleware})
+		router.Routes[method] = remainingRoutes
+
+	}
+
+	return nil
+
+}
+
+// ReplaceRoutes replaces every route with the routes registered with another
+// router in a single step, so that a new set of routes can be built up before
+// any of them are matched. Each request is matched against either the old
+// routes or the new ones, never a mixture, and later changes to either router
+// do not affect the other
+func (router *Router) ReplaceRoutes(source *Router) {
+
+	table := source.load()
+
+	router.RoutesLock.Lock()
+	defer router.RoutesLock.Unlock()
 
-		router.RoutesLock.Unlock()
+	router.table.Store(table)
+	router.Routes = map[string][]Route{}
+
+	for method, routes := range table.routes {
+
+		for _, route := range routes {
+			router.Routes[method] = append(router.Routes[method], *route)
+		}
 
 	}
 
@@ -39,49 +157,238 @@ func (router *Router) RegisterRoute(method string, path string, middleware []Mid
 // Dispatch will search for and execute a route
 func (router *Router) Dispatch(request *http.Request, response http.ResponseWriter, method string, path string, params string, body *[]byte) (bool, int, error) {
 
-	router.RoutesLock.RLock()
+	route, routeParams := router.load().match(method, path)
+
+	if route == nil {
+		return false, 0, nil
+	}
+
+	ctx := newRequestContext(request.Context(), routeParams, params)
+
+	defer State(ctx).complete()
+
+	middlewareResponseCode, err := router.execute(ctx, route, request, response, body)
+
+	if err != nil {
+		return false, middlewareResponseCode, err
+	}
+
+	return true, 0, nil
+
+}
+
+// AllowedMethods lists the methods that have a route registered that matches a
+// path, in alphabetical order
+func (router *Router) AllowedMethods(path string) []string {
+
+	return router.load().allowedMethods(path)
+
+}
+
+// allowedMethods lists the methods that have a route in the table that matches
+// a path, in alphabetical order
+func (table *routeTable) allowedMethods(path string) []string {
+
+	allowedMethods := []string{}
+
+	for method, tree := range table.trees {
+
+		if route, _ := tree.lookup(path); route != nil {
+			allowedMethods = append(allowedMethods, method)
+		}
+
+	}
+
+	sort.Strings(allowedMethods)
+
+	return allowedMethods
+
+}
+
+// execute runs a matched route's middleware and, if none of it denies access,
+// its action (wrapped by any of the route's wrappers)
+func (router *Router) execute(ctx context.Context, route *Route, request *http.Request, response http.ResponseWriter, body *[]byte) (int, error) {
+
+	// Execute all middleware and halt execution if one of them returns FALSE
+	if middlewareResponseCode, err := runMiddleware(ctx, route.Middleware, request, response, body); err != nil {
+		return middlewareResponseCode, err
+	}
+
+	wrapAction(route.Action, route.Wrappers)(ctx, request, response, body)
 
-	if methodRoutes, ok := router.Routes[strings.ToUpper(method)]; ok {
+	return 0, nil
 
-		router.RoutesLock.RUnlock()
+}
 
-		for _, route := range methodRoutes {
+// newRequestContext creates the context passed to middleware and actions from
+// the request's context, layering the request state along with route and
+// query parameters on top
+func newRequestContext(parent context.Context, routeParams RouteParams, params string) context.Context {
 
-			routeMatches, routeParams := route.MatchesPath(path)
+	queryParams, _ := url.ParseQuery(params)
 
-			if routeMatches {
+	return withRequestValues(parent, &RequestState{}, routeParams, &queryParams)
 
-				queryParams, _ := url.ParseQuery(params)
+}
 
-				ctx := context.Background()
-				ctx = context.WithValue(ctx, "state", &RequestState{})
-				ctx = context.WithValue(ctx, "routeParams", routeParams)
-				ctx = context.WithValue(ctx, "queryParams", &queryParams)
+// wrapAction wraps an action in wrappers, with the first wrapper outermost
+func wrapAction(action RouteAction, wrappers []Wrapper) RouteAction {
 
-				for _, middleware := range route.Middleware {
+	for i := len(wrappers) - 1; i >= 0; i-- {
+		action = wrappers[i](action)
+	}
 
-					// Execute all middleware and halt execution if one of them
-					// returns FALSE
-					middlewareDecision, middlewareResponseCode := middleware(ctx, request, response, body)
+	return action
 
-					if middlewareDecision == false {
-						return false, middlewareResponseCode, errors.New("Access denied to route")
-					}
+}
 
-				}
+// load returns the router's current route table, which is empty if no routes
+// have been registered
+func (router *Router) load() *routeTable {
 
-				route.Action(ctx, request, response, body)
+	if table := router.table.Load(); table != nil {
+		return table
+	}
+
+	return &routeTable{}
+
+}
+
+// match finds the route in the table that should handle a method and path,
+// along with its wildcard values
+func (table *routeTable) match(method string, path string) (*Route, RouteParams) {
+
+	if tree, ok := table.trees[strings.ToUpper(method)]; ok {
+		return tree.lookup(path)
+	}
+
+	return nil, RouteParams{}
+
+}
+
+// register returns a copy of the table with routes added against methods, or
+// an error if one of them conflicts with a route already in the table
+func (table *routeTable) register(methods []string, routes []*Route) (*routeTable, error) {
+
+	next := table.copy()
+
+	for i, method := range methods {
+
+		route := routes[i]
+		tree := next.trees[method]
+
+		if tree == nil {
+			tree = &routeNode{}
+		}
+
+		if existingRoute := tree.conflicts(route.Path); existingRoute != nil {
+			return nil, fmt.Errorf("%w: %v %v conflicts with %v", ErrDuplicateRoute, method, route.Path, existingRoute.Path)
+		}
+
+		// A name can be shared by routes for different methods, but only if they
+		// have the same path
+		if existingPath, ok := next.names[route.Name]; ok && existingPath != route.Path {
+			return nil, fmt.Errorf("%w: %v is already used by %v", ErrDuplicateRouteName, route.Name, existingPath)
+		}
+
+		tree, err := tree.insert(route)
+
+		if err != nil {
+			return nil, err
+		}
+
+		// The slice is copied rather than appended to in place, as it may be
+		// shared with the original table
+		next.trees[method] = tree
+		next.routes[method] = append(append(make([]*Route, 0, len(next.routes[method])+1), next.routes[method]...), route)
+
+		if route.Name != "" {
+			next.names[route.Name] = route.Path
+		}
+
+	}
 
-				return true, 0, nil
+	return next, nil
 
+}
+
+// unregister returns a copy of the table without the routes registered against
+// methods and a path, or an error if one of them is not in the table
+func (table *routeTable) unregister(methods []string, path string) (*routeTable, error) {
+
+	next := table.copy()
+
+	for _, method := range methods {
+
+		var existingRoute *Route
+
+		if tree := next.trees[method]; tree != nil {
+			existingRoute = tree.conflicts(path)
+		}
+
+		// Paths are compared in the same way as when they were registered, so
+		// leading and trailing slashes do not matter
+		if existingRoute == nil || normalisePath(existingRoute.Path) != normalisePath(path) {
+			return nil, fmt.Errorf("%w: %v %v", ErrRouteNotFound, method, path)
+		}
+
+		remainingRoutes := []*Route{}
+
+		for _, route := range next.routes[method] {
+
+			if route != existingRoute {
+				remainingRoutes = append(remainingRoutes, route)
+			}
+
+		}
+
+		next.trees[method] = next.trees[method].remove(path)
+		next.routes[method] = remainingRoutes
+
+		if len(remainingRoutes) == 0 {
+			delete(next.trees, method)
+			delete(next.routes, method)
+		}
+
+	}
+
+	// Names are only kept while a route still uses them
+	next.names = map[string]string{}
+
+	for _, routes := range next.routes {
+
+		for _, route := range routes {
+
+			if route.Name != "" {
+				next.names[route.Name] = route.Path
 			}
 
 		}
 
-	} else {
-		router.RoutesLock.RUnlock()
 	}
 
-	return false, 0, nil
+	return next, nil
+
+}
+
+// copy makes a copy of the table whose maps can be changed without affecting
+// the original, while sharing the routes and trees within them
+func (table *routeTable) copy() *routeTable {
+
+	next := &routeTable{routes: map[string][]*Route{}, trees: map[string]*routeNode{}, names: map[string]string{}}
+
+	for method, routes := range table.routes {
+		next.routes[method] = routes
+	}
+
+	for method, tree := range table.trees {
+		next.trees[method] = tree
+	}
+
+	for name, path := range table.names {
+		next.names[name] = path
+	}
+
+	return next
 
 }
@@ -3,9 +3,15 @@ package jsonserver
 import (
 	"context"
 	"crypto/tls"
+	"errors"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -13,6 +19,8 @@ import (
 var ServerStarted bool
 var TestServerHTTPS *Server = NewServer()
 var TestServerHTTP *Server = NewServer()
+var TestServerHTTPSURL string
+var TestServerHTTPURL string
 
 // Set up some routes
 func testRouteSetUp() {
@@ -80,12 +88,21 @@ func testRouteSetUp() {
 
 	if !ServerStarted {
 
-		TestServerHTTPS.Start(9999, 5)
-		TestServerHTTP.Start(9998, 5)
+		// Bind to any free ports so that the tests do not depend on particular
+		// ports being available
+		httpsListener, _ := net.Listen("tcp", "127.0.0.1:0")
+		httpListener, _ := net.Listen("tcp", "127.0.0.1:0")
 
-		ServerStarted = true
+		TestServerHTTPSURL = "https://" + httpsListener.Addr().String()
+		TestServerHTTPURL = "http://" + httpListener.Addr().String()
+
+		TestServerHTTPS.Timeout = 5 * time.Second
+		TestServerHTTP.Timeout = 5 * time.Second
 
-		time.Sleep(2 * time.Second)
+		go TestServerHTTPS.ServeTLS(httpsListener)
+		go TestServerHTTP.Serve(httpListener)
+
+		ServerStarted = true
 
 	}
 
@@ -158,6 +175,234 @@ func TestRegisterRouteToMultipleMethods(t *testing.T) {
 
 }
 
+// TestRegisterDuplicateRoute tests that registering a route with the same
+// shape as an existing route fails without registering anything
+func TestRegisterDuplicateRoute(t *testing.T) {
+
+	router := &Router{}
+	action := func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) {}
+
+	if err := router.RegisterRoute("GET", "/foo/{bar}", []Middleware{}, action); err != nil {
+		t.Errorf("Unexpected error when registering route: %v", err)
+	}
+
+	if err := router.RegisterRoute("PUT|GET", "/foo/{baz}", []Middleware{}, action); !errors.Is(err, ErrDuplicateRoute) {
+		t.Errorf("Duplicate route did not return an error")
+	}
+
+	if len(router.Routes["PUT"]) != 0 || len(router.Routes["GET"]) != 1 {
+		t.Errorf("Duplicate route was partially registered")
+	}
+
+	if err := router.RegisterRoute("PUT", "/foo/{baz}", []Middleware{}, action); err != nil {
+		t.Errorf("Unexpected error when registering route against another method: %v", err)
+	}
+
+}
+
+// TestRegisterRouteWithInvalidConstraint tests that a route with a constraint
+// that cannot be compiled is not registered
+func TestRegisterRouteWithInvalidConstraint(t *testing.T) {
+
+	router := &Router{}
+	action := func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) {}
+
+	if router.RegisterRoute("GET", "/foo/{bar:[a-z}", []Middleware{}, action) == nil {
+		t.Errorf("Route with invalid constraint did not return an error")
+	}
+
+	if len(router.Routes["GET"]) != 0 {
+		t.Errorf("Route with invalid constraint was registered")
+	}
+
+}
+
+// TestUnregisterRoute tests that unregistering a route stops it from being
+// matched and frees its name, without affecting other routes
+func TestUnregisterRoute(t *testing.T) {
+
+	router := &Router{}
+	action := func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) {}
+
+	router.RegisterRoute("GET|PUT", "/foo/{bar}", []Middleware{}, action, WithName("foo"))
+	router.RegisterRoute("GET", "/foo/new", []Middleware{}, action)
+
+	if err := router.UnregisterRoute("GET", "/foo/new"); err != nil {
+		t.Errorf("Unexpected error when unregistering route: %v", err)
+	}
+
+	if route, _ := router.load().match("GET", "/foo/new"); route == nil || route.Path != "/foo/{bar}" {
+		t.Errorf("Incorrect route matched after unregistering a route (expected: %v, actual: %v)", "/foo/{bar}", route)
+	}
+
+	if err := router.UnregisterRoute("GET", "/foo/{baz}"); !errors.Is(err, ErrRouteNotFound) {
+		t.Errorf("Route with a different path was unregistered (error: %v)", err)
+	}
+
+	if err := router.UnregisterRoute("GET|DELETE", "/foo/{bar}"); !errors.Is(err, ErrRouteNotFound) {
+		t.Errorf("Route that is not registered against every method was unregistered (error: %v)", err)
+	}
+
+	if route, _ := router.load().match("GET", "/foo/1"); route == nil {
+		t.Errorf("Route was partially unregistered")
+	}
+
+	if err := router.UnregisterRoute("get|put", "foo/{bar}/"); err != nil {
+		t.Errorf("Unexpected error when unregistering route: %v", err)
+	}
+
+	if route, _ := router.load().match("PUT", "/foo/1"); route != nil {
+		t.Errorf("Unregistered route was matched")
+	}
+
+	if len(router.Routes["GET"]) != 0 || len(router.Routes["PUT"]) != 0 {
+		t.Errorf("Unregistered routes are still listed (GET: %v, PUT: %v)", len(router.Routes["GET"]), len(router.Routes["PUT"]))
+	}
+
+	if _, err := router.URL("foo", RouteParams{"bar": "1"}, nil); !errors.Is(err, ErrUnknownRouteName) {
+		t.Errorf("Name of unregistered route was kept (error: %v)", err)
+	}
+
+	if err := router.RegisterRoute("GET", "/bar/{baz}", []Middleware{}, action, WithName("foo")); err != nil {
+		t.Errorf("Unexpected error when reusing the name of an unregistered route: %v", err)
+	}
+
+}
+
+// TestReplaceRoutes tests that replacing a router's routes swaps them all at
+// once, while tables that have already been loaded keep the old routes
+func TestReplaceRoutes(t *testing.T) {
+
+	router := &Router{}
+	replacement := &Router{}
+	action := func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) {}
+
+	router.RegisterRoute("GET", "/old", []Middleware{}, action)
+	replacement.RegisterRoute("GET|POST", "/new", []Middleware{}, action)
+
+	inFlight := router.load()
+
+	router.ReplaceRoutes(replacement)
+
+	if route, _ := router.load().match("GET", "/old"); route != nil {
+		t.Errorf("Replaced route was matched")
+	}
+
+	if route, _ := router.load().match("POST", "/new"); route == nil {
+		t.Errorf("Replacement route was not matched")
+	}
+
+	if route, _ := inFlight.match("GET", "/old"); route == nil {
+		t.Errorf("Route table already loaded did not keep the replaced route")
+	}
+
+	if len(router.Routes["GET"]) != 1 || router.Routes["GET"][0].Path != "/new" {
+		t.Errorf("Replacement routes are not listed (actual: %v)", router.Routes["GET"])
+	}
+
+	replacement.RegisterRoute("GET", "/newer", []Middleware{}, action)
+	router.UnregisterRoute("POST", "/new")
+
+	if route, _ := router.load().match("GET", "/newer"); route != nil {
+		t.Errorf("Route registered with the replacement router was matched")
+	}
+
+	if route, _ := replacement.load().match("POST", "/new"); route == nil {
+		t.Errorf("Route unregistered from the replaced router was removed from the replacement router")
+	}
+
+}
+
+// TestChangeRoutesWhileDispatching tests that routes can be registered and
+// unregistered while requests are being dispatched
+func TestChangeRoutesWhileDispatching(t *testing.T) {
+
+	router := &Router{}
+	action := func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) {}
+	group := sync.WaitGroup{}
+
+	router.RegisterRoute("GET", "/static", []Middleware{}, action)
+
+	for i := 0; i < 4; i++ {
+
+		group.Add(1)
+
+		go func() {
+
+			defer group.Done()
+
+			for j := 0; j < 200; j++ {
+
+				request := httptest.NewRequest("GET", "/static", nil)
+
+				if success, _, _ := router.Dispatch(request, httptest.NewRecorder(), "GET", "/static", "", &[]byte{}); !success {
+					t.Errorf("Route was not dispatched while routes were changing")
+					return
+				}
+
+			}
+
+		}()
+
+	}
+
+	for i := 0; i < 200; i++ {
+
+		path := "/dynamic/" + strconv.Itoa(i) + "/{id}"
+
+		router.RegisterRoute("GET", path, []Middleware{}, action)
+		router.UnregisterRoute("GET", path)
+
+	}
+
+	group.Wait()
+
+}
+
+// TestDispatchPrefersStaticRoute tests that a static route is dispatched in
+// preference to an earlier registered wildcard route
+func TestDispatchPrefersStaticRoute(t *testing.T) {
+
+	router := &Router{}
+
+	router.RegisterRoute("GET", "/foo/{bar}", []Middleware{}, func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) {
+		response.Write([]byte("GET /foo/{bar}"))
+	})
+
+	router.RegisterRoute("GET", "/foo/new", []Middleware{}, func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) {
+		response.Write([]byte("GET /foo/new"))
+	})
+
+	request := httptest.NewRequest("GET", "https://localhost:9999/foo/new", nil)
+	response := httptest.NewRecorder()
+
+	router.Dispatch(request, response, "GET", "/foo/new", "", &[]byte{})
+
+	if response.Body.String() != "GET /foo/new" {
+		t.Errorf("Static route did not take precedence over wildcard route")
+	}
+
+}
+
+// TestAllowedMethods tests listing the methods with routes matching a path
+func TestAllowedMethods(t *testing.T) {
+
+	router := &Router{}
+	action := func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) {}
+
+	router.RegisterRoute("PUT|GET", "/foo/{bar}", []Middleware{}, action)
+	router.RegisterRoute("DELETE", "/foo/:", []Middleware{}, action)
+
+	if allowedMethods := strings.Join(router.AllowedMethods("/foo/bar"), ","); allowedMethods != "DELETE,GET,PUT" {
+		t.Errorf("Allowed methods mismatch (expected: %v, actual: %v)", "DELETE,GET,PUT", allowedMethods)
+	}
+
+	if allowedMethods := router.AllowedMethods("/bar"); len(allowedMethods) != 0 {
+		t.Errorf("Allowed methods mismatch (expected: %v, actual: %v)", "[]", allowedMethods)
+	}
+
+}
+
 // TestDispatchUnmatchedRoute tests dispatching a route that doesn't match
 func TestDispatchUnmatchedRoute(t *testing.T) {
 
@@ -459,11 +704,210 @@ func TestMiddlewareDeniesRoute(t *testing.T) {
 
 }
 
+// benchmarkRouter creates a router with a number of routes, returning it and
+// the path of the last (and therefore slowest to scan for) route
+func benchmarkRouter(routeCount int) (*Router, string) {
+
+	router := &Router{}
+	action := func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) {}
+
+	for i := 0; i < routeCount; i++ {
+		router.RegisterRoute("GET", "/api/resource"+strconv.Itoa(i)+"/{id}/items/{item}", []Middleware{}, action)
+	}
+
+	return router, "/api/resource" + strconv.Itoa(routeCount-1) + "/123/items/456"
+
+}
+
+// benchmarkTreeMatch benchmarks matching a path against the route tree
+func benchmarkTreeMatch(b *testing.B, routeCount int) {
+
+	router, path := benchmarkRouter(routeCount)
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+
+		if route, _ := router.load().match("GET", path); route == nil {
+			b.Fatal("Route not matched")
+		}
+
+	}
+
+}
+
+// benchmarkLinearMatch benchmarks matching a path by scanning every route in
+// turn, as the router used to
+func benchmarkLinearMatch(b *testing.B, routeCount int) {
+
+	router, path := benchmarkRouter(routeCount)
+	routes := router.Routes["GET"]
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+
+		matched := false
+
+		for _, route := range routes {
+
+			if matches, _ := route.MatchesPath(path); matches {
+				matched = true
+				break
+			}
+
+		}
+
+		if !matched {
+			b.Fatal("Route not matched")
+		}
+
+	}
+
+}
+
+// BenchmarkTreeMatch10 benchmarks tree matching with 10 routes
+func BenchmarkTreeMatch10(b *testing.B) {
+
+	benchmarkTreeMatch(b, 10)
+
+}
+
+// BenchmarkTreeMatch500 benchmarks tree matching with 500 routes
+func BenchmarkTreeMatch500(b *testing.B) {
+
+	benchmarkTreeMatch(b, 500)
+
+}
+
+// BenchmarkLinearMatch10 benchmarks linear matching with 10 routes
+func BenchmarkLinearMatch10(b *testing.B) {
+
+	benchmarkLinearMatch(b, 10)
+
+}
+
+// BenchmarkLinearMatch500 benchmarks linear matching with 500 routes
+func BenchmarkLinearMatch500(b *testing.B) {
+
+	benchmarkLinearMatch(b, 500)
+
+}
+
+// BenchmarkDispatch500 benchmarks dispatching a request with 500 routes
+func BenchmarkDispatch500(b *testing.B) {
+
+	router, path := benchmarkRouter(500)
+	request := httptest.NewRequest("GET", path, nil)
+	response := httptest.NewRecorder()
+	body := []byte{}
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		router.Dispatch(request, response, "GET", path, "", &body)
+	}
+
+}
+
+// TestRouteWrappersRunAfterMiddleware tests that a route's wrappers run around
+// its action once its middleware has allowed the request
+func TestRouteWrappersRunAfterMiddleware(t *testing.T) {
+
+	router := &Router{}
+	order := []string{}
+
+	middleware := func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) (bool, int) {
+		order = append(order, "middleware")
+		return true, 0
+	}
+
+	wrapper := func(next RouteAction) RouteAction {
+
+		return func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) {
+			order = append(order, "before")
+			next(ctx, request, response, body)
+			order = append(order, "after")
+		}
+
+	}
+
+	router.RegisterRoute("GET", "/", []Middleware{middleware}, func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) {
+		order = append(order, "action")
+	}, WithWrappers(wrapper))
+
+	router.Dispatch(httptest.NewRequest("GET", "/", nil), httptest.NewRecorder(), "GET", "/", "", &[]byte{})
+
+	if strings.Join(order, ", ") != "middleware, before, action, after" {
+		t.Errorf("Execution order mismatch (actual: %v)", order)
+	}
+
+}
+
+// TestDispatchUsesRequestContext tests that the context passed to middleware
+// and actions is derived from the request's context
+func TestDispatchUsesRequestContext(t *testing.T) {
+
+	type testKey string
+
+	router := &Router{}
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), testKey("foo"), "bar"))
+	request := httptest.NewRequest("GET", "/products/123", nil).WithContext(ctx)
+	result := ""
+
+	router.RegisterRoute("GET", "/products/{id}", []Middleware{}, func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) {
+
+		cancel()
+
+		<-ctx.Done()
+
+		result = ctx.Value(testKey("foo")).(string) + " " + ctx.Value("routeParams").(RouteParams)["id"] + " " + ctx.Err().Error()
+
+	})
+
+	router.Dispatch(request, httptest.NewRecorder(), "GET", "/products/123", "", &[]byte{})
+
+	if result != "bar 123 context canceled" {
+		t.Errorf("Request context was not passed to the action (actual: %v)", result)
+	}
+
+}
+
 // Reset the routes
 func testRouteTearDown() {
 
-	TestServerHTTPS.Router.RoutesLock.Lock()
-	TestServerHTTPS.Router.Routes = map[string][]Route{}
-	TestServerHTTPS.Router.RoutesLock.Unlock()
+	TestServerHTTPS.Router.ReplaceRoutes(&Router{})
+
+}
+
+// testIndexServer creates a server with a single route at the root
+func testIndexServer() *Server {
+
+	server := NewServer()
+
+	server.RegisterRoute("GET", "/", []Middleware{}, func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) {
+		response.Write([]byte("GET /"))
+	})
+
+	return server
+
+}
+
+// testRequest makes a request with an optional body and headers to a server,
+// skipping any headers without a value
+func testRequest(server *Server, method string, path string, body io.Reader, headers map[string]string) *httptest.ResponseRecorder {
+
+	request := httptest.NewRequest(method, path, body)
+	response := httptest.NewRecorder()
+
+	for key, value := range headers {
+		if value != "" {
+			request.Header.Set(key, value)
+		}
+	}
+
+	server.ServeHTTP(response, request)
+
+	return response
 
 }
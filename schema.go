@@ -0,0 +1,276 @@
+package jsonserver
+
+import (
+	"encoding"
+	"encoding/json"
+	"path"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// schemaGenerator builds JSON Schemas for Go types according to how they are
+// encoded as JSON, collecting named struct types as components so that they
+// can be referenced (including by themselves)
+type schemaGenerator struct {
+	components JSON
+	names      map[reflect.Type]string
+}
+
+// componentNameInvalid matches characters that cannot be used in the names of
+// components, such as the brackets in the names of generic types
+var componentNameInvalid = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// Types that are encoded differently to their kind
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	numberType        = reflect.TypeOf(json.Number(""))
+	rawMessageType    = reflect.TypeOf(json.RawMessage{})
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// newSchemaGenerator creates a schema generator without any components
+func newSchemaGenerator() *schemaGenerator {
+
+	return &schemaGenerator{components: JSON{}, names: map[reflect.Type]string{}}
+
+}
+
+// schema builds the schema of a type, referring to named struct types by
+// reference
+func (generator *schemaGenerator) schema(valueType reflect.Type) JSON {
+
+	for valueType.Kind() == reflect.Ptr {
+		valueType = valueType.Elem()
+	}
+
+	switch valueType {
+	case timeType:
+		return JSON{"type": "string", "format": "date-time"}
+	case numberType:
+		return JSON{"type": "number"}
+	case rawMessageType:
+		return JSON{}
+	}
+
+	// Types with their own encoding could be encoded as anything
+	if valueType.Implements(jsonMarshalerType) || reflect.PtrTo(valueType).Implements(jsonMarshalerType) {
+		return JSON{}
+	}
+
+	if valueType.Implements(textMarshalerType) || reflect.PtrTo(valueType).Implements(textMarshalerType) {
+		return JSON{"type": "string"}
+	}
+
+	switch valueType.Kind() {
+
+	case reflect.Bool:
+
+		return JSON{"type": "boolean"}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+
+		return JSON{"type": "integer"}
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+
+		return JSON{"type": "integer", "minimum": 0}
+
+	case reflect.Float32, reflect.Float64:
+
+		return JSON{"type": "number"}
+
+	case reflect.String:
+
+		return JSON{"type": "string"}
+
+	case reflect.Slice, reflect.Array:
+
+		if valueType.Kind() == reflect.Slice && valueType.Elem().Kind() == reflect.Uint8 {
+			return JSON{"type": "string", "contentEncoding": "base64"}
+		}
+
+		return JSON{"type": "array", "items": generator.schema(valueType.Elem())}
+
+	case reflect.Map:
+
+		return JSON{"type": "object", "additionalProperties": generator.schema(valueType.Elem())}
+
+	case reflect.Struct:
+
+		if valueType.Name() == "" {
+			return generator.objectSchema(valueType)
+		}
+
+		return JSON{"$ref": "#/components/schemas/" + generator.component(valueType)}
+
+	}
+
+	return JSON{}
+
+}
+
+// component adds a named struct type to the components if it has not been
+// added already, returning its name
+func (generator *schemaGenerator) component(valueType reflect.Type) string {
+
+	if name, ok := generator.names[valueType]; ok {
+		return name
+	}
+
+	name := componentNameInvalid.ReplaceAllString(valueType.Name(), "_")
+
+	// Types with the same name in different packages are told apart by package
+	if _, taken := generator.components[name]; taken {
+		name = componentNameInvalid.ReplaceAllString(path.Base(valueType.PkgPath()), "_") + "." + name
+	}
+
+	for i := 2; generator.components[name] != nil; i++ {
+		name = strings.TrimRight(name, "0123456789") + strconv.Itoa(i)
+	}
+
+	// The name is reserved before the schema is built in case the type refers
+	// to itself
+	generator.names[valueType] = name
+	generator.components[name] = JSON{}
+	generator.components[name] = generator.objectSchema(valueType)
+
+	return name
+
+}
+
+// objectSchema builds the schema of a struct type, with properties named as
+// they are encoded as JSON and constraints taken from validate tags
+func (generator *schemaGenerator) objectSchema(structType reflect.Type) JSON {
+
+	properties := JSON{}
+	required := []string{}
+
+	generator.addProperties(structType, properties, &required)
+
+	schema := JSON{"type": "object", "properties": properties}
+
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+
+	return schema
+
+}
+
+// addProperties adds the properties of a struct type's fields to a schema,
+// including those of embedded structs
+func (generator *schemaGenerator) addProperties(structType reflect.Type, properties JSON, required *[]string) {
+
+	for i := 0; i < structType.NumField(); i++ {
+
+		field := structType.Field(i)
+
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+
+		if name == "-" {
+			continue
+		}
+
+		fieldType := field.Type
+
+		for fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+
+		// The fields of embedded structs without a JSON name belong to the parent
+		if field.Anonymous && name == "" && fieldType.Kind() == reflect.Struct {
+			generator.addProperties(fieldType, properties, required)
+			continue
+		}
+
+		if field.PkgPath != "" {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		// Fields closer to the top level take precedence, as they do in JSON
+		if _, exists := properties[name]; exists {
+			continue
+		}
+
+		schema := generator.schema(field.Type)
+
+		// Rules are only documented if they are valid, and are otherwise left for
+		// CheckValidationTags to report
+		rules, _ := parseRules(field.Tag.Get("validate"))
+
+		for _, rule := range rules {
+
+			if rule.name == "required" {
+				*required = append(*required, name)
+			} else {
+				applyRuleToSchema(schema, fieldType, rule)
+			}
+
+		}
+
+		properties[name] = schema
+
+	}
+
+}
+
+// applyRuleToSchema adds the constraint for a min, max or oneof rule to the
+// schema of a field
+func applyRuleToSchema(schema JSON, fieldType reflect.Type, rule validationRule) {
+
+	keywords := map[reflect.Kind][2]string{
+		reflect.String: {"minLength", "maxLength"},
+		reflect.Slice:  {"minItems", "maxItems"},
+		reflect.Array:  {"minItems", "maxItems"},
+		reflect.Map:    {"minProperties", "maxProperties"},
+	}
+
+	isNumber := fieldType == numberType || (fieldType.Kind() >= reflect.Int && fieldType.Kind() <= reflect.Float64)
+
+	switch rule.name {
+
+	case "min", "max":
+
+		index := 0
+
+		if rule.name == "max" {
+			index = 1
+		}
+
+		if isNumber {
+			schema[[2]string{"minimum", "maximum"}[index]] = rule.number
+		} else if keyword, ok := keywords[fieldType.Kind()]; ok {
+			schema[keyword[index]] = rule.number
+		}
+
+	case "oneof":
+
+		options := []interface{}{}
+
+		for _, option := range rule.options {
+
+			if number, err := strconv.ParseFloat(option, 64); err == nil && isNumber {
+				options = append(options, number)
+			} else {
+				options = append(options, option)
+			}
+
+		}
+
+		schema["enum"] = options
+
+	}
+
+}
@@ -0,0 +1,115 @@
+package jsonserver
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testCategory is a named struct that refers to itself, used to test schemas
+type testCategory struct {
+	Name     string          `json:"name" validate:"required,max=50"`
+	Parent   *testCategory   `json:"parent,omitempty"`
+	Children []*testCategory `json:"children"`
+}
+
+// testAudit is an embedded struct used to test schemas
+type testAudit struct {
+	Created time.Time `json:"created"`
+}
+
+// testListing is a struct using most kinds of field, used to test schemas
+type testListing struct {
+	testAudit
+	ID       uint64            `json:"id"`
+	Price    float64           `json:"price" validate:"min=0"`
+	Quantity int               `json:"quantity" validate:"oneof=1 5 10"`
+	Status   string            `json:"status" validate:"required,oneof=draft live"`
+	Tags     []string          `json:"tags" validate:"max=3"`
+	Labels   map[string]string `json:"labels"`
+	Image    []byte            `json:"image"`
+	Amount   json.Number       `json:"amount" validate:"max=100"`
+	Extra    interface{}       `json:"extra"`
+	Category testCategory      `json:"category"`
+	Inline   struct {
+		Note string `json:"note"`
+	} `json:"inline"`
+	Ignored  string `json:"-"`
+	Untagged bool
+	internal string
+}
+
+// TestSchemaGeneration tests building the schema of a struct, with named
+// structs collected as components
+func TestSchemaGeneration(t *testing.T) {
+
+	generator := newSchemaGenerator()
+	schema := generator.schema(reflect.TypeOf(&testListing{}))
+
+	expectedListing := JSON{
+		"type": "object",
+		"properties": JSON{
+			"created":  JSON{"type": "string", "format": "date-time"},
+			"id":       JSON{"type": "integer", "minimum": 0},
+			"price":    JSON{"type": "number", "minimum": 0.0},
+			"quantity": JSON{"type": "integer", "enum": []interface{}{1.0, 5.0, 10.0}},
+			"status":   JSON{"type": "string", "enum": []interface{}{"draft", "live"}},
+			"tags":     JSON{"type": "array", "items": JSON{"type": "string"}, "maxItems": 3.0},
+			"labels":   JSON{"type": "object", "additionalProperties": JSON{"type": "string"}},
+			"image":    JSON{"type": "string", "contentEncoding": "base64"},
+			"amount":   JSON{"type": "number", "maximum": 100.0},
+			"extra":    JSON{},
+			"category": JSON{"$ref": "#/components/schemas/testCategory"},
+			"inline":   JSON{"type": "object", "properties": JSON{"note": JSON{"type": "string"}}},
+			"Untagged": JSON{"type": "boolean"},
+		},
+		"required": []string{"status"},
+	}
+
+	expectedCategory := JSON{
+		"type": "object",
+		"properties": JSON{
+			"name":     JSON{"type": "string", "maxLength": 50.0},
+			"parent":   JSON{"$ref": "#/components/schemas/testCategory"},
+			"children": JSON{"type": "array", "items": JSON{"$ref": "#/components/schemas/testCategory"}},
+		},
+		"required": []string{"name"},
+	}
+
+	expected := JSON{"testListing": expectedListing, "testCategory": expectedCategory}
+
+	if !reflect.DeepEqual(schema, JSON{"$ref": "#/components/schemas/testListing"}) {
+		t.Errorf("Named struct was not referenced (schema: %v)", schema)
+	}
+
+	if !reflect.DeepEqual(generator.components, expected) {
+		t.Errorf("Incorrect components (expected: %v, actual: %v)", expected, generator.components)
+	}
+
+}
+
+// TestSchemaGenerationScalars tests building the schemas of types other than
+// structs
+func TestSchemaGenerationScalars(t *testing.T) {
+
+	types := map[reflect.Type]JSON{
+		reflect.TypeOf(true):               {"type": "boolean"},
+		reflect.TypeOf(int8(0)):            {"type": "integer"},
+		reflect.TypeOf([]float32{}):        {"type": "array", "items": JSON{"type": "number"}},
+		reflect.TypeOf(map[string][]int{}): {"type": "object", "additionalProperties": JSON{"type": "array", "items": JSON{"type": "integer"}}},
+		reflect.TypeOf(json.RawMessage{}):  {},
+		reflect.TypeOf(time.Duration(0)):   {"type": "integer"},
+		reflect.TypeOf(&time.Time{}):       {"type": "string", "format": "date-time"},
+		reflect.TypeOf(make(chan int)):     {},
+	}
+
+	for valueType, expected := range types {
+
+		if schema := newSchemaGenerator().schema(valueType); !reflect.DeepEqual(schema, expected) {
+			t.Errorf("Incorrect schema for %v (expected: %v, actual: %v)", valueType, expected, schema)
+		}
+
+	}
+
+}
@@ -0,0 +1,175 @@
+package jsonserver
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// timeoutWriter buffers a response so that it can be discarded in favour of a
+// timeout response if the request is not handled in time
+type timeoutWriter struct {
+	response    http.ResponseWriter
+	header      http.Header
+	body        bytes.Buffer
+	statusCode  int
+	wroteHeader bool
+	timedOut    bool
+	lock        sync.Mutex
+}
+
+// Header returns the headers that will be sent if the request is handled in time
+func (writer *timeoutWriter) Header() http.Header {
+
+	return writer.header
+
+}
+
+// Write buffers part of the response body, or fails if the request has timed
+// out
+func (writer *timeoutWriter) Write(body []byte) (int, error) {
+
+	writer.lock.Lock()
+	defer writer.lock.Unlock()
+
+	if writer.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+
+	if !writer.wroteHeader {
+		writer.writeHeader(http.StatusOK)
+	}
+
+	return writer.body.Write(body)
+
+}
+
+// WriteHeader records the status code of the response
+func (writer *timeoutWriter) WriteHeader(statusCode int) {
+
+	writer.lock.Lock()
+	defer writer.lock.Unlock()
+
+	if writer.timedOut || writer.wroteHeader {
+		return
+	}
+
+	writer.writeHeader(statusCode)
+
+}
+
+// writeHeader records the status code of the response, and must be called
+// while holding the lock
+func (writer *timeoutWriter) writeHeader(statusCode int) {
+
+	writer.wroteHeader = true
+	writer.statusCode = statusCode
+
+}
+
+// flush sends the buffered response to the client
+func (writer *timeoutWriter) flush() {
+
+	writer.lock.Lock()
+	defer writer.lock.Unlock()
+
+	for key, values := range writer.header {
+		writer.response.Header()[key] = values
+	}
+
+	if !writer.wroteHeader {
+		writer.writeHeader(http.StatusOK)
+	}
+
+	writer.response.WriteHeader(writer.statusCode)
+	writer.response.Write(writer.body.Bytes())
+
+}
+
+// reset discards the buffered headers and body so that a different response
+// can be sent instead
+func (writer *timeoutWriter) reset() {
+
+	writer.lock.Lock()
+	defer writer.lock.Unlock()
+
+	writer.header = http.Header{}
+	writer.body.Reset()
+	writer.statusCode = 0
+	writer.wroteHeader = false
+
+}
+
+// timeOut discards the buffered response and prevents anything further being
+// written, so that a timeout response can be sent instead
+func (writer *timeoutWriter) timeOut() {
+
+	writer.lock.Lock()
+	defer writer.lock.Unlock()
+
+	writer.timedOut = true
+
+}
+
+// runWithTimeout handles a request in the background, sending an error
+// response and cancelling the context passed to middleware and actions if it
+// is not handled within the timeout
+func (server *Server) runWithTimeout(timeout time.Duration, handler RouteAction, routeParams RouteParams, params string, request *http.Request, response http.ResponseWriter, body *[]byte) {
+
+	ctx, cancel := context.WithTimeout(request.Context(), timeout)
+	defer cancel()
+
+	request = request.WithContext(ctx)
+
+	writer := &timeoutWriter{response: response, header: http.Header{}}
+	done := make(chan struct{})
+	panicked := make(chan interface{}, 1)
+
+	// The handler may outlive the request, so a shutdown needs to wait for it
+	// separately
+	server.startRequest()
+
+	go func() {
+
+		defer server.finishRequest()
+
+		// Panics that are not recovered while handling the request are passed
+		// back to be raised in the request's own goroutine
+		defer func() {
+
+			if recovered := recover(); recovered != nil {
+				panicked <- recovered
+			}
+
+		}()
+
+		server.run(ctx, handler, routeParams, params, request, writer, body)
+
+		close(done)
+
+	}()
+
+	select {
+
+	case recovered := <-panicked:
+
+		panic(recovered)
+
+	case <-done:
+
+		writer.flush()
+
+	case <-ctx.Done():
+
+		writer.timeOut()
+
+		// There is nobody to respond to if the client has gone away
+		if ctx.Err() == context.DeadlineExceeded {
+			server.renderError(request, response, ErrorTimeout, http.StatusServiceUnavailable, ctx.Err())
+		}
+
+	}
+
+}
@@ -0,0 +1,267 @@
+package jsonserver
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestTimeoutReturnsJSON tests that a request that is not handled in time
+// receives a JSON error response
+func TestTimeoutReturnsJSON(t *testing.T) {
+
+	server := NewServer()
+	server.Timeout = 50 * time.Millisecond
+
+	server.RegisterRoute("GET", "/slow", []Middleware{}, func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) {
+		time.Sleep(200 * time.Millisecond)
+		response.Write([]byte("GET /slow"))
+	})
+
+	response := testRequest(server, "GET", "/slow", nil, nil)
+
+	if response.Code != http.StatusServiceUnavailable {
+		t.Errorf("Incorrect status code (expected: %v, actual: %v)", http.StatusServiceUnavailable, response.Code)
+	}
+
+	if response.Body.String() != `{"message":"Request timed out","success":false}` {
+		t.Errorf("Incorrect body (actual: %v)", response.Body.String())
+	}
+
+	if response.Header().Get("Content-Type") != "application/json; charset=UTF-8" {
+		t.Errorf("Incorrect content-type header (actual: %v)", response.Header().Get("Content-Type"))
+	}
+
+	server.Shutdown(context.Background())
+
+}
+
+// TestTimeoutPassesThroughResponse tests that a request handled in time
+// receives the response written by its action
+func TestTimeoutPassesThroughResponse(t *testing.T) {
+
+	server := NewServer()
+	server.Timeout = time.Second
+
+	server.RegisterRoute("POST", "/fast", []Middleware{}, func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) {
+		response.Header().Set("X-Fast", "yes")
+		response.WriteHeader(http.StatusCreated)
+		response.Write([]byte("POST /fast"))
+	})
+
+	response := testRequest(server, "POST", "/fast", nil, nil)
+
+	if response.Code != http.StatusCreated || response.Header().Get("X-Fast") != "yes" || response.Body.String() != "POST /fast" {
+		t.Errorf("Response was not passed through (status code: %v, body: %v)", response.Code, response.Body.String())
+	}
+
+}
+
+// TestTimeoutCancelsContext tests that the context passed to an action is
+// cancelled when the request times out
+func TestTimeoutCancelsContext(t *testing.T) {
+
+	server := NewServer()
+	server.Timeout = 50 * time.Millisecond
+	cancelled := make(chan error, 1)
+
+	server.RegisterRoute("GET", "/slow", []Middleware{}, func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) {
+
+		select {
+		case <-ctx.Done():
+			cancelled <- ctx.Err()
+		case <-time.After(time.Second):
+			cancelled <- nil
+		}
+
+	})
+
+	server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/slow", nil))
+
+	if err := <-cancelled; err != context.DeadlineExceeded {
+		t.Errorf("Context was not cancelled (expected: %v, actual: %v)", context.DeadlineExceeded, err)
+	}
+
+}
+
+// TestRouteTimeoutOverridesServerTimeout tests that a route's timeout takes
+// precedence over the server's timeout
+func TestRouteTimeoutOverridesServerTimeout(t *testing.T) {
+
+	server := NewServer()
+	server.Timeout = 50 * time.Millisecond
+
+	action := func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) {
+		time.Sleep(100 * time.Millisecond)
+		response.Write([]byte("done"))
+	}
+
+	server.RegisterRoute("GET", "/export", []Middleware{}, action, WithTimeout(time.Second))
+	server.RegisterRoute("GET", "/report", []Middleware{}, action)
+
+	response := testRequest(server, "GET", "/export", nil, nil)
+
+	if response.Code != http.StatusOK || response.Body.String() != "done" {
+		t.Errorf("Route timeout did not override server timeout")
+	}
+
+	response = httptest.NewRecorder()
+
+	server.ServeHTTP(response, httptest.NewRequest("GET", "/report", nil))
+
+	if response.Code != http.StatusServiceUnavailable {
+		t.Errorf("Server timeout did not apply to route without its own timeout")
+	}
+
+	server.Shutdown(context.Background())
+
+}
+
+// TestNegativeRouteTimeoutDisablesServerTimeout tests that a route with a
+// negative timeout is not timed out, and can stream its response
+func TestNegativeRouteTimeoutDisablesServerTimeout(t *testing.T) {
+
+	server := NewServer()
+	server.Timeout = 50 * time.Millisecond
+	flushable := false
+
+	server.RegisterRoute("GET", "/export", []Middleware{}, func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) {
+
+		_, hasDeadline := ctx.Deadline()
+		_, flushable = response.(http.Flusher)
+
+		if !hasDeadline {
+			time.Sleep(100 * time.Millisecond)
+			response.Write([]byte("GET /export"))
+		}
+
+	}, WithTimeout(-1))
+
+	response := testRequest(server, "GET", "/export", nil, nil)
+
+	if response.Code != http.StatusOK || response.Body.String() != "GET /export" {
+		t.Errorf("Route without a timeout was timed out (status code: %v, body: %v)", response.Code, response.Body.String())
+	}
+
+	if !flushable {
+		t.Errorf("Response of route without a timeout cannot be flushed")
+	}
+
+}
+
+// testSlowReader is a request body that is sent one byte at a time, with a
+// delay before each byte
+type testSlowReader struct {
+	remaining int
+	delay     time.Duration
+}
+
+// Read waits and then reads a single byte
+func (reader *testSlowReader) Read(buffer []byte) (int, error) {
+
+	if reader.remaining == 0 {
+		return 0, io.EOF
+	}
+
+	time.Sleep(reader.delay)
+
+	reader.remaining--
+	buffer[0] = 'x'
+
+	return 1, nil
+
+}
+
+// TestTimeoutCoversReadingBody tests that a body sent too slowly is subject to
+// the timeout
+func TestTimeoutCoversReadingBody(t *testing.T) {
+
+	server := NewServer()
+	server.Timeout = 100 * time.Millisecond
+
+	server.RegisterRoute("POST", "/upload", []Middleware{}, func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) {
+		response.Write(*body)
+	})
+
+	response := httptest.NewRecorder()
+	started := time.Now()
+
+	server.ServeHTTP(response, httptest.NewRequest("POST", "/upload", &testSlowReader{remaining: 15, delay: 100 * time.Millisecond}))
+
+	if response.Code != http.StatusServiceUnavailable {
+		t.Errorf("Incorrect status code (expected: %v, actual: %v)", http.StatusServiceUnavailable, response.Code)
+	}
+
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Errorf("Timeout did not apply while reading the body (elapsed: %v)", elapsed)
+	}
+
+}
+
+// TestTimeoutRecoversFromPanics tests that panics in a timed request are still
+// turned into error responses
+func TestTimeoutRecoversFromPanics(t *testing.T) {
+
+	server := NewServer()
+	server.Timeout = time.Second
+	server.OnPanic = func(ctx context.Context, request *http.Request, recovered interface{}, stack []byte) {}
+
+	server.RegisterRoute("GET", "/", []Middleware{}, func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) {
+		panic("action panic")
+	})
+
+	response := testRequest(server, "GET", "/", nil, nil)
+
+	if response.Code != http.StatusInternalServerError {
+		t.Errorf("Incorrect status code (expected: %v, actual: %v)", http.StatusInternalServerError, response.Code)
+	}
+
+}
+
+// TestTimeoutDiscardsPartialResponseOnPanic tests that a panic after part of a
+// timed response has been written replaces it with an error response
+func TestTimeoutDiscardsPartialResponseOnPanic(t *testing.T) {
+
+	server := NewServer()
+	server.Timeout = time.Second
+	server.OnPanic = func(ctx context.Context, request *http.Request, recovered interface{}, stack []byte) {}
+
+	server.RegisterRoute("GET", "/", []Middleware{}, func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) {
+		response.Header().Set("X-Partial", "true")
+		response.Write([]byte(`{"partial":`))
+		panic("action panic")
+	})
+
+	response := testRequest(server, "GET", "/", nil, nil)
+
+	if response.Code != http.StatusInternalServerError {
+		t.Errorf("Incorrect status code (expected: %v, actual: %v)", http.StatusInternalServerError, response.Code)
+	}
+
+	if response.Body.String() != `{"message":"Internal server error","success":false}` {
+		t.Errorf("Incorrect body (actual: %v)", response.Body.String())
+	}
+
+	if response.Header().Get("X-Partial") != "" {
+		t.Errorf("Headers of the partial response were sent")
+	}
+
+}
+
+// TestTimeoutWriterRejectsLateWrites tests that nothing can be written once a
+// request has timed out
+func TestTimeoutWriterRejectsLateWrites(t *testing.T) {
+
+	response := httptest.NewRecorder()
+	writer := &timeoutWriter{response: response, header: http.Header{}}
+
+	writer.timeOut()
+
+	if _, err := writer.Write([]byte("late")); err != http.ErrHandlerTimeout {
+		t.Errorf("Late write was not rejected (expected: %v, actual: %v)", http.ErrHandlerTimeout, err)
+	}
+
+}
@@ -0,0 +1,316 @@
+package jsonserver
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrDuplicateRoute is returned when registering a route whose path has the
+// same shape as a route already registered against the same method
+var ErrDuplicateRoute = errors.New("duplicate route")
+
+// routeNode is a node in a tree of route path fragments, allowing routes to be
+// matched in time proportional to the depth of a path rather than the number
+// of registered routes
+type routeNode struct {
+	static     map[string]*routeNode
+	wildcards  []*routeNode
+	constraint *paramConstraint
+	catchAll   *routeLeaf
+	leaf       *routeLeaf
+}
+
+// routeLeaf holds a route that terminates at a node, along with the names of
+// its wildcards in the order that they appear in the path
+type routeLeaf struct {
+	route      *Route
+	paramNames []string
+}
+
+// insert returns a copy of the tree with a route added, or an error if a route
+// with the same path shape has already been added. Only the nodes along the
+// route's path are copied, so the original tree is left unchanged and can
+// still be read while the copy is made
+func (node *routeNode) insert(route *Route) (*routeNode, error) {
+
+	root := node.copy()
+	slot, paramNames, err := root.slot(route.Path, true)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if *slot != nil {
+		return nil, fmt.Errorf("%w: %v conflicts with %v", ErrDuplicateRoute, route.Path, (*slot).route.Path)
+	}
+
+	*slot = &routeLeaf{route: route, paramNames: paramNames}
+
+	return root, nil
+
+}
+
+// remove returns a copy of the tree without the route that has the same path
+// shape as a path, copying only the nodes along the path and pruning any that
+// are left empty
+func (node *routeNode) remove(path string) *routeNode {
+
+	if root := node.without(strings.Split(normalisePath(path), "/")); root != nil {
+		return root
+	}
+
+	return &routeNode{}
+
+}
+
+// without returns a copy of a node without the route whose remaining path
+// fragments are given, or nil if the copy would have no routes or branches
+func (node *routeNode) without(routePathFragments []string) *routeNode {
+
+	copied := node.copy()
+
+	if len(routePathFragments) == 0 {
+
+		copied.leaf = nil
+
+	} else if routePathFragments[0] == ":" && len(routePathFragments) == 1 {
+
+		copied.catchAll = nil
+
+	} else if _, constraintSource, isWildcard := parseWildcard(routePathFragments[0]); isWildcard {
+
+		index := copied.wildcardIndex(constraintSource)
+
+		if index == -1 {
+			return node
+		}
+
+		if child := copied.wildcards[index].without(routePathFragments[1:]); child != nil {
+			copied.wildcards[index] = child
+		} else {
+			copied.wildcards = append(copied.wildcards[:index], copied.wildcards[index+1:]...)
+		}
+
+	} else {
+
+		child, ok := copied.static[routePathFragments[0]]
+
+		if !ok {
+			return node
+		}
+
+		if child = child.without(routePathFragments[1:]); child != nil {
+			copied.static[routePathFragments[0]] = child
+		} else {
+			delete(copied.static, routePathFragments[0])
+		}
+
+	}
+
+	if copied.leaf == nil && copied.catchAll == nil && len(copied.static) == 0 && len(copied.wildcards) == 0 {
+		return nil
+	}
+
+	return copied
+
+}
+
+// copy makes a shallow copy of a node with its own collections of branches, so
+// that branches can be added to or replaced in the copy without affecting the
+// original
+func (node *routeNode) copy() *routeNode {
+
+	copied := *node
+	copied.wildcards = append([]*routeNode{}, node.wildcards...)
+
+	if node.static != nil {
+
+		copied.static = make(map[string]*routeNode, len(node.static))
+
+		for routePathFragment, child := range node.static {
+			copied.static[routePathFragment] = child
+		}
+
+	}
+
+	return &copied
+
+}
+
+// conflicts returns the route already added to the tree with the same path
+// shape as a path, if there is one
+func (node *routeNode) conflicts(path string) *Route {
+
+	slot, _, _ := node.slot(path, false)
+
+	if slot == nil || *slot == nil {
+		return nil
+	}
+
+	return (*slot).route
+
+}
+
+// slot walks the tree to the place where a route path terminates, and returns
+// the wildcard names found in the path. When creating, any missing nodes are
+// created along the way and the nodes that already exist are replaced with
+// copies, so the node that slot is called on should itself be a copy
+func (node *routeNode) slot(path string, create bool) (**routeLeaf, []string, error) {
+
+	routePathFragments := strings.Split(normalisePath(path), "/")
+	paramNames := []string{}
+
+	for i, routePathFragment := range routePathFragments {
+
+		isFinalWildcard := routePathFragment == ":" && i == (len(routePathFragments)-1)
+		paramName, constraintSource, isWildcard := parseWildcard(routePathFragment)
+
+		// Final wildcards collect the remainder of the path, so end the branch here
+		if isFinalWildcard {
+
+			return &node.catchAll, append(paramNames, "{catchAll}"), nil
+
+			// Regular wildcards share a branch with other wildcards that have the
+			// same constraint, whatever they are named
+		} else if isWildcard {
+
+			index := node.wildcardIndex(constraintSource)
+
+			if index == -1 && !create {
+				return nil, nil, nil
+			} else if index == -1 {
+
+				constraint, err := compileConstraint(constraintSource)
+
+				if err != nil {
+					return nil, nil, err
+				}
+
+				wildcard := &routeNode{constraint: constraint}
+				index = len(node.wildcards)
+
+				// Constrained wildcards are tried before unconstrained ones
+				if constraint != nil && len(node.wildcards) > 0 && node.wildcards[len(node.wildcards)-1].constraint == nil {
+					index--
+					node.wildcards = append(node.wildcards[:index], wildcard, node.wildcards[index])
+				} else {
+					node.wildcards = append(node.wildcards, wildcard)
+				}
+
+			} else if create {
+
+				node.wildcards[index] = node.wildcards[index].copy()
+
+			}
+
+			paramNames = append(paramNames, paramName)
+			node = node.wildcards[index]
+
+			// Static fragments each have their own branch
+		} else {
+
+			child, ok := node.static[routePathFragment]
+
+			if !ok && !create {
+				return nil, nil, nil
+			} else if create {
+
+				if ok {
+					child = child.copy()
+				} else {
+					child = &routeNode{}
+				}
+
+				if node.static == nil {
+					node.static = map[string]*routeNode{}
+				}
+
+				node.static[routePathFragment] = child
+
+			}
+
+			node = child
+
+		}
+
+	}
+
+	return &node.leaf, paramNames, nil
+
+}
+
+// wildcardIndex finds the position of the wildcard branch with a given
+// constraint, or -1 if there is no such branch
+func (node *routeNode) wildcardIndex(constraintSource string) int {
+
+	for i, wildcard := range node.wildcards {
+
+		if (wildcard.constraint == nil && constraintSource == "") || (wildcard.constraint != nil && wildcard.constraint.source == constraintSource) {
+			return i
+		}
+
+	}
+
+	return -1
+
+}
+
+// lookup finds the most specific route that matches a path
+func (node *routeNode) lookup(path string) (*Route, RouteParams) {
+
+	leaf, values := node.find(strings.Split(normalisePath(path), "/"), []string{})
+
+	if leaf == nil {
+		return nil, RouteParams{}
+	}
+
+	routeParams := RouteParams{}
+
+	for i, paramName := range leaf.paramNames {
+		routeParams[paramName] = values[i]
+	}
+
+	return leaf.route, routeParams
+
+}
+
+// find searches the tree for a route matching the remaining path fragments,
+// collecting wildcard values along the way. At each fragment a static branch
+// is preferred over a wildcard (with constrained wildcards preferred over
+// unconstrained ones), and a wildcard over a final wildcard, with the search
+// falling back to the less specific branches if a more specific one leads
+// nowhere
+func (node *routeNode) find(pathFragments []string, values []string) (*routeLeaf, []string) {
+
+	if len(pathFragments) == 0 {
+		return node.leaf, values
+	}
+
+	if child, ok := node.static[pathFragments[0]]; ok {
+
+		if leaf, leafValues := child.find(pathFragments[1:], values); leaf != nil {
+			return leaf, leafValues
+		}
+
+	}
+
+	for _, wildcard := range node.wildcards {
+
+		if wildcard.constraint != nil && !wildcard.constraint.matches(pathFragments[0]) {
+			continue
+		}
+
+		if leaf, leafValues := wildcard.find(pathFragments[1:], append(values[:len(values):len(values)], pathFragments[0])); leaf != nil {
+			return leaf, leafValues
+		}
+
+	}
+
+	if node.catchAll != nil {
+		return node.catchAll, append(values[:len(values):len(values)], strings.Join(pathFragments, "/"))
+	}
+
+	return nil, nil
+
+}
@@ -0,0 +1,257 @@
+package jsonserver
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+// testTree builds a tree from a list of route paths
+func testTree(paths ...string) *routeNode {
+
+	tree := &routeNode{}
+
+	for _, path := range paths {
+		tree, _ = tree.insert(&Route{Path: path, Action: func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) {}})
+	}
+
+	return tree
+
+}
+
+// TestTreeLookupMatchesLikeRoutes tests that looking up paths in a tree gives
+// the same results as matching individual routes
+func TestTreeLookupMatchesLikeRoutes(t *testing.T) {
+
+	routePaths := []string{"/", "/shop/products", "/shop/products/{id}", "/shop/{category}/products/{id}", "/files/{bucket}/:"}
+	tree := testTree(routePaths...)
+	paths := []string{"", "/", "/shop/products", "/shop/products/", "/shop/products/123", "/shop/kitchen/products/123", "/files/images/a/b.png", "/files/images", "/foo", "/shop/products/123/456"}
+
+	for _, path := range paths {
+
+		var expectedPath string
+		expectedParams := RouteParams{}
+
+		for _, routePath := range routePaths {
+
+			route := Route{Path: routePath}
+
+			if matches, params := route.MatchesPath(path); matches {
+				expectedPath = routePath
+				expectedParams = params
+				break
+			}
+
+		}
+
+		route, params := tree.lookup(path)
+		actualPath := ""
+
+		if route != nil {
+			actualPath = route.Path
+		}
+
+		if actualPath != expectedPath {
+			t.Errorf("Route mismatch for %v (expected: %v, actual: %v)", path, expectedPath, actualPath)
+		}
+
+		if len(params) != len(expectedParams) {
+			t.Errorf("Param mismatch for %v (expected: %v, actual: %v)", path, expectedParams, params)
+		}
+
+		for key, value := range expectedParams {
+
+			if params[key] != value {
+				t.Errorf("Param mismatch for %v (expected: %v, actual: %v)", path, expectedParams, params)
+			}
+
+		}
+
+	}
+
+}
+
+// TestTreeLookupPrefersStaticFragments tests that static fragments beat
+// wildcards, and wildcards beat final wildcards, whatever the order in which
+// routes are added
+func TestTreeLookupPrefersStaticFragments(t *testing.T) {
+
+	orders := [][]string{
+		{"/foo/{bar}", "/foo/new", "/foo/:"},
+		{"/foo/:", "/foo/new", "/foo/{bar}"},
+		{"/foo/new", "/foo/:", "/foo/{bar}"},
+	}
+
+	for _, order := range orders {
+
+		tree := testTree(order...)
+
+		if route, _ := tree.lookup("/foo/new"); route == nil || route.Path != "/foo/new" {
+			t.Errorf("Route mismatch for %v (expected: %v, actual: %v)", order, "/foo/new", route)
+		}
+
+		if route, params := tree.lookup("/foo/old"); route == nil || route.Path != "/foo/{bar}" || params["bar"] != "old" {
+			t.Errorf("Route mismatch for %v (expected: %v, actual: %v)", order, "/foo/{bar}", route)
+		}
+
+		if route, params := tree.lookup("/foo/old/older"); route == nil || route.Path != "/foo/:" || params["{catchAll}"] != "old/older" {
+			t.Errorf("Route mismatch for %v (expected: %v, actual: %v)", order, "/foo/:", route)
+		}
+
+	}
+
+}
+
+// TestTreeLookupBacktracks tests that a lookup tries other branches when a
+// static branch leads nowhere
+func TestTreeLookupBacktracks(t *testing.T) {
+
+	tree := testTree("/foo/bar/baz", "/foo/{id}/qux", "/foo/:")
+	route, params := tree.lookup("/foo/bar/qux")
+
+	if route == nil || route.Path != "/foo/{id}/qux" || params["id"] != "bar" {
+		t.Errorf("Route mismatch (expected: %v, actual: %v)", "/foo/{id}/qux", route)
+	}
+
+	route, params = tree.lookup("/foo/bar/quux")
+
+	if route == nil || route.Path != "/foo/:" || params["{catchAll}"] != "bar/quux" {
+		t.Errorf("Route mismatch (expected: %v, actual: %v)", "/foo/:", route)
+	}
+
+}
+
+// TestTreeLookupUsesEachRoutesParamNames tests that wildcards sharing a
+// branch are named according to the route that matched
+func TestTreeLookupUsesEachRoutesParamNames(t *testing.T) {
+
+	tree := testTree("/products/{id}", "/products/{slug}/reviews")
+	_, params := tree.lookup("/products/123")
+
+	if len(params) != 1 || params["id"] != "123" {
+		t.Errorf("Param mismatch (expected: %v, actual: %v)", "map[id:123]", params)
+	}
+
+	_, params = tree.lookup("/products/chair/reviews")
+
+	if len(params) != 1 || params["slug"] != "chair" {
+		t.Errorf("Param mismatch (expected: %v, actual: %v)", "map[slug:chair]", params)
+	}
+
+}
+
+// TestTreeInsertRejectsDuplicates tests that a route with the same shape as an
+// existing route is not added
+func TestTreeInsertRejectsDuplicates(t *testing.T) {
+
+	tree := testTree("/foo/{bar}", "/foo/:")
+
+	if _, err := tree.insert(&Route{Path: "/foo/{baz}/"}); !errors.Is(err, ErrDuplicateRoute) {
+		t.Errorf("Duplicate wildcard route unexpectedly added")
+	}
+
+	if _, err := tree.insert(&Route{Path: "foo/:"}); !errors.Is(err, ErrDuplicateRoute) {
+		t.Errorf("Duplicate final wildcard route unexpectedly added")
+	}
+
+	if _, err := tree.insert(&Route{Path: "/foo/bar"}); err != nil {
+		t.Errorf("Distinct route not added")
+	}
+
+	if tree.conflicts("/foo/{qux}") == nil || tree.conflicts("/foo/baz") != nil {
+		t.Errorf("Conflicting routes incorrectly reported")
+	}
+
+}
+
+// TestTreeLookupHonoursConstraints tests that wildcards only match values
+// satisfying their constraints, falling through to other routes otherwise
+func TestTreeLookupHonoursConstraints(t *testing.T) {
+
+	tree := testTree("/products/{slug}", "/products/{id:int}", "/products/{code:[A-Z]{3}}/stock", "/days/{day:date}")
+	paths := map[string]string{
+		"/products/123":       "/products/{id:int}",
+		"/products/chair":     "/products/{slug}",
+		"/products/ABC/stock": "/products/{code:[A-Z]{3}}/stock",
+		"/products/abc/stock": "",
+		"/days/2024-01-31":    "/days/{day:date}",
+		"/days/tomorrow":      "",
+	}
+
+	for path, expected := range paths {
+
+		route, _ := tree.lookup(path)
+		actual := ""
+
+		if route != nil {
+			actual = route.Path
+		}
+
+		if actual != expected {
+			t.Errorf("Route mismatch for %v (expected: %v, actual: %v)", path, expected, actual)
+		}
+
+	}
+
+	if _, params := tree.lookup("/products/123"); len(params) != 1 || params["id"] != "123" {
+		t.Errorf("Param mismatch (expected: %v, actual: %v)", "map[id:123]", params)
+	}
+
+}
+
+// TestTreeChangesLeaveOriginalUnchanged tests that inserting and removing
+// routes gives a new tree without changing the tree that is still being read
+func TestTreeChangesLeaveOriginalUnchanged(t *testing.T) {
+
+	original := testTree("/foo/{bar:int}", "/foo/{bar}/baz", "/qux")
+	inserted, _ := original.insert(&Route{Path: "/foo/{bar:int}/baz"})
+	removed := inserted.remove("/foo/{bar}/baz")
+
+	lookups := map[*routeNode]map[string]string{
+		original: {"/foo/1": "/foo/{bar:int}", "/foo/1/baz": "/foo/{bar}/baz", "/foo/a/baz": "/foo/{bar}/baz", "/qux": "/qux"},
+		inserted: {"/foo/1": "/foo/{bar:int}", "/foo/1/baz": "/foo/{bar:int}/baz", "/foo/a/baz": "/foo/{bar}/baz", "/qux": "/qux"},
+		removed:  {"/foo/1": "/foo/{bar:int}", "/foo/1/baz": "/foo/{bar:int}/baz", "/foo/a/baz": "", "/qux": "/qux"},
+	}
+
+	for tree, expectedPaths := range lookups {
+
+		for path, expectedPath := range expectedPaths {
+
+			route, _ := tree.lookup(path)
+
+			if (route == nil && expectedPath != "") || (route != nil && route.Path != expectedPath) {
+				t.Errorf("Incorrect route for %v (expected: %v, actual: %v)", path, expectedPath, route)
+			}
+
+		}
+
+	}
+
+}
+
+// TestTreeRemovePrunesEmptyNodes tests that removing routes removes the nodes
+// that are no longer needed, while keeping those still used by other routes
+func TestTreeRemovePrunesEmptyNodes(t *testing.T) {
+
+	tree := testTree("/p0/{id}/x", "/p1/{id}/x", "/p2/{id}/x", "/p2/{id:int}/y", "/p2/:")
+
+	for _, path := range []string{"/p0/{id}/x", "/p1/{id}/x", "/p2/{id}/x"} {
+		tree = tree.remove(path)
+	}
+
+	if len(tree.static) != 1 || len(tree.static["p2"].wildcards) != 1 || tree.static["p2"].catchAll == nil {
+		t.Errorf("Emptied nodes were not pruned (static: %v)", tree.static)
+	}
+
+	if route, _ := tree.lookup("/p2/1/y"); route == nil || route.Path != "/p2/{id:int}/y" {
+		t.Errorf("Remaining route was removed (actual: %v)", route)
+	}
+
+	tree = tree.remove("/p2/{id:int}/y").remove("/p2/:")
+
+	if len(tree.static) != 0 || len(tree.wildcards) != 0 {
+		t.Errorf("Tree was not emptied (static: %v, wildcards: %v)", tree.static, tree.wildcards)
+	}
+
+}
@@ -16,3 +16,12 @@ type RouteAction func(ctx context.Context, request *http.Request, response http.
 
 // Middleware is a function signature for HTTP middleware that can be assigned to routes
 type Middleware func(ctx context.Context, request *http.Request, response http.ResponseWriter, body *[]byte) (bool, int)
+
+// Wrapper is a function signature for HTTP middleware that wraps an action,
+// allowing it to run code both before and after the action is carried out
+type Wrapper func(next RouteAction) RouteAction
+
+// RouteRegistrar is implemented by anything that routes can be registered with
+type RouteRegistrar interface {
+	RegisterRoute(method string, path string, middleware []Middleware, action RouteAction, options ...RouteOption) error
+}
@@ -0,0 +1,473 @@
+package jsonserver
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// FieldError describes why a field failed validation, where the field is
+// given as a path of JSON names such as "items[0].name"
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// ValidationErrors lists every field that failed validation
+type ValidationErrors []FieldError
+
+// validationRule is a single rule from a validate struct tag, such as min=3
+type validationRule struct {
+	name     string
+	argument string
+	number   float64
+	options  []string
+}
+
+// fieldRules holds the JSON name and validation rules of a struct field
+type fieldRules struct {
+	index    []int
+	name     string
+	rules    []validationRule
+	embedded bool
+}
+
+// structRulesCache holds the validation rules of struct types, keyed by type,
+// so that struct tags are only parsed once
+var structRulesCache sync.Map
+
+// Error describes every field that failed validation
+func (validationErrors ValidationErrors) Error() string {
+
+	messages := make([]string, len(validationErrors))
+
+	for i, fieldError := range validationErrors {
+		messages[i] = fieldError.Field + ": " + fieldError.Message
+	}
+
+	return strings.Join(messages, "; ")
+
+}
+
+// Validate checks a value (and any structs, slices and maps nested within it)
+// against the rules in the validate tags of its struct fields, returning
+// ValidationErrors listing every field that fails. The supported rules are
+// required, min=N, max=N (which apply to the value of numbers and the length
+// of strings, slices and maps) and oneof=a b c
+func Validate(value interface{}) error {
+
+	validationErrors := ValidationErrors{}
+
+	if err := validateValue(reflect.ValueOf(value), "", &validationErrors); err != nil {
+		return err
+	}
+
+	if len(validationErrors) > 0 {
+		return validationErrors
+	}
+
+	return nil
+
+}
+
+// CheckValidationTags checks that the validate tags of a type (and any types
+// nested within it) can be parsed
+func CheckValidationTags(valueType reflect.Type) error {
+
+	return checkType(valueType, map[reflect.Type]bool{})
+
+}
+
+// checkType checks the validate tags of a type, skipping types already seen
+func checkType(valueType reflect.Type, seen map[reflect.Type]bool) error {
+
+	for valueType.Kind() == reflect.Ptr || valueType.Kind() == reflect.Slice || valueType.Kind() == reflect.Array || valueType.Kind() == reflect.Map {
+		valueType = valueType.Elem()
+	}
+
+	if valueType.Kind() != reflect.Struct || seen[valueType] {
+		return nil
+	}
+
+	seen[valueType] = true
+
+	fields, err := structRules(valueType)
+
+	if err != nil {
+		return err
+	}
+
+	for _, field := range fields {
+
+		if err := checkType(valueType.FieldByIndex(field.index).Type, seen); err != nil {
+			return err
+		}
+
+	}
+
+	return nil
+
+}
+
+// validateValue validates a value found at a path, recording any failures
+func validateValue(value reflect.Value, path string, validationErrors *ValidationErrors) error {
+
+	for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+
+		if value.IsNil() {
+			return nil
+		}
+
+		value = value.Elem()
+
+	}
+
+	switch value.Kind() {
+
+	case reflect.Struct:
+
+		fields, err := structRules(value.Type())
+
+		if err != nil {
+			return err
+		}
+
+		for _, field := range fields {
+
+			fieldValue := value.FieldByIndex(field.index)
+			fieldPath := joinFieldPath(path, field.name)
+
+			// Embedded structs without a JSON name share their parent's path
+			if field.embedded {
+				fieldPath = path
+			}
+
+			if failed := applyRules(fieldValue, fieldPath, field.rules, validationErrors); failed {
+				continue
+			}
+
+			if err := validateValue(fieldValue, fieldPath, validationErrors); err != nil {
+				return err
+			}
+
+		}
+
+	case reflect.Slice, reflect.Array:
+
+		for i := 0; i < value.Len(); i++ {
+
+			if err := validateValue(value.Index(i), path+"["+strconv.Itoa(i)+"]", validationErrors); err != nil {
+				return err
+			}
+
+		}
+
+	case reflect.Map:
+
+		for _, key := range value.MapKeys() {
+
+			if err := validateValue(value.MapIndex(key), path+"["+fmt.Sprint(key.Interface())+"]", validationErrors); err != nil {
+				return err
+			}
+
+		}
+
+	}
+
+	return nil
+
+}
+
+// applyRules checks a field's value against its rules, recording the first
+// failure and reporting whether there was one
+func applyRules(value reflect.Value, path string, rules []validationRule, validationErrors *ValidationErrors) bool {
+
+	for _, rule := range rules {
+
+		if rule.name == "required" {
+
+			if isEmpty(value) {
+				*validationErrors = append(*validationErrors, FieldError{Field: path, Rule: rule.name, Message: "is required"})
+				return true
+			}
+
+			continue
+
+		}
+
+		// Other rules do not apply to optional values that have not been given
+		for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+
+			if value.IsNil() {
+				return false
+			}
+
+			value = value.Elem()
+
+		}
+
+		if message := checkRule(value, rule); message != "" {
+			*validationErrors = append(*validationErrors, FieldError{Field: path, Rule: rule.name, Message: message})
+			return true
+		}
+
+	}
+
+	return false
+
+}
+
+// checkRule checks a value against a min, max or oneof rule, returning a
+// message describing any failure
+func checkRule(value reflect.Value, rule validationRule) string {
+
+	switch rule.name {
+
+	case "min", "max":
+
+		measure, isLength, measurable := measureValue(value)
+
+		// Values whose type is only known at runtime may not be measurable
+		if !measurable {
+			return ""
+		}
+
+		if rule.name == "min" && measure < rule.number {
+
+			if isLength {
+				return "must have a length of at least " + rule.argument
+			}
+
+			return "must be at least " + rule.argument
+
+		}
+
+		if rule.name == "max" && measure > rule.number {
+
+			if isLength {
+				return "must have a length of at most " + rule.argument
+			}
+
+			return "must be at most " + rule.argument
+
+		}
+
+	case "oneof":
+
+		actual := fmt.Sprint(value.Interface())
+
+		for _, option := range rule.options {
+
+			if actual == option {
+				return ""
+			}
+
+		}
+
+		return "must be one of " + strings.Join(rule.options, ", ")
+
+	}
+
+	return ""
+
+}
+
+// measureValue obtains the number that min and max rules compare against,
+// reporting whether it is a length and whether the value can be measured
+func measureValue(value reflect.Value) (float64, bool, bool) {
+
+	switch value.Kind() {
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+
+		return float64(value.Int()), false, true
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+
+		return float64(value.Uint()), false, true
+
+	case reflect.Float32, reflect.Float64:
+
+		return value.Float(), false, true
+
+	case reflect.String:
+
+		// Numbers decoded as json.Number are compared by value
+		if value.Type().Name() == "Number" && value.Type().PkgPath() == "encoding/json" {
+			number, _ := strconv.ParseFloat(value.String(), 64)
+			return number, false, true
+		}
+
+		return float64(utf8.RuneCountInString(value.String())), true, true
+
+	case reflect.Slice, reflect.Array, reflect.Map:
+
+		return float64(value.Len()), true, true
+
+	}
+
+	return 0, false, false
+
+}
+
+// isMeasurable checks whether min and max rules can be used with a kind of
+// field, where interfaces are measured according to the value they hold
+func isMeasurable(kind reflect.Kind) bool {
+
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	case reflect.Float32, reflect.Float64, reflect.String, reflect.Slice, reflect.Array, reflect.Map, reflect.Interface:
+		return true
+	}
+
+	return false
+
+}
+
+// isEmpty checks whether a value is missing for the purposes of the required
+// rule
+func isEmpty(value reflect.Value) bool {
+
+	switch value.Kind() {
+
+	case reflect.Ptr, reflect.Interface:
+
+		return value.IsNil()
+
+	case reflect.String, reflect.Slice, reflect.Map:
+
+		return value.Len() == 0
+
+	}
+
+	return value.IsZero()
+
+}
+
+// structRules obtains the JSON names and validation rules of a struct type's
+// fields
+func structRules(structType reflect.Type) ([]fieldRules, error) {
+
+	if cached, ok := structRulesCache.Load(structType); ok {
+		return cached.([]fieldRules), nil
+	}
+
+	fields := []fieldRules{}
+
+	for i := 0; i < structType.NumField(); i++ {
+
+		field := structType.Field(i)
+
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+
+		if name == "-" {
+			continue
+		}
+
+		embedded := field.Anonymous && name == ""
+
+		if name == "" {
+			name = field.Name
+		}
+
+		rules, err := parseRules(field.Tag.Get("validate"))
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid validate tag on %v.%v: %w", structType.Name(), field.Name, err)
+		}
+
+		fieldType := field.Type
+
+		for fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+
+		for _, rule := range rules {
+
+			if (rule.name == "min" || rule.name == "max") && !isMeasurable(fieldType.Kind()) {
+				return nil, fmt.Errorf("invalid validate tag on %v.%v: %v cannot be used with a %v", structType.Name(), field.Name, rule.name, fieldType.Kind())
+			}
+
+		}
+
+		fields = append(fields, fieldRules{index: field.Index, name: name, rules: rules, embedded: embedded})
+
+	}
+
+	structRulesCache.Store(structType, fields)
+
+	return fields, nil
+
+}
+
+// parseRules parses the rules in a validate struct tag
+func parseRules(tag string) ([]validationRule, error) {
+
+	rules := []validationRule{}
+
+	if tag == "" {
+		return rules, nil
+	}
+
+	for _, part := range strings.Split(tag, ",") {
+
+		name, argument, _ := strings.Cut(strings.TrimSpace(part), "=")
+		rule := validationRule{name: name, argument: argument}
+
+		switch name {
+
+		case "required":
+
+		case "min", "max":
+
+			number, err := strconv.ParseFloat(argument, 64)
+
+			if err != nil {
+				return nil, fmt.Errorf("rule %v needs a number", name)
+			}
+
+			rule.number = number
+
+		case "oneof":
+
+			rule.options = strings.Fields(argument)
+
+			if len(rule.options) == 0 {
+				return nil, fmt.Errorf("rule %v needs at least one option", name)
+			}
+
+		default:
+
+			return nil, fmt.Errorf("unknown rule %v", name)
+
+		}
+
+		rules = append(rules, rule)
+
+	}
+
+	return rules, nil
+
+}
+
+// joinFieldPath appends a field name to a path
+func joinFieldPath(path string, name string) string {
+
+	if path == "" {
+		return name
+	}
+
+	return path + "." + name
+
+}
@@ -0,0 +1,163 @@
+package jsonserver
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// testAddress is a nested struct used to test validation
+type testAddress struct {
+	Street   string `json:"street" validate:"required"`
+	Postcode string `json:"postcode" validate:"min=5,max=8"`
+}
+
+// testTimestamps is an embedded struct used to test validation
+type testTimestamps struct {
+	Created string `json:"created" validate:"required"`
+}
+
+// testOrder is a struct used to test validation
+type testOrder struct {
+	testTimestamps
+	Name     string            `json:"name" validate:"required,max=10"`
+	Quantity int               `json:"quantity" validate:"min=1,max=100"`
+	Status   string            `json:"status" validate:"oneof=pending paid"`
+	Discount *float64          `json:"discount,omitempty" validate:"max=50"`
+	Tags     []string          `json:"tags" validate:"max=2"`
+	Address  *testAddress      `json:"address" validate:"required"`
+	Items    []testAddress     `json:"items"`
+	Extra    map[string]string `json:"-" validate:"required"`
+	internal string
+}
+
+// testValidOrder creates an order that passes validation
+func testValidOrder() testOrder {
+
+	return testOrder{
+		testTimestamps: testTimestamps{Created: "today"},
+		Name:           "Chair",
+		Quantity:       2,
+		Status:         "paid",
+		Tags:           []string{"furniture"},
+		Address:        &testAddress{Street: "High Street", Postcode: "AB1 2CD"},
+		Items:          []testAddress{{Street: "Low Street", Postcode: "EF3 4GH"}},
+	}
+
+}
+
+// TestValidatePassesValidValue tests that a valid value has no errors
+func TestValidatePassesValidValue(t *testing.T) {
+
+	order := testValidOrder()
+
+	if err := Validate(&order); err != nil {
+		t.Errorf("Unexpected validation error: %v", err)
+	}
+
+}
+
+// TestValidateListsEveryInvalidField tests that every invalid field is
+// reported with its JSON path
+func TestValidateListsEveryInvalidField(t *testing.T) {
+
+	discount := 75.0
+	order := testValidOrder()
+
+	order.Created = ""
+	order.Name = "A very long name"
+	order.Quantity = 0
+	order.Status = "refunded"
+	order.Discount = &discount
+	order.Tags = []string{"a", "b", "c"}
+	order.Items = []testAddress{{Street: "", Postcode: "AB1"}}
+
+	expected := ValidationErrors{
+		{Field: "created", Rule: "required", Message: "is required"},
+		{Field: "name", Rule: "max", Message: "must have a length of at most 10"},
+		{Field: "quantity", Rule: "min", Message: "must be at least 1"},
+		{Field: "status", Rule: "oneof", Message: "must be one of pending, paid"},
+		{Field: "discount", Rule: "max", Message: "must be at most 50"},
+		{Field: "tags", Rule: "max", Message: "must have a length of at most 2"},
+		{Field: "items[0].street", Rule: "required", Message: "is required"},
+		{Field: "items[0].postcode", Rule: "min", Message: "must have a length of at least 5"},
+	}
+
+	err := Validate(order)
+	validationErrors := ValidationErrors{}
+
+	if !errors.As(err, &validationErrors) || !reflect.DeepEqual(validationErrors, expected) {
+		t.Errorf("Validation errors mismatch (expected: %v, actual: %v)", expected, err)
+	}
+
+}
+
+// TestValidateRequiredNestedStruct tests that a missing nested struct is
+// reported without validating its fields
+func TestValidateRequiredNestedStruct(t *testing.T) {
+
+	order := testValidOrder()
+	order.Address = nil
+
+	err := Validate(order)
+
+	if err == nil || err.Error() != "address: is required" {
+		t.Errorf("Validation error mismatch (expected: %v, actual: %v)", "address: is required", err)
+	}
+
+}
+
+// TestValidateJSONNumbers tests that json.Number values are compared as numbers
+func TestValidateJSONNumbers(t *testing.T) {
+
+	type testNumber struct {
+		Value json.Number `json:"value" validate:"min=10"`
+	}
+
+	if err := Validate(testNumber{Value: "5"}); err == nil {
+		t.Errorf("Number below minimum was not reported")
+	}
+
+	if err := Validate(testNumber{Value: "500"}); err != nil {
+		t.Errorf("Unexpected validation error: %v", err)
+	}
+
+}
+
+// TestCheckValidationTags tests that invalid validate tags are reported
+func TestCheckValidationTags(t *testing.T) {
+
+	type testUnknownRule struct {
+		Name string `validate:"shiny"`
+	}
+
+	type testBadNumber struct {
+		Name string `validate:"min=five"`
+	}
+
+	type testNestedBadTag struct {
+		Children []testUnknownRule
+	}
+
+	type testUnmeasurableBool struct {
+		Active *bool `validate:"min=1"`
+	}
+
+	type testUnmeasurableStruct struct {
+		Order testOrder `validate:"max=1"`
+	}
+
+	if err := CheckValidationTags(reflect.TypeOf(testOrder{})); err != nil {
+		t.Errorf("Unexpected error checking tags: %v", err)
+	}
+
+	for _, value := range []interface{}{testUnknownRule{}, testBadNumber{}, &testNestedBadTag{}, testUnmeasurableBool{}, testUnmeasurableStruct{}} {
+
+		if err := CheckValidationTags(reflect.TypeOf(value)); err == nil {
+			t.Errorf("Invalid tag on %T was not reported", value)
+		}
+
+	}
+
+}
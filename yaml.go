@@ -0,0 +1,1091 @@
+package jsonserver
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// YAMLCodec encodes and decodes YAML. Values are converted by way of JSON, so
+// they honour the same struct tags as JSON. Decoding supports the parts of
+// YAML 1.2 used by typical documents: block and flow mappings and sequences,
+// plain, quoted and block scalars, and comments, but not anchors, aliases,
+// tags, complex keys or multiple documents (which are rejected rather than
+// ignored)
+type YAMLCodec struct{}
+
+// yamlFloat matches plain scalars that YAML resolves to floats
+var yamlFloat = regexp.MustCompile(`^[-+]?(\.[0-9]+|[0-9]+(\.[0-9]*)?)([eE][-+]?[0-9]+)?$`)
+
+// yamlLine is a line of a YAML document, split into its indentation and text
+type yamlLine struct {
+	number int
+	indent int
+	text   string
+}
+
+// yamlParser parses the lines of a YAML document into a tree
+type yamlParser struct {
+	lines []yamlLine
+	index int
+	depth int
+}
+
+// yamlFlowParser parses a flow collection or scalar within a single string
+type yamlFlowParser struct {
+	text  string
+	pos   int
+	depth int
+}
+
+// ContentType is the Content-Type header sent with YAML responses
+func (codec YAMLCodec) ContentType() string {
+
+	return "application/yaml"
+
+}
+
+// MediaTypes lists the media types of YAML
+func (codec YAMLCodec) MediaTypes() []string {
+
+	return []string{"application/yaml", "application/x-yaml", "text/yaml", "text/x-yaml"}
+
+}
+
+// Encode encodes a value as YAML, using block style for collections
+func (codec YAMLCodec) Encode(value interface{}) ([]byte, error) {
+
+	tree, err := toTree(value)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if isYAMLBlock(tree) {
+		return appendYAMLBlock([]byte{}, tree, 0), nil
+	}
+
+	return append(appendYAMLScalar([]byte{}, tree), '\n'), nil
+
+}
+
+// Decode decodes YAML into a value
+func (codec YAMLCodec) Decode(body []byte, value interface{}) error {
+
+	tree, err := decodeYAML(body)
+
+	if err != nil {
+		return err
+	}
+
+	return fromTree(tree, value)
+
+}
+
+// isYAMLBlock checks whether a tree is a collection with entries, which is
+// written in block style rather than on a single line
+func isYAMLBlock(tree interface{}) bool {
+
+	switch node := tree.(type) {
+	case map[string]interface{}:
+		return len(node) > 0
+	case []interface{}:
+		return len(node) > 0
+	}
+
+	return false
+
+}
+
+// appendYAMLBlock appends a collection with entries in block style, with each
+// entry on its own line at the given indentation
+func appendYAMLBlock(buffer []byte, tree interface{}, indent int) []byte {
+
+	padding := strings.Repeat(" ", indent)
+
+	switch node := tree.(type) {
+
+	case map[string]interface{}:
+
+		for _, key := range sortedKeys(node) {
+
+			buffer = appendYAMLScalar(append(buffer, padding...), key)
+			buffer = append(buffer, ':')
+
+			if isYAMLBlock(node[key]) {
+				buffer = appendYAMLBlock(append(buffer, '\n'), node[key], indent+2)
+			} else {
+				buffer = append(appendYAMLScalar(append(buffer, ' '), node[key]), '\n')
+			}
+
+		}
+
+	case []interface{}:
+
+		for _, value := range node {
+
+			buffer = append(buffer, padding...)
+			buffer = append(buffer, '-')
+
+			// Nested collections start on the same line as the dash
+			if isYAMLBlock(value) {
+				nested := appendYAMLBlock([]byte{}, value, indent+2)
+				buffer = append(append(buffer, ' '), nested[indent+2:]...)
+			} else {
+				buffer = append(appendYAMLScalar(append(buffer, ' '), value), '\n')
+			}
+
+		}
+
+	}
+
+	return buffer
+
+}
+
+// appendYAMLScalar appends a scalar (or an empty collection) on a single line,
+// quoting strings that would otherwise be read back as something else
+func appendYAMLScalar(buffer []byte, tree interface{}) []byte {
+
+	switch node := tree.(type) {
+
+	case nil:
+		return append(buffer, "null"...)
+	case bool:
+		return strconv.AppendBool(buffer, node)
+	case int64:
+		return strconv.AppendInt(buffer, node, 10)
+	case uint64:
+		return strconv.AppendUint(buffer, node, 10)
+	case float64:
+		return strconv.AppendFloat(buffer, node, 'g', -1, 64)
+	case map[string]interface{}:
+		return append(buffer, "{}"...)
+	case []interface{}:
+		return append(buffer, "[]"...)
+	case string:
+		if isPlainYAMLString(node) {
+			return append(buffer, node...)
+		}
+		return strconv.AppendQuote(buffer, node)
+
+	}
+
+	panic(fmt.Sprintf("yaml: cannot encode %T", tree))
+
+}
+
+// isPlainYAMLString checks whether a string can be written without quotes
+func isPlainYAMLString(value string) bool {
+
+	if value == "" || strings.TrimSpace(value) != value || strings.ContainsAny(value[:1], "-?:,[]{}#&*!|>'\"%@`") {
+		return false
+	}
+
+	if _, isString := resolveYAMLScalar(value).(string); !isString {
+		return false
+	}
+
+	if strings.Contains(value, ": ") || strings.Contains(value, " #") || strings.HasSuffix(value, ":") {
+		return false
+	}
+
+	for _, character := range value {
+
+		if character < ' ' || character == 0x7f || !strconv.IsPrint(character) {
+			return false
+		}
+
+	}
+
+	return true
+
+}
+
+// decodeYAML parses a YAML document into a tree
+func decodeYAML(body []byte) (interface{}, error) {
+
+	if !utf8.Valid(body) {
+		return nil, errors.New("yaml: document is not valid UTF-8")
+	}
+
+	lines, err := splitYAMLLines(string(body))
+
+	if err != nil {
+		return nil, err
+	}
+
+	parser := &yamlParser{lines: lines}
+	tree, err := parser.parseNode(-1)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if line, err := parser.peek(); err != nil {
+		return nil, err
+	} else if line != nil {
+		return nil, fmt.Errorf("yaml: line %v: unexpected content", line.number)
+	}
+
+	return tree, nil
+
+}
+
+// splitYAMLLines splits a document into lines, dropping any directives and
+// the markers around the document, and returns an error if the stream holds
+// more than one document
+func splitYAMLLines(document string) ([]yamlLine, error) {
+
+	lines := []yamlLine{}
+	started := false
+	ended := false
+
+	for i, text := range strings.Split(document, "\n") {
+
+		text = strings.TrimSuffix(text, "\r")
+		trimmed := strings.TrimLeft(text, " ")
+		line := yamlLine{number: i + 1, indent: len(text) - len(trimmed), text: trimmed}
+		isStart := line.indent == 0 && (text == "---" || strings.HasPrefix(text, "--- "))
+		isEnd := line.indent == 0 && (text == "..." || strings.HasPrefix(text, "... "))
+
+		// Only blank lines, comments and markers can follow the end of the
+		// document, as anything else belongs to another document
+		if ended || (started && isStart) {
+
+			if content := stripYAMLComment(strings.TrimLeft(strings.TrimLeft(text, "-."), " ")); content != "" {
+				return nil, fmt.Errorf("yaml: line %v: multiple documents are not supported", line.number)
+			}
+
+			ended = true
+
+			continue
+
+		}
+
+		if isStart {
+
+			// Anything before the start of the document is a directive or comment
+			lines = lines[:0]
+			line = yamlLine{number: i + 1, indent: 4, text: strings.TrimLeft(strings.TrimPrefix(text, "---"), " ")}
+
+		} else if isEnd {
+
+			ended = true
+
+			continue
+
+		}
+
+		if strings.TrimSpace(line.text) != "" && !strings.HasPrefix(line.text, "#") && !strings.HasPrefix(line.text, "%") {
+			started = true
+		}
+
+		lines = append(lines, line)
+
+	}
+
+	return lines, nil
+
+}
+
+// peek finds the next line with content, skipping blank lines and comments
+func (parser *yamlParser) peek() (*yamlLine, error) {
+
+	for ; parser.index < len(parser.lines); parser.index++ {
+
+		line := &parser.lines[parser.index]
+		text := strings.TrimSpace(line.text)
+
+		if text == "" || strings.HasPrefix(text, "#") || (strings.HasPrefix(text, "%") && line.indent == 0) {
+			continue
+		}
+
+		if strings.HasPrefix(line.text, "\t") {
+			return nil, fmt.Errorf("yaml: line %v: tabs cannot be used for indentation", line.number)
+		}
+
+		return line, nil
+
+	}
+
+	return nil, nil
+
+}
+
+// parseNode parses the node starting at the next line with content, which
+// must be indented further than its parent, or nil if there is no such line
+func (parser *yamlParser) parseNode(parentIndent int) (interface{}, error) {
+
+	line, err := parser.peek()
+
+	if err != nil || line == nil || line.indent <= parentIndent {
+		return nil, err
+	}
+
+	if parser.depth++; parser.depth > maxDecodeDepth {
+		return nil, errors.New("yaml: document is nested too deeply")
+	}
+
+	defer func() { parser.depth-- }()
+
+	content := stripYAMLComment(line.text)
+
+	if isYAMLSequenceEntry(content) {
+		return parser.parseSequence(line.indent)
+	}
+
+	if _, _, isEntry := splitYAMLMappingEntry(content); isEntry {
+		return parser.parseMapping(line.indent)
+	}
+
+	parser.index++
+
+	return parser.parseValue(content, parentIndent, line.number)
+
+}
+
+// parseSequence parses a block sequence whose entries are at an indentation
+func (parser *yamlParser) parseSequence(indent int) (interface{}, error) {
+
+	sequence := []interface{}{}
+
+	for {
+
+		line, err := parser.peek()
+
+		if err != nil {
+			return nil, err
+		}
+
+		// Sequences at the same indentation as their key end at the next key
+		if line == nil || line.indent < indent || (line.indent == indent && !isYAMLSequenceEntry(stripYAMLComment(line.text))) {
+			return sequence, nil
+		}
+
+		if line.indent > indent {
+			return nil, fmt.Errorf("yaml: line %v: expected a sequence entry", line.number)
+		}
+
+		rest := strings.TrimLeft(line.text[1:], " ")
+
+		// An entry with content on the same line as the dash is parsed as though
+		// the content started a new line, indented to where it appears
+		if stripYAMLComment(rest) == "" {
+			parser.index++
+		} else {
+			*line = yamlLine{number: line.number, indent: indent + len(line.text) - len(rest), text: rest}
+		}
+
+		value, err := parser.parseNode(indent)
+
+		if err != nil {
+			return nil, err
+		}
+
+		sequence = append(sequence, value)
+
+	}
+
+}
+
+// parseMapping parses a block mapping whose entries are at an indentation
+func (parser *yamlParser) parseMapping(indent int) (interface{}, error) {
+
+	mapping := map[string]interface{}{}
+
+	for {
+
+		line, err := parser.peek()
+
+		if err != nil {
+			return nil, err
+		}
+
+		if line == nil || line.indent < indent {
+			return mapping, nil
+		}
+
+		key, value, isEntry := splitYAMLMappingEntry(stripYAMLComment(line.text))
+
+		if line.indent > indent || !isEntry {
+			return nil, fmt.Errorf("yaml: line %v: expected a mapping entry", line.number)
+		}
+
+		if _, exists := mapping[key]; exists {
+			return nil, fmt.Errorf("yaml: line %v: duplicate key %v", line.number, key)
+		}
+
+		number := line.number
+		parser.index++
+
+		if value != "" {
+			mapping[key], err = parser.parseValue(value, indent, number)
+		} else {
+			mapping[key], err = parser.parseEntryNode(indent)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+	}
+
+}
+
+// parseEntryNode parses the node for a mapping entry whose value starts on the
+// following lines, where sequences are allowed at the same indentation as
+// their key
+func (parser *yamlParser) parseEntryNode(indent int) (interface{}, error) {
+
+	next, err := parser.peek()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if next != nil && next.indent == indent && isYAMLSequenceEntry(stripYAMLComment(next.text)) {
+		return parser.parseSequence(indent)
+	}
+
+	return parser.parseNode(indent)
+
+}
+
+// parseValue parses a value that starts on a line that has already been
+// consumed, continuing onto any following lines indented further than the
+// value's parent where the value spans several lines
+func (parser *yamlParser) parseValue(value string, parentIndent int, number int) (interface{}, error) {
+
+	if strings.HasPrefix(value, "|") || strings.HasPrefix(value, ">") {
+		return parser.parseBlockScalar(value, parentIndent, number)
+	}
+
+	if strings.ContainsAny(value[:1], "&*!") || strings.HasPrefix(value, "? ") {
+		return nil, fmt.Errorf("yaml: line %v: anchors, aliases, tags and complex keys are not supported", number)
+	}
+
+	// Flow collections and quoted scalars continue until they are closed, and
+	// plain scalars until the indentation returns to that of their parent
+	for {
+
+		if (value[0] == '[' || value[0] == '{' || value[0] == '"' || value[0] == '\'') && isYAMLFlowClosed(value) {
+			break
+		}
+
+		line, err := parser.peek()
+
+		if err != nil {
+			return nil, err
+		}
+
+		if line == nil || line.indent <= parentIndent {
+			break
+		}
+
+		if value[0] != '[' && value[0] != '{' && value[0] != '"' && value[0] != '\'' {
+
+			if _, _, isEntry := splitYAMLMappingEntry(stripYAMLComment(line.text)); isEntry || isYAMLSequenceEntry(line.text) {
+				return nil, fmt.Errorf("yaml: line %v: unexpected mapping or sequence after a scalar", line.number)
+			}
+
+		}
+
+		value += " " + stripYAMLComment(line.text)
+		parser.index++
+
+	}
+
+	// A plain scalar cannot contain a mapping entry, as in "a: b: c"
+	if value[0] != '[' && value[0] != '{' && value[0] != '"' && value[0] != '\'' && (strings.Contains(value, ": ") || strings.HasSuffix(value, ":")) {
+		return nil, fmt.Errorf("yaml: line %v: mapping values are not allowed in a plain scalar", number)
+	}
+
+	flowParser := yamlFlowParser{text: value}
+	tree, err := flowParser.parseValue(false)
+
+	if err == nil && flowParser.skipSpaces() < len(value) {
+		err = errors.New("unexpected content after value")
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("yaml: line %v: %w", number, err)
+	}
+
+	return tree, nil
+
+}
+
+// parseBlockScalar parses a literal (|) or folded (>) block scalar, whose
+// content is on the lines following its header
+func (parser *yamlParser) parseBlockScalar(header string, parentIndent int, number int) (interface{}, error) {
+
+	folded := header[0] == '>'
+	chomping := byte(0)
+	contentIndent := -1
+
+	for _, indicator := range []byte(strings.TrimSpace(header[1:])) {
+
+		switch {
+		case indicator == '-' || indicator == '+':
+			chomping = indicator
+		case indicator >= '1' && indicator <= '9':
+			contentIndent = int(indicator - '0')
+
+			if parentIndent > 0 {
+				contentIndent += parentIndent
+			}
+		default:
+			return nil, fmt.Errorf("yaml: line %v: invalid block scalar header %v", number, header)
+		}
+
+	}
+
+	// Gather the content lines, which are those indented further than the
+	// parent along with any blank lines between them
+	lines := []yamlLine{}
+
+	for ; parser.index < len(parser.lines); parser.index++ {
+
+		line := parser.lines[parser.index]
+
+		if strings.TrimSpace(line.text) == "" {
+			lines = append(lines, yamlLine{indent: line.indent})
+			continue
+		}
+
+		if contentIndent < 0 {
+			contentIndent = line.indent
+		}
+
+		if line.indent < contentIndent || line.indent <= parentIndent {
+			break
+		}
+
+		lines = append(lines, line)
+
+	}
+
+	// Trailing blank lines that were gathered belong to the next node, although
+	// they still count towards kept line breaks
+	trailing := 0
+
+	for trailing < len(lines) && lines[len(lines)-1-trailing].text == "" {
+		trailing++
+	}
+
+	content := []string{}
+
+	for _, line := range lines[:len(lines)-trailing] {
+
+		if line.text == "" {
+			content = append(content, "")
+		} else {
+			content = append(content, strings.Repeat(" ", line.indent-contentIndent)+line.text)
+		}
+
+	}
+
+	text := ""
+
+	if folded {
+		text = foldYAMLLines(content)
+	} else {
+		text = strings.Join(content, "\n")
+	}
+
+	switch {
+	case len(content) == 0:
+	case chomping == '+':
+		text += strings.Repeat("\n", trailing+1)
+	case chomping == 0:
+		text += "\n"
+	}
+
+	return text, nil
+
+}
+
+// foldYAMLLines joins the lines of a folded block scalar, turning single line
+// breaks into spaces except around more indented lines, and blank lines into
+// line breaks
+func foldYAMLLines(lines []string) string {
+
+	builder := strings.Builder{}
+
+	for i, line := range lines {
+
+		if i > 0 {
+
+			previous := lines[i-1]
+
+			switch {
+			case line == "":
+				builder.WriteByte('\n')
+			case previous == "":
+			case strings.HasPrefix(line, " ") || strings.HasPrefix(previous, " "):
+				builder.WriteByte('\n')
+			default:
+				builder.WriteByte(' ')
+			}
+
+		}
+
+		builder.WriteString(line)
+
+	}
+
+	return builder.String()
+
+}
+
+// isYAMLSequenceEntry checks whether the content of a line is a sequence entry
+func isYAMLSequenceEntry(content string) bool {
+
+	return content == "-" || strings.HasPrefix(content, "- ")
+
+}
+
+// splitYAMLMappingEntry splits the content of a line into the key and value of
+// a mapping entry, if it is one
+func splitYAMLMappingEntry(content string) (string, string, bool) {
+
+	if content == "" || strings.ContainsAny(content[:1], "[{") || isYAMLSequenceEntry(content) {
+		return "", "", false
+	}
+
+	// Quoted keys end at their closing quote
+	if content[0] == '"' || content[0] == '\'' {
+
+		flowParser := yamlFlowParser{text: content}
+		key, err := flowParser.parseQuoted()
+
+		if err != nil {
+			return "", "", false
+		}
+
+		rest := strings.TrimLeft(content[flowParser.pos:], " ")
+
+		if rest != ":" && !strings.HasPrefix(rest, ": ") {
+			return "", "", false
+		}
+
+		return key, strings.TrimSpace(rest[1:]), true
+
+	}
+
+	for i := 0; i < len(content); i++ {
+
+		if content[i] == ':' && (i == len(content)-1 || content[i+1] == ' ') {
+			return strings.TrimRight(content[:i], " "), strings.TrimSpace(content[i+1:]), true
+		}
+
+	}
+
+	return "", "", false
+
+}
+
+// stripYAMLComment removes any comment from the end of a line, ignoring # marks
+// within quoted scalars
+func stripYAMLComment(text string) string {
+
+	quote := byte(0)
+	previous := byte(0)
+
+	for i := 0; i < len(text); i++ {
+
+		character := text[i]
+
+		switch {
+
+		case quote == '"' && character == '\\':
+			i++
+		case quote != 0 && character == quote:
+			quote = 0
+		case quote != 0:
+		case (character == '"' || character == '\'') && strings.IndexByte("\x00:-[{,?", previous) >= 0:
+			quote = character
+		case character == '#' && (i == 0 || text[i-1] == ' ' || text[i-1] == '\t'):
+			return strings.TrimRight(text[:i], " \t")
+
+		}
+
+		if character != ' ' && character != '\t' {
+			previous = character
+		}
+
+	}
+
+	return strings.TrimRight(text, " \t")
+
+}
+
+// isYAMLFlowClosed checks whether a flow collection or quoted scalar is
+// complete, by balancing brackets and quotes
+func isYAMLFlowClosed(value string) bool {
+
+	depth := 0
+	quote := byte(0)
+
+	for i := 0; i < len(value); i++ {
+
+		character := value[i]
+
+		switch {
+		case quote == '"' && character == '\\':
+			i++
+		case quote == '\'' && character == '\'' && i+1 < len(value) && value[i+1] == '\'':
+			i++
+		case quote != 0 && character == quote:
+			quote = 0
+			if depth == 0 {
+				return true
+			}
+		case quote != 0:
+		case character == '"' || character == '\'':
+			quote = character
+		case character == '[' || character == '{':
+			depth++
+		case character == ']' || character == '}':
+			if depth--; depth == 0 {
+				return true
+			}
+		}
+
+	}
+
+	return false
+
+}
+
+// resolveYAMLScalar resolves a plain scalar into a null, boolean, number or
+// string according to the YAML 1.2 core schema
+func resolveYAMLScalar(value string) interface{} {
+
+	switch value {
+	case "", "~", "null", "Null", "NULL":
+		return nil
+	case "true", "True", "TRUE":
+		return true
+	case "false", "False", "FALSE":
+		return false
+	case ".inf", ".Inf", ".INF", "+.inf", "+.Inf", "+.INF":
+		return math.Inf(1)
+	case "-.inf", "-.Inf", "-.INF":
+		return math.Inf(-1)
+	case ".nan", ".NaN", ".NAN":
+		return math.NaN()
+	}
+
+	if strings.HasPrefix(value, "0x") {
+
+		if integer, err := strconv.ParseUint(value[2:], 16, 64); err == nil {
+			return integer
+		}
+
+	}
+
+	if strings.HasPrefix(value, "0o") {
+
+		if integer, err := strconv.ParseUint(value[2:], 8, 64); err == nil {
+			return integer
+		}
+
+	}
+
+	if !yamlFloat.MatchString(value) {
+		return value
+	}
+
+	if integer, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return integer
+	}
+
+	if integer, err := strconv.ParseUint(strings.TrimPrefix(value, "+"), 10, 64); err == nil {
+		return integer
+	}
+
+	if float, err := strconv.ParseFloat(value, 64); err == nil {
+		return float
+	}
+
+	return value
+
+}
+
+// parseValue parses a flow collection or scalar, where scalars within flow
+// collections end at flow indicators
+func (parser *yamlFlowParser) parseValue(inFlow bool) (interface{}, error) {
+
+	if parser.depth++; parser.depth > maxDecodeDepth {
+		return nil, errors.New("flow collection is nested too deeply")
+	}
+
+	defer func() { parser.depth-- }()
+
+	if parser.skipSpaces() >= len(parser.text) {
+		return nil, nil
+	}
+
+	switch parser.text[parser.pos] {
+
+	case '[':
+
+		return parser.parseSequence()
+
+	case '{':
+
+		return parser.parseMapping()
+
+	case '"', '\'':
+
+		return parser.parseQuoted()
+
+	case '&', '*', '!':
+
+		return nil, errors.New("anchors, aliases and tags are not supported")
+
+	}
+
+	return resolveYAMLScalar(parser.parsePlain(inFlow, false)), nil
+
+}
+
+// parseSequence parses a flow sequence
+func (parser *yamlFlowParser) parseSequence() (interface{}, error) {
+
+	sequence := []interface{}{}
+	parser.pos++
+
+	for {
+
+		if parser.skipSpaces() >= len(parser.text) {
+			return nil, errors.New("unterminated flow sequence")
+		}
+
+		if parser.text[parser.pos] == ']' {
+			parser.pos++
+			return sequence, nil
+		}
+
+		value, err := parser.parseValue(true)
+
+		if err != nil {
+			return nil, err
+		}
+
+		sequence = append(sequence, value)
+
+		if err := parser.skipSeparator(']'); err != nil {
+			return nil, err
+		}
+
+	}
+
+}
+
+// parseMapping parses a flow mapping
+func (parser *yamlFlowParser) parseMapping() (interface{}, error) {
+
+	mapping := map[string]interface{}{}
+	parser.pos++
+
+	for {
+
+		if parser.skipSpaces() >= len(parser.text) {
+			return nil, errors.New("unterminated flow mapping")
+		}
+
+		if parser.text[parser.pos] == '}' {
+			parser.pos++
+			return mapping, nil
+		}
+
+		key := ""
+
+		if character := parser.text[parser.pos]; character == '"' || character == '\'' {
+
+			quoted, err := parser.parseQuoted()
+
+			if err != nil {
+				return nil, err
+			}
+
+			key = quoted
+
+		} else {
+			key = parser.parsePlain(true, true)
+		}
+
+		var value interface{}
+
+		// Keys without a value have a null value
+		if parser.skipSpaces() < len(parser.text) && parser.text[parser.pos] == ':' {
+
+			parser.pos++
+
+			var err error
+
+			if value, err = parser.parseValue(true); err != nil {
+				return nil, err
+			}
+
+		}
+
+		mapping[key] = value
+
+		if err := parser.skipSeparator('}'); err != nil {
+			return nil, err
+		}
+
+	}
+
+}
+
+// parsePlain parses a plain scalar, which within a flow collection ends at a
+// flow indicator, and as a key ends at a colon
+func (parser *yamlFlowParser) parsePlain(inFlow bool, isKey bool) string {
+
+	start := parser.pos
+
+	for ; parser.pos < len(parser.text); parser.pos++ {
+
+		character := parser.text[parser.pos]
+
+		if inFlow && strings.IndexByte(",[]{}", character) >= 0 {
+			break
+		}
+
+		if isKey && character == ':' && (parser.pos+1 == len(parser.text) || strings.IndexByte(" ,[]{}", parser.text[parser.pos+1]) >= 0) {
+			break
+		}
+
+	}
+
+	return strings.TrimSpace(parser.text[start:parser.pos])
+
+}
+
+// parseQuoted parses a single or double quoted scalar
+func (parser *yamlFlowParser) parseQuoted() (string, error) {
+
+	quote := parser.text[parser.pos]
+	builder := strings.Builder{}
+
+	for parser.pos++; parser.pos < len(parser.text); parser.pos++ {
+
+		character := parser.text[parser.pos]
+
+		switch {
+
+		case quote == '\'' && character == '\'':
+
+			// Single quotes are escaped by doubling them
+			if parser.pos+1 < len(parser.text) && parser.text[parser.pos+1] == '\'' {
+				builder.WriteByte('\'')
+				parser.pos++
+				continue
+			}
+
+			parser.pos++
+
+			return builder.String(), nil
+
+		case quote == '"' && character == '"':
+
+			parser.pos++
+
+			return builder.String(), nil
+
+		case quote == '"' && character == '\\':
+
+			if err := parser.parseEscape(&builder); err != nil {
+				return "", err
+			}
+
+		default:
+
+			builder.WriteByte(character)
+
+		}
+
+	}
+
+	return "", errors.New("unterminated quoted scalar")
+
+}
+
+// parseEscape parses an escape sequence within a double quoted scalar, where
+// the current position is at the backslash
+func (parser *yamlFlowParser) parseEscape(builder *strings.Builder) error {
+
+	if parser.pos++; parser.pos >= len(parser.text) {
+		return errors.New("unterminated escape sequence")
+	}
+
+	simple := map[byte]string{
+		'0': "\x00", 'a': "\a", 'b': "\b", 't': "\t", '\t': "\t", 'n': "\n", 'v': "\v", 'f': "\f", 'r': "\r",
+		'e': "\x1b", ' ': " ", '"': "\"", '/': "/", '\\': "\\", 'N': "\u0085", '_': "\u00a0", 'L': "\u2028", 'P': "\u2029",
+	}
+
+	character := parser.text[parser.pos]
+
+	if replacement, ok := simple[character]; ok {
+		builder.WriteString(replacement)
+		return nil
+	}
+
+	digits := map[byte]int{'x': 2, 'u': 4, 'U': 8}[character]
+
+	if digits == 0 || parser.pos+digits >= len(parser.text) {
+		return fmt.Errorf("invalid escape sequence \\%c", character)
+	}
+
+	code, err := strconv.ParseUint(parser.text[parser.pos+1:parser.pos+1+digits], 16, 32)
+
+	if err != nil || !utf8.ValidRune(rune(code)) {
+		return fmt.Errorf("invalid escape sequence \\%v", parser.text[parser.pos:parser.pos+1+digits])
+	}
+
+	builder.WriteRune(rune(code))
+	parser.pos += digits
+
+	return nil
+
+}
+
+// skipSeparator skips the comma between entries of a flow collection, or
+// stops at the end of the collection
+func (parser *yamlFlowParser) skipSeparator(end byte) error {
+
+	if parser.skipSpaces() >= len(parser.text) {
+		return errors.New("unterminated flow collection")
+	}
+
+	switch parser.text[parser.pos] {
+	case ',':
+		parser.pos++
+		return nil
+	case end:
+		return nil
+	}
+
+	return fmt.Errorf("unexpected %c in flow collection", parser.text[parser.pos])
+
+}
+
+// skipSpaces skips any spaces, returning the new position
+func (parser *yamlFlowParser) skipSpaces() int {
+
+	for parser.pos < len(parser.text) && (parser.text[parser.pos] == ' ' || parser.text[parser.pos] == '\t') {
+		parser.pos++
+	}
+
+	return parser.pos
+
+}
@@ -0,0 +1,217 @@
+package jsonserver
+
+import (
+	"reflect"
+	"testing"
+)
+
+// testYAMLDocument is a YAML document using most of the supported syntax
+const testYAMLDocument = `%YAML 1.2
+# Leading comment
+---
+openapi: 3.1.0
+info:
+  title: "Shop: API" # trailing comment
+  version: '1.0'
+  description: |
+    Line one
+      indented
+
+    Line three
+  summary: >-
+    Folded
+    text
+
+    new paragraph
+tags: [products, 'orders', {name: admin, hidden: true}]
+servers:
+- url: https://example.com/api
+  description: Production
+- url: http://localhost:8080
+paths:
+  /products/{id}:
+    get:
+      parameters:
+        - name: id
+          in: path
+          required: true
+      responses:
+        "200":
+          description: OK
+        404: {description: Not found}
+numbers:
+  - 42
+  - -7
+  - 3.5
+  - 1e3
+  - 0x1F
+  - 18446744073709551615
+nothing: ~
+empty: ""
+plain: it's a plain#value # comment
+multi: this continues
+  onto the next line
+escapes: "tab\there \u00e9 \"quoted\""
+nested:
+  - - a
+    - b
+  - []
+...
+# Comments can follow the end of the document
+`
+
+// TestYAMLDecode tests decoding a document using most of the supported syntax
+func TestYAMLDecode(t *testing.T) {
+
+	expected := map[string]interface{}{
+		"openapi": "3.1.0",
+		"info": map[string]interface{}{
+			"title":       "Shop: API",
+			"version":     "1.0",
+			"description": "Line one\n  indented\n\nLine three\n",
+			"summary":     "Folded text\nnew paragraph",
+		},
+		"tags": []interface{}{"products", "orders", map[string]interface{}{"name": "admin", "hidden": true}},
+		"servers": []interface{}{
+			map[string]interface{}{"url": "https://example.com/api", "description": "Production"},
+			map[string]interface{}{"url": "http://localhost:8080"},
+		},
+		"paths": map[string]interface{}{
+			"/products/{id}": map[string]interface{}{
+				"get": map[string]interface{}{
+					"parameters": []interface{}{map[string]interface{}{"name": "id", "in": "path", "required": true}},
+					"responses": map[string]interface{}{
+						"200": map[string]interface{}{"description": "OK"},
+						"404": map[string]interface{}{"description": "Not found"},
+					},
+				},
+			},
+		},
+		"numbers": []interface{}{int64(42), int64(-7), 3.5, 1000.0, uint64(31), uint64(18446744073709551615)},
+		"nothing": nil,
+		"empty":   "",
+		"plain":   "it's a plain#value",
+		"multi":   "this continues onto the next line",
+		"escapes": "tab\there \u00e9 \"quoted\"",
+		"nested":  []interface{}{[]interface{}{"a", "b"}, []interface{}{}},
+	}
+
+	tree, err := decodeYAML([]byte(testYAMLDocument))
+
+	if err != nil {
+		t.Fatalf("Unexpected error decoding YAML: %v", err)
+	}
+
+	if !reflect.DeepEqual(tree, expected) {
+		t.Errorf("YAML was not decoded correctly (expected: %#v, actual: %#v)", expected, tree)
+	}
+
+}
+
+// TestYAMLDecodeScalars tests decoding documents that are a single scalar
+func TestYAMLDecodeScalars(t *testing.T) {
+
+	documents := map[string]interface{}{
+		"":                    nil,
+		"true\n":              true,
+		"hello world":         "hello world",
+		"'it''s'":             "it's",
+		"--- 12":              int64(12),
+		"|-\n  text\n":        "text",
+		"--- 1\n...\n# end\n": int64(1),
+	}
+
+	for document, expected := range documents {
+
+		tree, err := decodeYAML([]byte(document))
+
+		if err != nil || !reflect.DeepEqual(tree, expected) {
+			t.Errorf("Incorrect value for %q (expected: %#v, actual: %#v, error: %v)", document, expected, tree, err)
+		}
+
+	}
+
+}
+
+// TestYAMLDecodeErrors tests that unsupported or malformed documents are
+// rejected
+func TestYAMLDecodeErrors(t *testing.T) {
+
+	documents := []string{
+		"a: 1\n  b: 2",
+		"a: 1\nb",
+		"- a\nb: 1",
+		"a: 1\na: 2",
+		"a: &anchor 1",
+		"a: *anchor",
+		"a: !!str 1",
+		"a: [1, 2",
+		"a: {b: 1",
+		"a: \"unterminated",
+		"a:\n\t- 1",
+		"a: \"\\q\"",
+		"key: value\n  - item",
+		"a: 1\n---\nb: 2",
+		"--- 1\n--- 2",
+		"a: 1\n...\n---\nb: 2",
+		"a: 1\n...\nb: 2",
+		"a: b: c",
+		"a: b:",
+		"- a: b: c",
+	}
+
+	for _, document := range documents {
+
+		if tree, err := decodeYAML([]byte(document)); err == nil {
+			t.Errorf("Invalid document %q was decoded as %#v", document, tree)
+		}
+
+	}
+
+}
+
+// TestYAMLRoundTrip tests that encoded values decode back to the same value
+func TestYAMLRoundTrip(t *testing.T) {
+
+	value := map[string]interface{}{
+		"strings": []interface{}{"plain", "", " padded ", "true", "123", "1.5", "null", "- dash", "a: b", "#hash", "line\nbreak", "quote\"", "ünïcödé"},
+		"numbers": []interface{}{0.0, -1.0, 2.5, 1e21},
+		"nested":  []interface{}{map[string]interface{}{"a": 1.0, "b": []interface{}{1.0, []interface{}{2.0}}}, []interface{}{}, map[string]interface{}{}},
+		"200":     nil,
+		"yes":     true,
+	}
+
+	encoded, err := YAMLCodec{}.Encode(value)
+
+	if err != nil {
+		t.Fatalf("Unexpected error encoding YAML: %v", err)
+	}
+
+	decoded := map[string]interface{}{}
+
+	if err := (YAMLCodec{}).Decode(encoded, &decoded); err != nil {
+		t.Fatalf("Unexpected error decoding YAML: %v\n%s", err, encoded)
+	}
+
+	if !reflect.DeepEqual(decoded, value) {
+		t.Errorf("YAML did not round trip (expected: %#v, actual: %#v)\n%s", value, decoded, encoded)
+	}
+
+}
+
+// TestYAMLEncode tests the layout of encoded YAML
+func TestYAMLEncode(t *testing.T) {
+
+	type testPerson struct {
+		Name string   `json:"name"`
+		Tags []string `json:"tags"`
+	}
+
+	encoded, err := YAMLCodec{}.Encode([]testPerson{{"Ann", []string{"a", "b"}}, {"Bob", nil}})
+	expected := "- name: Ann\n  tags:\n    - a\n    - b\n- name: Bob\n  tags: null\n"
+
+	if err != nil || string(encoded) != expected {
+		t.Errorf("Incorrect YAML (expected: %q, actual: %q)", expected, encoded)
+	}
+
+}